@@ -39,6 +39,22 @@ type CacheClient interface {
 	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
 }
 
+// SortedSetCacheClient is implemented by the cache clients supporting the sorted sets, e.g. credis.
+// The packages using it assert it on the CacheClient.
+type SortedSetCacheClient interface {
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	// ZRangeByScore returns up to count members whose score is between min and max, by ascending score
+	ZRangeByScore(ctx context.Context, key string, min float64, max float64, offset int64, count int64) ([]string, error)
+	ZRem(ctx context.Context, key string, members ...interface{}) error
+}
+
+// CompareAndDeleteCacheClient is implemented by the cache clients deleting the keys atomically by value, e.g. credis.
+// The packages using it assert it on the CacheClient.
+type CompareAndDeleteCacheClient interface {
+	// DelIfEqual deletes the key when it holds the value set by Set or SetNX, and reports whether it was deleted
+	DelIfEqual(ctx context.Context, key string, value interface{}) (bool, error)
+}
+
 func Get(ctx context.Context, key string, dest interface{}) (time.Duration, error) {
 	return DefaultCacheClient.Get(ctx, key, dest)
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/kingstonduy/go-core/cache"
@@ -127,6 +129,58 @@ func (r *redisCacheClient) SMembers(ctx context.Context, key string) ([]string,
 	return r.rClient.SMembers(ctx, key).Result()
 }
 
+// ZAdd implements cache.SortedSetCacheClient.
+func (r *redisCacheClient) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return r.rClient.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err()
+}
+
+// ZRangeByScore implements cache.SortedSetCacheClient.
+func (r *redisCacheClient) ZRangeByScore(ctx context.Context, key string, min float64, max float64, offset int64, count int64) ([]string, error) {
+	return r.rClient.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:    formatScore(min),
+		Max:    formatScore(max),
+		Offset: offset,
+		Count:  count,
+	}).Result()
+}
+
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, -1):
+		return "-inf"
+	case math.IsInf(score, 1):
+		return "+inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+// ZRem implements cache.SortedSetCacheClient.
+func (r *redisCacheClient) ZRem(ctx context.Context, key string, members ...any) error {
+	return r.rClient.ZRem(ctx, key, members...).Err()
+}
+
+// the key is deleted only when it holds the value
+var delIfEqualScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// DelIfEqual implements cache.CompareAndDeleteCacheClient.
+func (r *redisCacheClient) DelIfEqual(ctx context.Context, key string, value any) (bool, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal value: %w", err)
+	}
+
+	n, err := delIfEqualScript.Run(ctx, r.rClient, []string{key}, bytes).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
 // Set implements cache.CacheClient.
 func (r *redisCacheClient) Set(ctx context.Context, key string, values any, expiration time.Duration) error {
 	if expiration == 0 {
@@ -0,0 +1,193 @@
+// Package claimcheck implements the claim-check pattern:
+// the oversized message bodies are stored in a blob store and replaced by a reference header,
+// the consumers load the body back before the handler runs.
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	ErrNotFound = errors.New("claim-check body not found")
+
+	ErrCleanupStarted    = errors.New("claim-check cleanup already started")
+	ErrCleanupNotStarted = errors.New("claim-check cleanup not started")
+)
+
+// Store stores the message bodies by key
+type Store interface {
+	Put(ctx context.Context, key string, body []byte) error
+	// Get returns the body of the key, ErrNotFound when it does not exist
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// Purge deletes the bodies stored before the time and returns their count
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// ClaimCheck stores the oversized bodies of the published messages and loads them back for the handlers
+type ClaimCheck struct {
+	store Store
+	opts  Options
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func New(store Store, opts ...Option) *ClaimCheck {
+	return &ClaimCheck{
+		store: store,
+		opts:  NewOptions(opts...),
+	}
+}
+
+// BrokerOption installs the publish and subscribe middlewares on the broker
+func (c *ClaimCheck) BrokerOption() broker.BrokerOption {
+	return func(o *broker.BrokerOptions) {
+		broker.WithPublishMiddleware(c.PublishMiddleware())(o)
+		broker.WithSubscribeMiddleware(c.SubscribeMiddleware())(o)
+	}
+}
+
+// PublishMiddleware stores the bodies above the threshold and publishes
+// the message with the claimCheck header instead of the body, see broker.WithPublishMiddleware
+func (c *ClaimCheck) PublishMiddleware() broker.PublishMiddleware {
+	return func(next broker.PublishFunc) broker.PublishFunc {
+		return func(ctx context.Context, topic string, m *broker.Message, opts ...broker.PublishOption) error {
+			if m == nil || len(m.Body) <= c.threshold(opts...) {
+				return next(ctx, topic, m, opts...)
+			}
+
+			key := uuid.New().String()
+			if err := c.store.Put(ctx, key, m.Body); err != nil {
+				return fmt.Errorf("failed to store claim-check body: %w", err)
+			}
+
+			// the message of the caller is left untouched
+			headers := make(map[string]string, len(m.Headers)+2)
+			for k, v := range m.Headers {
+				headers[k] = v
+			}
+			headers[metadata.HeaderClaimCheck] = key
+			headers[metadata.HeaderClaimCheckSize] = strconv.Itoa(len(m.Body))
+
+			return next(ctx, topic, &broker.Message{
+				Headers: headers,
+				Key:     m.Key,
+			}, opts...)
+		}
+	}
+}
+
+// SubscribeMiddleware loads the body of the messages with a claimCheck header before the handler runs,
+// see broker.WithSubscribeMiddleware
+func (c *ClaimCheck) SubscribeMiddleware() broker.SubscribeMiddleware {
+	return func(next broker.Handler) broker.Handler {
+		return func(ctx context.Context, e broker.Event) error {
+			m := e.Message()
+			if m == nil {
+				return next(ctx, e)
+			}
+
+			key, ok := m.Headers[metadata.HeaderClaimCheck]
+			if !ok || len(key) == 0 {
+				return next(ctx, e)
+			}
+
+			body, err := c.store.Get(ctx, key)
+			if err != nil {
+				return fmt.Errorf("failed to load claim-check body %s: %w", key, err)
+			}
+
+			m.Body = body
+			delete(m.Headers, metadata.HeaderClaimCheck)
+			delete(m.Headers, metadata.HeaderClaimCheckSize)
+
+			return next(ctx, e)
+		}
+	}
+}
+
+// Start deletes the bodies older than the TTL every cleanup interval
+func (c *ClaimCheck) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		return ErrCleanupStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go c.run(ctx, c.done)
+	return nil
+}
+
+// Stop stops the cleanup
+func (c *ClaimCheck) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel, c.done = nil, nil
+	c.mu.Unlock()
+
+	if cancel == nil {
+		return ErrCleanupNotStarted
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Cleanup deletes the bodies older than the TTL
+func (c *ClaimCheck) Cleanup(ctx context.Context) (int, error) {
+	return c.store.Purge(ctx, time.Now().Add(-c.opts.TTL))
+}
+
+func (c *ClaimCheck) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	for {
+		n, err := c.Cleanup(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.opts.getLogger().Errorf(ctx, "Failed to clean up claim-check bodies: %v", err)
+		} else if n > 0 {
+			c.opts.getLogger().Infof(ctx, "Deleted %d expired claim-check bodies", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.opts.CleanupInterval):
+		}
+	}
+}
+
+func (c *ClaimCheck) threshold(opts ...broker.PublishOption) int {
+	options := broker.NewPublishOptions(opts...)
+	if options.Context != nil {
+		if threshold, ok := options.Context.Value(thresholdKey{}).(int); ok {
+			if threshold < 0 {
+				return math.MaxInt
+			}
+			return threshold
+		}
+	}
+	return c.opts.Threshold
+}
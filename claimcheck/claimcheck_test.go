@@ -0,0 +1,151 @@
+package claimcheck
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) (Store, string) {
+	dir := filepath.Join(t.TempDir(), "claimcheck")
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, dir
+}
+
+func TestClaimCheck(t *testing.T) {
+	store, dir := newTestStore(t)
+	cc := New(store, WithThreshold(10))
+
+	// the broker publishing and the broker consuming share the store
+	var published []*broker.Message
+	br := memory.NewBroker(
+		cc.BrokerOption(),
+		broker.WithPublishMiddleware(func(next broker.PublishFunc) broker.PublishFunc {
+			return func(ctx context.Context, topic string, m *broker.Message, opts ...broker.PublishOption) error {
+				published = append(published, m)
+				return next(ctx, topic, m, opts...)
+			}
+		}),
+	)
+	assert.NoError(t, br.Connect())
+
+	received := make(chan *broker.Message, 2)
+	_, err := br.Subscribe("statement.created", func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	})
+	assert.NoError(t, err)
+
+	large := &broker.Message{Headers: map[string]string{"key": "value"}, Body: []byte(strings.Repeat("x", 100))}
+	assert.NoError(t, br.Publish(context.TODO(), "statement.created", large))
+	assert.NoError(t, br.Publish(context.TODO(), "statement.created", &broker.Message{Body: []byte("small")}))
+
+	// the large body is replaced by the reference, the caller message is untouched
+	assert.Empty(t, published[0].Body)
+	assert.NotEmpty(t, published[0].Headers[metadata.HeaderClaimCheck])
+	assert.Equal(t, "100", published[0].Headers[metadata.HeaderClaimCheckSize])
+	assert.Len(t, large.Body, 100)
+	assert.Equal(t, []byte("small"), published[1].Body)
+
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+
+	for _, body := range []string{strings.Repeat("x", 100), "small"} {
+		select {
+		case m := <-received:
+			assert.Equal(t, body, string(m.Body))
+			assert.Equal(t, "", m.Headers[metadata.HeaderClaimCheck])
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not received")
+		}
+	}
+}
+
+func TestPublishThreshold(t *testing.T) {
+	store, _ := newTestStore(t)
+	cc := New(store, WithThreshold(10))
+
+	var published *broker.Message
+	publish := cc.PublishMiddleware()(func(ctx context.Context, topic string, m *broker.Message, opts ...broker.PublishOption) error {
+		published = m
+		return nil
+	})
+
+	body := []byte(strings.Repeat("x", 100))
+	assert.NoError(t, publish(context.TODO(), "topic", &broker.Message{Body: body}, PublishThreshold(-1)))
+	assert.Equal(t, body, published.Body)
+
+	assert.NoError(t, publish(context.TODO(), "topic", &broker.Message{Body: []byte("small")}, PublishThreshold(1)))
+	assert.NotEmpty(t, published.Headers[metadata.HeaderClaimCheck])
+}
+
+func TestMissingBody(t *testing.T) {
+	store, _ := newTestStore(t)
+	cc := New(store)
+
+	h := cc.SubscribeMiddleware()(func(ctx context.Context, e broker.Event) error {
+		t.Fatal("handler called")
+		return nil
+	})
+
+	err := h(context.TODO(), &testEvent{m: &broker.Message{
+		Headers: map[string]string{metadata.HeaderClaimCheck: "unknown"},
+	}})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCleanup(t *testing.T) {
+	store, dir := newTestStore(t)
+	cc := New(store, WithTTL(time.Hour))
+
+	assert.NoError(t, store.Put(context.TODO(), "expired", []byte("body")))
+	assert.NoError(t, store.Put(context.TODO(), "fresh", []byte("body")))
+
+	past := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "expired"), past, past))
+
+	n, err := cc.Cleanup(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	_, err = store.Get(context.TODO(), "expired")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	body, err := store.Get(context.TODO(), "fresh")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("body"), body)
+
+	assert.NoError(t, cc.Start(context.TODO()))
+	assert.ErrorIs(t, cc.Start(context.TODO()), ErrCleanupStarted)
+	assert.NoError(t, cc.Stop(context.TODO()))
+	assert.ErrorIs(t, cc.Stop(context.TODO()), ErrCleanupNotStarted)
+}
+
+func TestInvalidKey(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	for _, key := range []string{"", "../etc/passwd", ".tmp-1", `a\b`} {
+		_, err := store.Get(context.TODO(), key)
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	}
+}
+
+type testEvent struct {
+	broker.Event
+	m *broker.Message
+}
+
+func (e *testEvent) Message() *broker.Message {
+	return e.m
+}
@@ -0,0 +1,82 @@
+package claimcheck
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	// below the default message.max.bytes of kafka (1MB)
+	DefaultThreshold       = 512 * 1024
+	DefaultTTL             = 7 * 24 * time.Hour
+	DefaultCleanupInterval = time.Hour
+)
+
+type Options struct {
+	// bodies larger than Threshold bytes are stored
+	Threshold int
+
+	// stored bodies older than TTL are deleted by the cleanup, it must exceed the consumer lag
+	TTL time.Duration
+
+	CleanupInterval time.Duration
+
+	Logger logger.Logger
+}
+
+type Option func(*Options)
+
+func WithThreshold(bytes int) Option {
+	return func(o *Options) {
+		o.Threshold = bytes
+	}
+}
+
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = ttl
+	}
+}
+
+func WithCleanupInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.CleanupInterval = interval
+	}
+}
+
+func WithLogger(log logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = log
+	}
+}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		Threshold:       DefaultThreshold,
+		TTL:             DefaultTTL,
+		CleanupInterval: DefaultCleanupInterval,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+func (o Options) getLogger() logger.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return logger.DefaultLogger
+}
+
+type thresholdKey struct{}
+
+// PublishThreshold overrides the threshold of the claim-check for one publish,
+// a negative threshold publishes the body as is
+func PublishThreshold(bytes int) broker.PublishOption {
+	return broker.SetPublishOption(thresholdKey{}, bytes)
+}
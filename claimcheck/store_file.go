@@ -0,0 +1,122 @@
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid claim-check key")
+)
+
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore stores the bodies as the files of the directory, the consumers must share the directory.
+// The modification time of the files is their storage time.
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create claim-check directory: %w", err)
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) Put(ctx context.Context, key string, body []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	// written to a temporary file and renamed, so a body is never read partially
+	tmp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint
+
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close() //nolint
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return body, err
+}
+
+func (s *fileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *fileStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+
+		if entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if !info.ModTime().Before(before) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(s.dir, entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (s *fileStore) path(key string) (string, error) {
+	if len(key) == 0 || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, key), nil
+}
@@ -0,0 +1,118 @@
+// Package inbox implements the idempotent consumer:
+// the ids of the processed messages are recorded and the redelivered messages are skipped.
+package inbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kingstonduy/go-core/dispatcher"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	MetricKeyDuplicateTotal = []string{"inbox", "duplicate", "total"}
+
+	MetricLabelConsumer = "consumer"
+)
+
+// Store records the ids of the processed messages
+type Store interface {
+	// Process calls fn unless the id was already recorded for the consumer, and records the id.
+	// It reports whether the message was a duplicate.
+	// The id is not recorded when fn fails, so that the message can be processed again.
+	Process(ctx context.Context, consumer string, id string, fn func(ctx context.Context) error) (duplicate bool, err error)
+}
+
+// Inbox deduplicates the messages of broker handlers and dispatchers
+type Inbox struct {
+	store Store
+	opts  Options
+}
+
+func New(store Store, opts ...Option) *Inbox {
+	return &Inbox{
+		store: store,
+		opts:  NewOptions(opts...),
+	}
+}
+
+// Handler wraps the broker handler, the duplicated events are acked without calling h,
+// by the handler with WithAutoAck(false)
+func (i *Inbox) Handler(h broker.Handler) broker.Handler {
+	return func(ctx context.Context, e broker.Event) error {
+		id, err := i.opts.MessageID(e)
+		if err != nil {
+			return fmt.Errorf("failed to read inbox message id: %w", err)
+		}
+
+		consumer := i.opts.Consumer
+		if len(consumer) == 0 {
+			consumer = e.Topic()
+		}
+
+		duplicate, err := i.process(ctx, consumer, id, func(ctx context.Context) error {
+			return h(ctx, e)
+		})
+		if duplicate && !i.opts.AutoAck {
+			return e.Ack()
+		}
+		return err
+	}
+}
+
+// SubscribeMiddleware deduplicates the events of every subscription of the broker,
+// see broker.WithSubscribeMiddleware
+func (i *Inbox) SubscribeMiddleware() broker.SubscribeMiddleware {
+	return i.Handler
+}
+
+// Dispatcher wraps the dispatcher, the duplicated commands are skipped by CommandID
+func (i *Inbox) Dispatcher(d dispatcher.DispatcherHandler) dispatcher.DispatcherHandler {
+	return &inboxDispatcher{
+		DispatcherHandler: d,
+		inbox:             i,
+	}
+}
+
+func (i *Inbox) process(ctx context.Context, consumer string, id string, fn func(ctx context.Context) error) (bool, error) {
+	if len(id) == 0 {
+		i.opts.getLogger().Warnf(ctx, "Message of consumer %s has no id, skip deduplication", consumer)
+		return false, fn(ctx)
+	}
+
+	duplicate, err := i.store.Process(ctx, consumer, id, fn)
+	if duplicate {
+		i.opts.getLogger().Infof(ctx, "Drop duplicated message %s of consumer %s", id, consumer)
+		i.opts.getMetrics().IncrCounterWithLabels(
+			MetricKeyDuplicateTotal,
+			1,
+			[]metrics.Label{
+				{
+					Name:  MetricLabelConsumer,
+					Value: consumer,
+				},
+			},
+		)
+	}
+	return duplicate, err
+}
+
+type inboxDispatcher struct {
+	dispatcher.DispatcherHandler
+	inbox *Inbox
+}
+
+func (d *inboxDispatcher) When(ctx context.Context, event transport.Command, br broker.Broker) error {
+	consumer := d.inbox.opts.Consumer
+	if len(consumer) == 0 {
+		consumer = DefaultConsumer
+	}
+
+	_, err := d.inbox.process(ctx, consumer, event.CommandID, func(ctx context.Context) error {
+		return d.DispatcherHandler.When(ctx, event, br)
+	})
+	return err
+}
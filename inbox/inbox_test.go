@@ -0,0 +1,345 @@
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/cache"
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/database/sqlx"
+	"github.com/kingstonduy/go-core/dispatcher"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/memory"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+const createTable = `CREATE TABLE INBOX (
+	CONSUMER     TEXT NOT NULL,
+	MESSAGE_ID   TEXT NOT NULL,
+	PROCESSED_AT BIGINT NOT NULL,
+	PRIMARY KEY (CONSUMER, MESSAGE_ID)
+)`
+
+func getConnection(t *testing.T) *database.Gdbc {
+	db, err := sqlx.NewSqlxGdbc("sqlite", filepath.Join(t.TempDir(), "inbox.db"), database.WithMaxOpen(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.TODO()) })
+
+	if _, err := db.Exec(context.TODO(), createTable); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func getMemoryBroker(t *testing.T, opts ...broker.BrokerOption) broker.Broker {
+	br := memory.NewBroker(opts...)
+	if err := br.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return br
+}
+
+func command(id string) *broker.Message {
+	return &broker.Message{Body: []byte(`{"COMMAND_ID":"` + id + `"}`)}
+}
+
+func TestSQLStoreDeduplicates(t *testing.T) {
+	db := getConnection(t)
+
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	m, err := metrics.New(&metrics.Config{FilterDefault: true}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ib := New(NewSQLStore(db, WithDialect(DialectSQLite)), WithMetrics(m))
+	br := getMemoryBroker(t)
+
+	var handled []string
+	errFailed := errors.New("failed")
+	failOnce := true
+	_, err = br.Subscribe("test.inbox", ib.Handler(func(ctx context.Context, e broker.Event) error {
+		id, _ := CommandID(e)
+		if id == "2" && failOnce {
+			failOnce = false
+			return errFailed
+		}
+		handled = append(handled, id)
+		return nil
+	}), broker.WithSubscribeAutoAck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "1", "2", "2", "1"} {
+		br.Publish(context.TODO(), "test.inbox", command(id)) //nolint
+	}
+
+	// the failed message is processed again on redelivery
+	assert.Equal(t, []string{"1", "2"}, handled)
+
+	var counters []string
+	for _, interval := range sink.Data() {
+		for key, c := range interval.Counters {
+			counters = append(counters, key)
+			assert.Equal(t, 2, c.Count)
+		}
+	}
+	assert.Contains(t, counters, "inbox.duplicate.total;consumer=test.inbox")
+}
+
+func TestSQLStoreWithinTransaction(t *testing.T) {
+	db := getConnection(t)
+	store := NewSQLStore(db, WithDialect(DialectSQLite))
+
+	errRollback := errors.New("rollback")
+	err := db.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		duplicate, err := store.Process(ctx, "consumer", "1", func(ctx context.Context) error { return nil })
+		assert.False(t, duplicate)
+		assert.NoError(t, err)
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	// the id was rolled back with the transaction
+	duplicate, err := store.Process(context.TODO(), "consumer", "1", func(ctx context.Context) error { return nil })
+	assert.False(t, duplicate)
+	assert.NoError(t, err)
+
+	duplicate, err = store.Process(context.TODO(), "consumer", "1", func(ctx context.Context) error { return nil })
+	assert.True(t, duplicate)
+	assert.NoError(t, err)
+
+	// the ids are scoped by consumer
+	duplicate, err = store.Process(context.TODO(), "other", "1", func(ctx context.Context) error { return nil })
+	assert.False(t, duplicate)
+	assert.NoError(t, err)
+
+	n, err := store.Purge(context.TODO(), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestCacheStoreDeduplicates(t *testing.T) {
+	store := NewCacheStore(newFakeCacheClient(), WithTTL(time.Minute))
+
+	errFailed := errors.New("failed")
+	duplicate, err := store.Process(context.TODO(), "consumer", "1", func(ctx context.Context) error { return errFailed })
+	assert.False(t, duplicate)
+	assert.ErrorIs(t, err, errFailed)
+
+	var calls int
+	for i := 0; i < 2; i++ {
+		store.Process(context.TODO(), "consumer", "1", func(ctx context.Context) error { //nolint
+			calls++
+			return nil
+		})
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestCacheStoreLease(t *testing.T) {
+	client := newFakeCacheClient()
+	store := NewCacheStore(client, WithTTL(time.Hour), WithLeaseTTL(time.Minute))
+
+	// the id is claimed for the lease while the handler runs
+	duplicate, err := store.Process(context.TODO(), "consumer", "1", func(ctx context.Context) error {
+		ttl, _ := client.TTL(ctx, "inbox:consumer:1")
+		assert.LessOrEqual(t, ttl, time.Minute)
+
+		// redelivered while the handler runs
+		duplicate, err := store.Process(ctx, "consumer", "1", func(ctx context.Context) error {
+			t.Fatal("processed twice")
+			return nil
+		})
+		assert.False(t, duplicate)
+		assert.ErrorIs(t, err, ErrProcessing)
+		return nil
+	})
+	assert.False(t, duplicate)
+	assert.NoError(t, err)
+
+	// the id is recorded for the TTL once the handler succeeded
+	ttl, _ := client.TTL(context.TODO(), "inbox:consumer:1")
+	assert.Greater(t, ttl, time.Minute)
+
+	duplicate, err = store.Process(context.TODO(), "consumer", "1", func(ctx context.Context) error { return nil })
+	assert.True(t, duplicate)
+	assert.NoError(t, err)
+}
+
+func TestHandlerAcksDuplicates(t *testing.T) {
+	ib := New(NewCacheStore(newFakeCacheClient()), WithAutoAck(false))
+	br := getMemoryBroker(t)
+
+	_, err := br.Subscribe("test.inbox", ib.Handler(func(ctx context.Context, e broker.Event) error {
+		return e.Ack()
+	}), broker.WithSubscribeAutoAck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "1"} {
+		br.Publish(context.TODO(), "test.inbox", command(id)) //nolint
+	}
+
+	assert.Equal(t, 0, br.(memory.Inspector).Unacked("test.inbox"))
+}
+
+func TestSubscribeMiddleware(t *testing.T) {
+	ib := New(NewCacheStore(newFakeCacheClient()), WithConsumer("orders"))
+	br := getMemoryBroker(t, broker.WithSubscribeMiddleware(ib.SubscribeMiddleware()))
+
+	var calls int
+	_, err := br.Subscribe("test.inbox", func(ctx context.Context, e broker.Event) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "1", ""} {
+		br.Publish(context.TODO(), "test.inbox", command(id)) //nolint
+	}
+
+	// the messages which are not commands are not deduplicated
+	for _, body := range []string{"plain text", "plain text", `["1"]`} {
+		br.Publish(context.TODO(), "test.inbox", &broker.Message{Body: []byte(body)}) //nolint
+	}
+
+	// the messages without id are not deduplicated
+	assert.Equal(t, 5, calls)
+}
+
+type recordDispatcher struct {
+	dispatcher.DispatcherHandler
+	commands []string
+}
+
+func (d *recordDispatcher) When(ctx context.Context, event transport.Command, br broker.Broker) error {
+	d.commands = append(d.commands, event.CommandID)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	d := &recordDispatcher{}
+	ib := New(NewCacheStore(newFakeCacheClient()))
+	wrapped := ib.Dispatcher(d)
+
+	for _, id := range []string{"1", "2", "1"} {
+		assert.NoError(t, wrapped.When(context.TODO(), transport.Command{CommandID: id}, nil))
+	}
+	assert.Equal(t, []string{"1", "2"}, d.commands)
+}
+
+type fakeCacheItem struct {
+	value []byte
+	until time.Time
+}
+
+// fakeCacheClient implements the cache.CacheClient methods used by the cache store
+type fakeCacheClient struct {
+	mu   sync.Mutex
+	keys map[string]fakeCacheItem
+}
+
+func newFakeCacheClient() *fakeCacheClient {
+	return &fakeCacheClient{keys: make(map[string]fakeCacheItem)}
+}
+
+func (f *fakeCacheClient) get(key string) (fakeCacheItem, bool) {
+	item, ok := f.keys[key]
+	if ok && time.Now().After(item.until) {
+		delete(f.keys, key)
+		return item, false
+	}
+	return item, ok
+}
+
+func (f *fakeCacheClient) set(key string, value interface{}, expiration time.Duration) {
+	b, _ := json.Marshal(value)
+	f.keys[key] = fakeCacheItem{value: b, until: time.Now().Add(expiration)}
+}
+
+func (f *fakeCacheClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.get(key); ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	f.set(key, value, expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (f *fakeCacheClient) Del(ctx context.Context, keys ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, key := range keys {
+		delete(f.keys, key)
+	}
+	return nil
+}
+
+func (f *fakeCacheClient) Get(ctx context.Context, key string, dest interface{}) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item, ok := f.get(key)
+	if !ok {
+		return 0, cache.ErrKeyNotFound
+	}
+	return time.Until(item.until), json.Unmarshal(item.value, dest)
+}
+
+func (f *fakeCacheClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	item, ok := f.get(key)
+	if !ok {
+		return -2, nil
+	}
+	return time.Until(item.until), nil
+}
+
+func (f *fakeCacheClient) Expire(ctx context.Context, key string, expiration time.Duration) error {
+	return nil
+}
+
+func (f *fakeCacheClient) Set(ctx context.Context, key string, values interface{}, expiration time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(key, values, expiration)
+	return nil
+}
+
+func (f *fakeCacheClient) FlushAll(ctx context.Context) error {
+	return nil
+}
+
+func (f *fakeCacheClient) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return nil
+}
+
+func (f *fakeCacheClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeCacheClient) String() string {
+	return "fake"
+}
@@ -0,0 +1,214 @@
+package inbox
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	// consumer of the dispatcher and of the events without topic
+	DefaultConsumer = "default"
+)
+
+// MessageIDFunc returns the id used to deduplicate the event.
+// An empty id disables the deduplication of the event.
+type MessageIDFunc func(e broker.Event) (string, error)
+
+type Options struct {
+	// name of the consumer recording the ids, the topic of the event when empty
+	Consumer string
+
+	MessageID MessageIDFunc
+
+	// AutoAck is the broker.SubscribeOptions.AutoAck of the subscriptions, defaults to true.
+	// The duplicated events are acked by the handler when false.
+	AutoAck bool
+
+	Logger  logger.Logger
+	Metrics *metrics.Metrics
+}
+
+type Option func(*Options)
+
+// WithConsumer scopes the recorded ids, use a distinct consumer per handler of the same message
+func WithConsumer(name string) Option {
+	return func(o *Options) {
+		o.Consumer = name
+	}
+}
+
+func WithMessageID(fn MessageIDFunc) Option {
+	return func(o *Options) {
+		o.MessageID = fn
+	}
+}
+
+// WithAutoAck is set to false when the subscriptions use broker.WithSubscribeAutoAck(false)
+func WithAutoAck(autoAck bool) Option {
+	return func(o *Options) {
+		o.AutoAck = autoAck
+	}
+}
+
+func WithLogger(log logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = log
+	}
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		MessageID: CommandID,
+		AutoAck:   true,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// CommandID reads the COMMAND_ID of the transport.Command or cmd_pipeline.OutboxWithTrace in the message body.
+// The id of a body which is not a JSON object is empty, the message is not deduplicated.
+func CommandID(e broker.Event) (string, error) {
+	if e.Message() == nil {
+		return "", nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(e.Message().Body, &fields); err != nil {
+		return "", nil
+	}
+
+	var cmd struct {
+		CommandID string `json:"COMMAND_ID"`
+	}
+
+	if err := json.Unmarshal(e.Message().Body, &cmd); err != nil {
+		return "", err
+	}
+	return cmd.CommandID, nil
+}
+
+func (o Options) getLogger() logger.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return logger.DefaultLogger
+}
+
+func (o Options) getMetrics() *metrics.Metrics {
+	if o.Metrics != nil {
+		return o.Metrics
+	}
+	return metrics.Default()
+}
+
+// SQL store options
+
+// Dialect is the SQL dialect of the inbox table
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota
+	DialectSQLite
+)
+
+var (
+	DefaultTableName = "INBOX"
+)
+
+type SQLStoreOptions struct {
+	TableName string
+	Dialect   Dialect
+}
+
+type SQLStoreOption func(*SQLStoreOptions)
+
+func WithTableName(name string) SQLStoreOption {
+	return func(o *SQLStoreOptions) {
+		o.TableName = name
+	}
+}
+
+func WithDialect(d Dialect) SQLStoreOption {
+	return func(o *SQLStoreOptions) {
+		o.Dialect = d
+	}
+}
+
+func NewSQLStoreOptions(opts ...SQLStoreOption) SQLStoreOptions {
+	options := SQLStoreOptions{
+		TableName: DefaultTableName,
+		Dialect:   DialectPostgres,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// Cache store options
+
+var (
+	DefaultKeyPrefix = "inbox"
+	DefaultTTL       = 24 * time.Hour
+	DefaultLeaseTTL  = time.Minute
+)
+
+type CacheStoreOptions struct {
+	KeyPrefix string
+	// how long the ids are remembered
+	TTL time.Duration
+	// how long the id is claimed while the handler runs, longer than the handler
+	LeaseTTL time.Duration
+}
+
+type CacheStoreOption func(*CacheStoreOptions)
+
+func WithKeyPrefix(prefix string) CacheStoreOption {
+	return func(o *CacheStoreOptions) {
+		o.KeyPrefix = prefix
+	}
+}
+
+func WithTTL(ttl time.Duration) CacheStoreOption {
+	return func(o *CacheStoreOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithLeaseTTL sets how long the id is claimed while the handler runs.
+// The id is released when the consumer crashes before the end of the handler.
+func WithLeaseTTL(ttl time.Duration) CacheStoreOption {
+	return func(o *CacheStoreOptions) {
+		o.LeaseTTL = ttl
+	}
+}
+
+func NewCacheStoreOptions(opts ...CacheStoreOption) CacheStoreOptions {
+	options := CacheStoreOptions{
+		KeyPrefix: DefaultKeyPrefix,
+		TTL:       DefaultTTL,
+		LeaseTTL:  DefaultLeaseTTL,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
@@ -0,0 +1,70 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kingstonduy/go-core/cache"
+)
+
+var (
+	// ErrProcessing is returned when the id is claimed by a handler which did not return yet,
+	// the message is processed again on redelivery unless the handler succeeds
+	ErrProcessing = errors.New("message is being processed")
+)
+
+// values of the inbox keys
+const (
+	stateProcessing = "processing"
+	stateProcessed  = "processed"
+)
+
+type cacheStore struct {
+	client cache.CacheClient
+	opts   CacheStoreOptions
+}
+
+// NewCacheStore records the ids in the cache with a TTL.
+// The id is claimed with SETNX for LeaseTTL before calling the handler, and recorded for TTL once the handler succeeded.
+// It is deleted when the handler fails, the record is not transactional with the changes of the handler.
+func NewCacheStore(client cache.CacheClient, opts ...CacheStoreOption) Store {
+	return &cacheStore{
+		client: client,
+		opts:   NewCacheStoreOptions(opts...),
+	}
+}
+
+// Process implements Store.
+func (s *cacheStore) Process(ctx context.Context, consumer string, id string, fn func(ctx context.Context) error) (bool, error) {
+	key := fmt.Sprintf("%s:%s:%s", s.opts.KeyPrefix, consumer, id)
+
+	claimed, err := s.client.SetNX(ctx, key, stateProcessing, s.opts.LeaseTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim inbox key: %w", err)
+	}
+
+	if !claimed {
+		var state string
+		if _, err := s.client.Get(ctx, key, &state); err != nil && !errors.Is(err, cache.ErrKeyNotFound) {
+			return false, fmt.Errorf("failed to read inbox key: %w", err)
+		}
+		if state == stateProcessed {
+			return true, nil
+		}
+		// claimed by another handler, or released in the meantime
+		return false, fmt.Errorf("%w: %s", ErrProcessing, key)
+	}
+
+	if err := fn(ctx); err != nil {
+		if delErr := s.client.Del(ctx, key); delErr != nil {
+			return false, fmt.Errorf("%w, failed to release inbox key: %v", err, delErr)
+		}
+		return false, err
+	}
+
+	if err := s.client.Set(ctx, key, stateProcessed, s.opts.TTL); err != nil {
+		return false, fmt.Errorf("failed to record inbox key: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,98 @@
+package inbox
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kingstonduy/go-core/database"
+)
+
+// SQLStore is a Store backed by a SQL table
+type SQLStore interface {
+	Store
+	// Purge deletes the ids processed before the time, to bound the size of the table
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type sqlStore struct {
+	db   *database.Gdbc
+	opts SQLStoreOptions
+}
+
+// NewSQLStore records the ids in a SQL table, in the same transaction as the handler.
+// The handler runs within database.Gdbc.WithinTransaction (or the transaction of the context),
+// so the id is committed with the changes of the handler and rolled back with them.
+func NewSQLStore(db *database.Gdbc, opts ...SQLStoreOption) SQLStore {
+	return &sqlStore{
+		db:   db,
+		opts: NewSQLStoreOptions(opts...),
+	}
+}
+
+// Process implements Store.
+func (s *sqlStore) Process(ctx context.Context, consumer string, id string, fn func(ctx context.Context) error) (bool, error) {
+	var duplicate bool
+
+	process := func(ctx context.Context) error {
+		res, err := s.db.Exec(ctx, s.bind(fmt.Sprintf(
+			"INSERT INTO %s (CONSUMER, MESSAGE_ID, PROCESSED_AT) VALUES (?, ?, ?) ON CONFLICT (CONSUMER, MESSAGE_ID) DO NOTHING",
+			s.opts.TableName,
+		)), consumer, id, time.Now().UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to insert inbox row: %w", err)
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to insert inbox row: %w", err)
+		}
+
+		if inserted == 0 {
+			duplicate = true
+			return nil
+		}
+		return fn(ctx)
+	}
+
+	if database.ExtractTx(ctx) != nil {
+		return duplicate, process(ctx)
+	}
+	err := s.db.WithinTransaction(ctx, process)
+	return duplicate, err
+}
+
+// Purge implements SQLStore.
+func (s *sqlStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.Exec(ctx, s.bind(fmt.Sprintf(
+		"DELETE FROM %s WHERE PROCESSED_AT < ?",
+		s.opts.TableName,
+	)), before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge inbox rows: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// bind replaces the '?' placeholders by the placeholders of the dialect
+func (s *sqlStore) bind(query string) string {
+	if s.opts.Dialect != DialectPostgres {
+		return query
+	}
+
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
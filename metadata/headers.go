@@ -3,4 +3,22 @@ package metadata
 const (
 	HeaderMessageType = "messageType"
 	HeaderReplyTo     = "replyTo"
+
+	// retry topics & dead-letter queue
+	HeaderRetryAttempts      = "retryAttempts"
+	HeaderRetryOriginalTopic = "retryOriginalTopic"
+	HeaderRetryError         = "retryError"
+	HeaderRetryFirstFailedAt = "retryFirstFailedAt"
+	HeaderRetryLastFailedAt  = "retryLastFailedAt"
+	HeaderRetryDeliverAt     = "retryDeliverAt"
+
+	// claim-check of the oversized bodies
+	HeaderClaimCheck     = "claimCheck"
+	HeaderClaimCheckSize = "claimCheckSize"
+
+	// id of the scheduled message, to cancel its delivery
+	HeaderScheduledID = "scheduledId"
+
+	// content type of the body, it selects the codec of the typed subscriptions
+	HeaderContentType = "content-type"
 )
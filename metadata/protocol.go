@@ -5,4 +5,5 @@ const (
 	ProtocolKafka = "KAFKA"
 	ProtocolGRPC  = "GRPC"
 	ProtocolIBMMQ = "IBM-MQ"
+	ProtocolNATS  = "NATS"
 )
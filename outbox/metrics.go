@@ -0,0 +1,79 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/metrics"
+)
+
+var (
+	// age of the oldest unsent row, 0 when the outbox is drained
+	MetricKeyRelayLag = []string{"outbox", "relay", "lag", "milliseconds"}
+	// number of rows published by the relay
+	MetricKeyRelayPublished = []string{"outbox", "relay", "published", "total"}
+	// time between the insert of a row and its publication
+	MetricKeyRelayDelay = []string{"outbox", "relay", "delay", "milliseconds"}
+
+	MetricLabelTable  = "table"
+	MetricLabelTopic  = "topic"
+	MetricLabelStatus = "status"
+
+	MetricStatusSuccess = "success"
+	MetricStatusFailed  = "failed"
+)
+
+func (r *Relay) emitLag(oldest int64) {
+	var lag float32
+	if oldest > 0 {
+		lag = float32(time.Now().UnixMilli() - oldest)
+	}
+
+	r.opts.getMetrics().SetGaugeWithLabels(
+		MetricKeyRelayLag,
+		lag,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTable,
+				Value: r.opts.TableName,
+			},
+		},
+	)
+}
+
+func (r *Relay) emitPublished(row record, err error) {
+	status := MetricStatusSuccess
+	if err != nil {
+		status = MetricStatusFailed
+	}
+
+	m := r.opts.getMetrics()
+	m.IncrCounterWithLabels(
+		MetricKeyRelayPublished,
+		1,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: row.Topic,
+			},
+			{
+				Name:  MetricLabelStatus,
+				Value: status,
+			},
+		},
+	)
+
+	if err != nil {
+		return
+	}
+
+	m.AddSampleWithLabels(
+		MetricKeyRelayDelay,
+		float32(time.Now().UnixMilli()-row.CreatedAt),
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: row.Topic,
+			},
+		},
+	)
+}
@@ -0,0 +1,116 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+)
+
+// Dialect is the SQL dialect of the outbox table
+type Dialect int
+
+const (
+	// DialectPostgres claims the rows with SELECT ... FOR UPDATE SKIP LOCKED
+	DialectPostgres Dialect = iota
+	// DialectSQLite claims the rows with a lease column
+	DialectSQLite
+)
+
+var (
+	DefaultTableName     = "OUTBOX"
+	DefaultBatchSize     = 100
+	DefaultPollInterval  = time.Second
+	DefaultLeaseDuration = 30 * time.Second
+)
+
+type Options struct {
+	TableName string
+	Dialect   Dialect
+
+	// number of rows claimed per poll
+	BatchSize int
+
+	// interval between two polls when the outbox is drained
+	PollInterval time.Duration
+
+	// how long the rows stay claimed by a relay instance (lease mode)
+	LeaseDuration time.Duration
+
+	Logger  logger.Logger
+	Metrics *metrics.Metrics
+}
+
+type Option func(*Options)
+
+func WithTableName(name string) Option {
+	return func(o *Options) {
+		o.TableName = name
+	}
+}
+
+func WithDialect(d Dialect) Option {
+	return func(o *Options) {
+		o.Dialect = d
+	}
+}
+
+func WithBatchSize(size int) Option {
+	return func(o *Options) {
+		o.BatchSize = size
+	}
+}
+
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.PollInterval = d
+	}
+}
+
+func WithLeaseDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.LeaseDuration = d
+	}
+}
+
+func WithLogger(log logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = log
+	}
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		TableName:     DefaultTableName,
+		Dialect:       DialectPostgres,
+		BatchSize:     DefaultBatchSize,
+		PollInterval:  DefaultPollInterval,
+		LeaseDuration: DefaultLeaseDuration,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+func (o Options) getLogger() logger.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return logger.DefaultLogger
+}
+
+func (o Options) getMetrics() *metrics.Metrics {
+	if o.Metrics != nil {
+		return o.Metrics
+	}
+	return metrics.Default()
+}
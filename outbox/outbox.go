@@ -0,0 +1,102 @@
+// Package outbox implements the transactional outbox pattern:
+// the Writer inserts the outbox rows in the business transaction,
+// the Relay polls the rows and publishes them through a broker.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	cmd_pipeline "github.com/kingstonduy/go-core/comman-pipeline"
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/trace"
+)
+
+var (
+	ErrEmptyTopic     = errors.New("outbox topic is empty")
+	ErrEmptyCommandID = errors.New("outbox command id is empty")
+)
+
+// Writer inserts the outbox rows
+type Writer struct {
+	db   *database.Gdbc
+	opts Options
+}
+
+func NewWriter(db *database.Gdbc, opts ...Option) *Writer {
+	return &Writer{
+		db:   db,
+		opts: NewOptions(opts...),
+	}
+}
+
+// Write inserts the outbox row, to be published to the topic by the Relay.
+// Call it inside database.Gdbc.WithinTransaction so that the row is committed with the business data.
+// Without a transaction in the context, the row is inserted in its own transaction.
+// The traceparent of the context is stored when the row has none.
+func (w *Writer) Write(ctx context.Context, topic string, o cmd_pipeline.Outbox) error {
+	if len(topic) == 0 {
+		return ErrEmptyTopic
+	}
+
+	if len(o.CommandID) == 0 {
+		return ErrEmptyCommandID
+	}
+
+	if len(o.TraceParent) == 0 {
+		o.TraceParent = trace.ExtractTraceparent(ctx)
+	}
+
+	insert := func(ctx context.Context) error {
+		query := w.opts.bind(fmt.Sprintf(
+			"INSERT INTO %s (COMMAND_ID, TOPIC, AGGREGATE_ID, COMMAND_TYPE, PAYLOAD, TRACE, REPLY_TO, TRACE_PARENT, CREATED_AT) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			w.opts.TableName,
+		))
+
+		_, err := w.db.Exec(ctx, query,
+			o.CommandID,
+			topic,
+			o.AggregateID,
+			o.CommandType,
+			o.Payload,
+			o.Trace,
+			o.ReplyTo,
+			o.TraceParent,
+			time.Now().UnixMilli(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert outbox row: %w", err)
+		}
+		return nil
+	}
+
+	if database.ExtractTx(ctx) != nil {
+		return insert(ctx)
+	}
+	return w.db.WithinTransaction(ctx, insert)
+}
+
+// bind replaces the '?' placeholders by the placeholders of the dialect
+func (o Options) bind(query string) string {
+	if o.Dialect != DialectPostgres {
+		return query
+	}
+
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
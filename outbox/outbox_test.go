@@ -0,0 +1,205 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cmd_pipeline "github.com/kingstonduy/go-core/comman-pipeline"
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/database/sqlx"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/memory"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+const createTable = `CREATE TABLE OUTBOX (
+	COMMAND_ID   TEXT PRIMARY KEY,
+	TOPIC        TEXT NOT NULL,
+	AGGREGATE_ID TEXT,
+	COMMAND_TYPE TEXT NOT NULL,
+	PAYLOAD      TEXT NOT NULL,
+	TRACE        TEXT,
+	REPLY_TO     TEXT,
+	TRACE_PARENT TEXT,
+	CREATED_AT   BIGINT NOT NULL,
+	SENT_AT      BIGINT,
+	LEASE_OWNER  TEXT,
+	LEASE_UNTIL  BIGINT
+)`
+
+func getConnection(t *testing.T) *database.Gdbc {
+	db, err := sqlx.NewSqlxGdbc("sqlite", filepath.Join(t.TempDir(), "outbox.db"), database.WithMaxOpen(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.TODO()) })
+
+	if _, err := db.Exec(context.TODO(), createTable); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func getMemoryBroker(t *testing.T) broker.Broker {
+	br := memory.NewBroker()
+	if err := br.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return br
+}
+
+func newOutbox(id string) cmd_pipeline.Outbox {
+	return cmd_pipeline.Outbox{
+		AggregateID: "aggregate-" + id,
+		CommandID:   id,
+		CommandType: "CreateOrder",
+		Payload:     fmt.Sprintf(`{"id":"%s"}`, id),
+		Trace:       `{"frm":"test"}`,
+		ReplyTo:     "test.reply",
+		TraceParent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+}
+
+func TestWriteWithinTransaction(t *testing.T) {
+	db := getConnection(t)
+	writer := NewWriter(db, WithDialect(DialectSQLite))
+
+	errRollback := errors.New("rollback")
+	err := db.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		if err := writer.Write(ctx, "test.outbox", newOutbox("1")); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	err = db.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		return writer.Write(ctx, "test.outbox", newOutbox("2"))
+	})
+	assert.NoError(t, err)
+
+	var ids []string
+	err = db.Select(context.TODO(), &ids, "SELECT COMMAND_ID FROM OUTBOX")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+
+	assert.ErrorIs(t, writer.Write(context.TODO(), "", newOutbox("3")), ErrEmptyTopic)
+	assert.ErrorIs(t, writer.Write(context.TODO(), "test.outbox", cmd_pipeline.Outbox{}), ErrEmptyCommandID)
+}
+
+func TestRelayOnce(t *testing.T) {
+	db := getConnection(t)
+	br := getMemoryBroker(t)
+	writer := NewWriter(db, WithDialect(DialectSQLite))
+	relay := NewRelay(db, br, WithDialect(DialectSQLite), WithBatchSize(2))
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err := writer.Write(context.TODO(), "test.outbox", newOutbox(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := relay.RelayOnce(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = relay.RelayOnce(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = relay.RelayOnce(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	published := br.(memory.Inspector).Published("test.outbox")
+	if !assert.Len(t, published, 3) {
+		return
+	}
+
+	var cmd cmd_pipeline.OutboxWithTrace
+	assert.NoError(t, json.Unmarshal(published[0].Body, &cmd))
+	assert.Equal(t, "1", cmd.CommandID)
+	assert.Equal(t, "test", cmd.Trace.From)
+	assert.Equal(t, []byte("aggregate-1"), published[0].Key)
+	assert.Equal(t, "CreateOrder", published[0].Headers[metadata.HeaderMessageType])
+	assert.Equal(t, "test.reply", published[0].Headers[metadata.HeaderReplyTo])
+	assert.Equal(t, newOutbox("1").TraceParent, published[0].Headers[HeaderTraceParent])
+
+	var unsent int
+	err = db.Get(context.TODO(), &unsent, "SELECT COUNT(*) FROM OUTBOX WHERE SENT_AT IS NULL")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, unsent)
+}
+
+func TestRelayPublishFailure(t *testing.T) {
+	db := getConnection(t)
+	br := memory.NewBroker()
+	writer := NewWriter(db, WithDialect(DialectSQLite))
+	relay := NewRelay(db, br, WithDialect(DialectSQLite))
+
+	if err := writer.Write(context.TODO(), "test.outbox", newOutbox("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the broker is not connected, the row stays in the outbox
+	_, err := relay.RelayOnce(context.TODO())
+	assert.Error(t, err)
+
+	if err := br.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease was released, the row is published right away
+	n, err := relay.RelayOnce(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestRelayStartStop(t *testing.T) {
+	db := getConnection(t)
+	br := getMemoryBroker(t)
+	writer := NewWriter(db, WithDialect(DialectSQLite))
+	relay := NewRelay(db, br, WithDialect(DialectSQLite), WithPollInterval(10*time.Millisecond))
+
+	received := make(chan string, 1)
+	_, err := br.Subscribe("test.outbox", func(ctx context.Context, e broker.Event) error {
+		var cmd cmd_pipeline.OutboxWithTrace
+		if err := json.Unmarshal(e.Message().Body, &cmd); err != nil {
+			return err
+		}
+		received <- cmd.CommandID
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, relay.Start(context.TODO()))
+	assert.ErrorIs(t, relay.Start(context.TODO()), ErrRelayStarted)
+
+	if err := writer.Write(context.TODO(), "test.outbox", newOutbox("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case id := <-received:
+		assert.Equal(t, "1", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("outbox row not relayed")
+	}
+
+	assert.NoError(t, relay.Stop(context.TODO()))
+	assert.ErrorIs(t, relay.Stop(context.TODO()), ErrRelayNotStarted)
+}
+
+func TestBindPostgres(t *testing.T) {
+	opts := NewOptions()
+	assert.Equal(t, "UPDATE OUTBOX SET SENT_AT = $1 WHERE COMMAND_ID = $2", opts.bind("UPDATE OUTBOX SET SENT_AT = ? WHERE COMMAND_ID = ?"))
+}
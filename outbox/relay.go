@@ -0,0 +1,342 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	cmd_pipeline "github.com/kingstonduy/go-core/comman-pipeline"
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/trace"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	ErrRelayStarted    = errors.New("outbox relay already started")
+	ErrRelayNotStarted = errors.New("outbox relay not started")
+
+	// header of the traceparent of the outbox row
+	HeaderTraceParent = "traceparent"
+)
+
+// record is an outbox row waiting to be published
+type record struct {
+	CommandID   string
+	Topic       string
+	AggregateID string
+	CommandType string
+	Payload     string
+	Trace       string
+	ReplyTo     string
+	TraceParent string
+	CreatedAt   int64
+}
+
+// Relay polls the unsent outbox rows, publishes them through the broker and marks them sent.
+// Several relay instances can poll the same table:
+// with DialectPostgres the rows are claimed with SELECT ... FOR UPDATE SKIP LOCKED,
+// with DialectSQLite the rows are claimed by a lease which expires after LeaseDuration.
+type Relay struct {
+	db     *database.Gdbc
+	broker broker.Broker
+	opts   Options
+
+	// lease owner of this instance
+	owner string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewRelay(db *database.Gdbc, br broker.Broker, opts ...Option) *Relay {
+	return &Relay{
+		db:     db,
+		broker: br,
+		opts:   NewOptions(opts...),
+		owner:  uuid.New().String(),
+	}
+}
+
+// Start polls the outbox in background until Stop is called or the context is canceled
+func (r *Relay) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return ErrRelayStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go r.run(ctx, r.done)
+	return nil
+}
+
+// Stop stops the polling and waits for the in-flight batch
+func (r *Relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return ErrRelayNotStarted
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Relay) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.opts.getLogger().Errorf(ctx, "Failed to relay outbox %s: %v", r.opts.TableName, err)
+		}
+
+		// poll again right away while the batches are full
+		if err == nil && n >= r.opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+// RelayOnce publishes one batch of unsent rows and returns the number of published rows.
+// The rows published before a failure are marked sent, the others are retried on the next poll.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	var (
+		n   int
+		err error
+	)
+
+	switch r.opts.Dialect {
+	case DialectSQLite:
+		n, err = r.relayLease(ctx)
+	default:
+		n, err = r.relaySkipLocked(ctx)
+	}
+
+	if oldest, lagErr := r.oldest(ctx); lagErr == nil {
+		r.emitLag(oldest)
+	}
+
+	return n, err
+}
+
+func (r *Relay) relaySkipLocked(ctx context.Context) (int, error) {
+	var (
+		n          int
+		publishErr error
+	)
+
+	err := r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		rows, err := r.selectRows(ctx, fmt.Sprintf(
+			"SELECT %s FROM %s WHERE SENT_AT IS NULL ORDER BY CREATED_AT LIMIT ? FOR UPDATE SKIP LOCKED",
+			selectColumns, r.opts.TableName,
+		), r.opts.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if publishErr = r.publish(ctx, row); publishErr != nil {
+				// keep the rows already marked sent
+				return nil
+			}
+
+			_, err = r.db.Exec(ctx, r.opts.bind(fmt.Sprintf(
+				"UPDATE %s SET SENT_AT = ? WHERE COMMAND_ID = ?",
+				r.opts.TableName,
+			)), time.Now().UnixMilli(), row.CommandID)
+			if err != nil {
+				return fmt.Errorf("failed to mark outbox row sent: %w", err)
+			}
+			n++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, publishErr
+}
+
+func (r *Relay) relayLease(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	_, err := r.db.Exec(ctx, r.opts.bind(fmt.Sprintf(
+		"UPDATE %[1]s SET LEASE_OWNER = ?, LEASE_UNTIL = ? WHERE COMMAND_ID IN (SELECT COMMAND_ID FROM %[1]s WHERE SENT_AT IS NULL AND (LEASE_UNTIL IS NULL OR LEASE_UNTIL < ?) ORDER BY CREATED_AT LIMIT ?)",
+		r.opts.TableName,
+	)), r.owner, now.Add(r.opts.LeaseDuration).UnixMilli(), now.UnixMilli(), r.opts.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lease outbox rows: %w", err)
+	}
+
+	rows, err := r.selectRows(ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE SENT_AT IS NULL AND LEASE_OWNER = ? AND LEASE_UNTIL >= ? ORDER BY CREATED_AT",
+		selectColumns, r.opts.TableName,
+	), r.owner, now.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, row := range rows {
+		if err := r.publish(ctx, row); err != nil {
+			r.release(ctx)
+			return n, err
+		}
+
+		_, err = r.db.Exec(ctx, r.opts.bind(fmt.Sprintf(
+			"UPDATE %s SET SENT_AT = ?, LEASE_OWNER = NULL, LEASE_UNTIL = NULL WHERE COMMAND_ID = ? AND LEASE_OWNER = ?",
+			r.opts.TableName,
+		)), time.Now().UnixMilli(), row.CommandID, r.owner)
+		if err != nil {
+			r.release(ctx)
+			return n, fmt.Errorf("failed to mark outbox row sent: %w", err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// release gives back the leased rows so that they are retried on the next poll
+func (r *Relay) release(ctx context.Context) {
+	// the rows must be released even when the relay is stopping
+	ctx = context.WithoutCancel(ctx)
+
+	_, err := r.db.Exec(ctx, r.opts.bind(fmt.Sprintf(
+		"UPDATE %s SET LEASE_OWNER = NULL, LEASE_UNTIL = NULL WHERE SENT_AT IS NULL AND LEASE_OWNER = ?",
+		r.opts.TableName,
+	)), r.owner)
+	if err != nil {
+		r.opts.getLogger().Errorf(ctx, "Failed to release outbox rows: %v", err)
+	}
+}
+
+const selectColumns = "COMMAND_ID, TOPIC, AGGREGATE_ID, COMMAND_TYPE, PAYLOAD, TRACE, REPLY_TO, TRACE_PARENT, CREATED_AT"
+
+func (r *Relay) selectRows(ctx context.Context, query string, args ...interface{}) ([]record, error) {
+	rows, err := r.db.Query(ctx, r.opts.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select outbox rows: %w", err)
+	}
+	defer rows.Close()
+
+	var records []record
+	for rows.Next() {
+		var (
+			row                                           record
+			aggregateID, traceValue, replyTo, traceParent sql.NullString
+		)
+		err := rows.Scan(
+			&row.CommandID,
+			&row.Topic,
+			&aggregateID,
+			&row.CommandType,
+			&row.Payload,
+			&traceValue,
+			&replyTo,
+			&traceParent,
+			&row.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox row: %w", err)
+		}
+
+		row.AggregateID = aggregateID.String
+		row.Trace = traceValue.String
+		row.ReplyTo = replyTo.String
+		row.TraceParent = traceParent.String
+		records = append(records, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to select outbox rows: %w", err)
+	}
+	return records, nil
+}
+
+// oldest returns the creation time of the oldest unsent row, 0 when the outbox is drained
+func (r *Relay) oldest(ctx context.Context) (int64, error) {
+	var oldest sql.NullInt64
+	err := r.db.QueryRow(ctx, fmt.Sprintf(
+		"SELECT MIN(CREATED_AT) FROM %s WHERE SENT_AT IS NULL",
+		r.opts.TableName,
+	)).Scan(&oldest)
+	if err != nil {
+		return 0, err
+	}
+	return oldest.Int64, nil
+}
+
+// publish sends the row as an OutboxWithTrace message within the trace of the row
+func (r *Relay) publish(ctx context.Context, row record) (err error) {
+	defer func() {
+		r.emitPublished(row, err)
+	}()
+
+	outbox := cmd_pipeline.Outbox{
+		AggregateID: row.AggregateID,
+		CommandID:   row.CommandID,
+		CommandType: row.CommandType,
+		Payload:     row.Payload,
+		Trace:       row.Trace,
+		ReplyTo:     row.ReplyTo,
+		TraceParent: row.TraceParent,
+	}
+
+	body, err := json.Marshal(outbox.ToOutboxWithTrace())
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox row %s: %w", row.CommandID, err)
+	}
+
+	headers := map[string]string{
+		metadata.HeaderMessageType: row.CommandType,
+	}
+	if len(row.ReplyTo) > 0 {
+		headers[metadata.HeaderReplyTo] = row.ReplyTo
+	}
+	if len(row.TraceParent) > 0 {
+		headers[HeaderTraceParent] = row.TraceParent
+		ctx = trace.InjectTraceparent(ctx, row.TraceParent)
+	}
+
+	err = r.broker.Publish(ctx, row.Topic, &broker.Message{
+		Headers: headers,
+		Body:    body,
+		Key:     []byte(row.AggregateID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish outbox row %s: %w", row.CommandID, err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/metrics"
+)
+
+var (
+	// number of messages stored for a delayed delivery
+	MetricKeyScheduled = []string{"scheduler", "scheduled", "total"}
+	// number of due messages published by the scheduler
+	MetricKeyPublished = []string{"scheduler", "published", "total"}
+	// time between the delivery time of a message and its publication
+	MetricKeyDelay = []string{"scheduler", "delay", "milliseconds"}
+
+	MetricLabelTopic  = "topic"
+	MetricLabelStatus = "status"
+
+	MetricStatusSuccess = "success"
+	MetricStatusFailed  = "failed"
+)
+
+func (s *Scheduler) emitScheduled(topic string) {
+	s.opts.getMetrics().IncrCounterWithLabels(
+		MetricKeyScheduled,
+		1,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+		},
+	)
+}
+
+func (s *Scheduler) emitPublished(msg *Message, err error) {
+	status := MetricStatusSuccess
+	if err != nil {
+		status = MetricStatusFailed
+	}
+
+	m := s.opts.getMetrics()
+	m.IncrCounterWithLabels(
+		MetricKeyPublished,
+		1,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: msg.Topic,
+			},
+			{
+				Name:  MetricLabelStatus,
+				Value: status,
+			},
+		},
+	)
+
+	if err != nil {
+		return
+	}
+
+	m.AddSampleWithLabels(
+		MetricKeyDelay,
+		float32(time.Since(msg.DeliverAt).Milliseconds()),
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: msg.Topic,
+			},
+		},
+	)
+}
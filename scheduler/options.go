@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+)
+
+var (
+	DefaultBatchSize     = 100
+	DefaultPollInterval  = time.Second
+	DefaultLeaseDuration = 30 * time.Second
+)
+
+type Options struct {
+	// number of due messages claimed per poll
+	BatchSize int
+
+	// interval between two polls when no message is due
+	PollInterval time.Duration
+
+	// how long the claimed messages stay leased by a scheduler instance
+	LeaseDuration time.Duration
+
+	Logger  logger.Logger
+	Metrics *metrics.Metrics
+}
+
+type Option func(*Options)
+
+func WithBatchSize(size int) Option {
+	return func(o *Options) {
+		o.BatchSize = size
+	}
+}
+
+func WithPollInterval(d time.Duration) Option {
+	return func(o *Options) {
+		o.PollInterval = d
+	}
+}
+
+func WithLeaseDuration(d time.Duration) Option {
+	return func(o *Options) {
+		o.LeaseDuration = d
+	}
+}
+
+func WithLogger(log logger.Logger) Option {
+	return func(o *Options) {
+		o.Logger = log
+	}
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		BatchSize:     DefaultBatchSize,
+		PollInterval:  DefaultPollInterval,
+		LeaseDuration: DefaultLeaseDuration,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+func (o Options) getLogger() logger.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return logger.DefaultLogger
+}
+
+func (o Options) getMetrics() *metrics.Metrics {
+	if o.Metrics != nil {
+		return o.Metrics
+	}
+	return metrics.Default()
+}
+
+// SQL store options
+
+// Dialect is the SQL dialect of the scheduler table
+type Dialect int
+
+const (
+	DialectPostgres Dialect = iota
+	DialectSQLite
+)
+
+var (
+	DefaultTableName = "SCHEDULED_MESSAGE"
+)
+
+type SQLStoreOptions struct {
+	TableName string
+	Dialect   Dialect
+}
+
+type SQLStoreOption func(*SQLStoreOptions)
+
+func WithTableName(name string) SQLStoreOption {
+	return func(o *SQLStoreOptions) {
+		o.TableName = name
+	}
+}
+
+func WithDialect(d Dialect) SQLStoreOption {
+	return func(o *SQLStoreOptions) {
+		o.Dialect = d
+	}
+}
+
+func NewSQLStoreOptions(opts ...SQLStoreOption) SQLStoreOptions {
+	options := SQLStoreOptions{
+		TableName: DefaultTableName,
+		Dialect:   DialectPostgres,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// Cache store options
+
+var (
+	DefaultKeyPrefix = "scheduler"
+	// how long a message is kept after its delivery time when no scheduler publishes it
+	DefaultRetention = 7 * 24 * time.Hour
+)
+
+type CacheStoreOptions struct {
+	KeyPrefix string
+	Retention time.Duration
+}
+
+type CacheStoreOption func(*CacheStoreOptions)
+
+func WithKeyPrefix(prefix string) CacheStoreOption {
+	return func(o *CacheStoreOptions) {
+		o.KeyPrefix = prefix
+	}
+}
+
+func WithRetention(d time.Duration) CacheStoreOption {
+	return func(o *CacheStoreOptions) {
+		o.Retention = d
+	}
+}
+
+func NewCacheStoreOptions(opts ...CacheStoreOption) CacheStoreOptions {
+	options := CacheStoreOptions{
+		KeyPrefix: DefaultKeyPrefix,
+		Retention: DefaultRetention,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
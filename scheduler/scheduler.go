@@ -0,0 +1,253 @@
+// Package scheduler implements the delayed delivery of broker messages:
+// the messages published with broker.WithDeliverAt or broker.WithDelay are stored and published when due.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	ErrSchedulerStarted    = errors.New("scheduler already started")
+	ErrSchedulerNotStarted = errors.New("scheduler not started")
+
+	// ErrNotScheduled is returned by Cancel when the message is unknown, already published or being published
+	ErrNotScheduled = errors.New("message not scheduled")
+
+	// ErrUnsupportedCacheClient is returned by NewCacheStore when the client has no sorted sets or conditional deletes
+	ErrUnsupportedCacheClient = errors.New("cache client does not support the scheduler store")
+)
+
+// Message is a message waiting for its delivery
+type Message struct {
+	ID        string            `json:"id"`
+	Topic     string            `json:"topic"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Key       []byte            `json:"key,omitempty"`
+	Body      []byte            `json:"body"`
+	DeliverAt time.Time         `json:"deliverAt"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// Store persists the scheduled messages
+type Store interface {
+	// Save stores the message until its delivery
+	Save(ctx context.Context, msg *Message) error
+	// Claim leases to the owner up to limit messages due at now, oldest first.
+	// The leased messages are not claimed by the other owners until the lease expires.
+	Claim(ctx context.Context, owner string, now time.Time, limit int, lease time.Duration) ([]*Message, error)
+	// Delete removes the message published by the owner of its lease
+	Delete(ctx context.Context, owner string, id string) error
+	// Release gives back the messages leased by the owner
+	Release(ctx context.Context, owner string) error
+	// Cancel removes the message unless it is leased, and reports whether it was removed
+	Cancel(ctx context.Context, id string) (bool, error)
+}
+
+// Scheduler stores the delayed messages and publishes them when due.
+// Several scheduler instances can share the same store, a message is claimed by one of them at a time.
+// The delivery is at-least-once: a message published but not deleted from the store is published again.
+type Scheduler struct {
+	store Store
+	opts  Options
+
+	// lease owner of this instance
+	owner string
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func New(store Store, opts ...Option) *Scheduler {
+	return &Scheduler{
+		store: store,
+		opts:  NewOptions(opts...),
+		owner: uuid.New().String(),
+	}
+}
+
+// PublishMiddleware stores the messages published with a delivery time in the future,
+// the other messages are published right away. See broker.WithPublishMiddleware.
+// The id of the scheduled message is the scheduledId header, set on the message when missing.
+func (s *Scheduler) PublishMiddleware() broker.PublishMiddleware {
+	return func(next broker.PublishFunc) broker.PublishFunc {
+		return func(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+			options := broker.NewPublishOptions(opts...)
+			if msg == nil || !options.DeliverAt.After(time.Now()) {
+				return next(ctx, topic, msg, opts...)
+			}
+
+			_, err := s.Schedule(ctx, topic, msg, options.DeliverAt)
+			return err
+		}
+	}
+}
+
+// Schedule stores the message to be published to the topic at deliverAt and returns its id.
+// The id is the scheduledId header of the message, a random id is set when missing.
+func (s *Scheduler) Schedule(ctx context.Context, topic string, msg *broker.Message, deliverAt time.Time) (string, error) {
+	if msg == nil {
+		return "", broker.EmptyMessageError{}
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+
+	id := msg.Headers[metadata.HeaderScheduledID]
+	if len(id) == 0 {
+		id = uuid.New().String()
+		msg.Headers[metadata.HeaderScheduledID] = id
+	}
+
+	err := s.store.Save(ctx, &Message{
+		ID:        id,
+		Topic:     topic,
+		Headers:   msg.Headers,
+		Key:       msg.Key,
+		Body:      msg.Body,
+		DeliverAt: deliverAt,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to schedule message %s: %w", id, err)
+	}
+
+	s.emitScheduled(topic)
+	return id, nil
+}
+
+// Cancel removes the scheduled message, ErrNotScheduled when it is unknown, already published or being published
+func (s *Scheduler) Cancel(ctx context.Context, id string) error {
+	canceled, err := s.store.Cancel(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to cancel message %s: %w", id, err)
+	}
+
+	if !canceled {
+		return ErrNotScheduled
+	}
+	return nil
+}
+
+// Start publishes the due messages through the broker in background until Stop is called or the context is canceled.
+// The messages stored before a restart are published by the next start.
+func (s *Scheduler) Start(ctx context.Context, br broker.Broker) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return ErrSchedulerStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go s.run(ctx, br, s.done)
+	return nil
+}
+
+// Stop stops the polling and waits for the in-flight batch
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel, s.done = nil, nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return ErrSchedulerNotStarted
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, br broker.Broker, done chan struct{}) {
+	defer close(done)
+
+	for {
+		n, err := s.RunOnce(ctx, br)
+		if err != nil && ctx.Err() == nil {
+			s.opts.getLogger().Errorf(ctx, "Failed to publish scheduled messages: %v", err)
+		}
+
+		// poll again right away while the batches are full
+		if err == nil && n >= s.opts.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.opts.PollInterval):
+		}
+	}
+}
+
+// RunOnce publishes one batch of due messages through the broker and returns the number of published messages.
+// The messages not published are released and retried on the next poll.
+func (s *Scheduler) RunOnce(ctx context.Context, br broker.Broker) (int, error) {
+	msgs, err := s.store.Claim(ctx, s.owner, time.Now(), s.opts.BatchSize, s.opts.LeaseDuration)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim scheduled messages: %w", err)
+	}
+
+	var n int
+	for _, msg := range msgs {
+		if err := s.publish(ctx, br, msg); err != nil {
+			s.release(ctx)
+			return n, err
+		}
+
+		if err := s.store.Delete(ctx, s.owner, msg.ID); err != nil {
+			s.release(ctx)
+			return n, fmt.Errorf("failed to delete scheduled message %s: %w", msg.ID, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// release gives back the leased messages so that they are retried on the next poll
+func (s *Scheduler) release(ctx context.Context) {
+	// the messages must be released even when the scheduler is stopping
+	ctx = context.WithoutCancel(ctx)
+
+	if err := s.store.Release(ctx, s.owner); err != nil {
+		s.opts.getLogger().Errorf(ctx, "Failed to release scheduled messages: %v", err)
+	}
+}
+
+func (s *Scheduler) publish(ctx context.Context, br broker.Broker, msg *Message) (err error) {
+	defer func() {
+		s.emitPublished(msg, err)
+	}()
+
+	err = br.Publish(ctx, msg.Topic, &broker.Message{
+		Headers: msg.Headers,
+		Key:     msg.Key,
+		Body:    msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish scheduled message %s: %w", msg.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kingstonduy/go-core/cache"
+	"github.com/kingstonduy/go-core/cache/credis"
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/database/sqlx"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+const createTable = `CREATE TABLE SCHEDULED_MESSAGE (
+	ID          TEXT PRIMARY KEY,
+	TOPIC       TEXT NOT NULL,
+	MESSAGE_KEY BLOB,
+	HEADERS     TEXT,
+	BODY        BLOB,
+	DELIVER_AT  BIGINT NOT NULL,
+	CREATED_AT  BIGINT NOT NULL,
+	LEASE_OWNER TEXT,
+	LEASE_UNTIL BIGINT
+)`
+
+func getSQLStore(t *testing.T) Store {
+	db, err := sqlx.NewSqlxGdbc("sqlite", filepath.Join(t.TempDir(), "scheduler.db"), database.WithMaxOpen(1))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close(context.TODO()) })
+
+	_, err = db.Exec(context.TODO(), createTable)
+	require.NoError(t, err)
+
+	return NewSQLStore(db, WithDialect(DialectSQLite))
+}
+
+func getCacheStore(t *testing.T) Store {
+	mr := miniredis.RunT(t)
+
+	client, err := credis.NewRedisClient(cache.WithAddress(mr.Addr()))
+	require.NoError(t, err)
+
+	store, err := NewCacheStore(client)
+	require.NoError(t, err)
+	return store
+}
+
+// forEachStore runs the test against every store
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	for name, getStore := range map[string]func(t *testing.T) Store{
+		"sql":   getSQLStore,
+		"cache": getCacheStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			test(t, getStore(t))
+		})
+	}
+}
+
+// getBroker returns a memory broker scheduling through s and the channel of the messages of the topic
+func getBroker(t *testing.T, s *Scheduler, topic string) (broker.Broker, <-chan *broker.Message) {
+	br := memory.NewBroker(broker.WithPublishMiddleware(s.PublishMiddleware()))
+	require.NoError(t, br.Connect())
+
+	received := make(chan *broker.Message, 10)
+	_, err := br.Subscribe(topic, func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	})
+	require.NoError(t, err)
+
+	return br, received
+}
+
+func TestDelayedDelivery(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.TODO()
+		s := New(store)
+		br, received := getBroker(t, s, "test.topic")
+
+		// a message without delivery time is published right away
+		require.NoError(t, br.Publish(ctx, "test.topic", &broker.Message{Body: []byte("now")}))
+		assert.Equal(t, []byte("now"), (<-received).Body)
+
+		msg := &broker.Message{
+			Headers: map[string]string{"foo": "bar"},
+			Key:     []byte("key"),
+			Body:    []byte("later"),
+		}
+		require.NoError(t, br.Publish(ctx, "test.topic", msg, broker.WithDelay(200*time.Millisecond)))
+		assert.NotEmpty(t, msg.Headers[metadata.HeaderScheduledID])
+
+		n, err := s.RunOnce(ctx, br)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.Empty(t, received)
+
+		time.Sleep(250 * time.Millisecond)
+
+		n, err = s.RunOnce(ctx, br)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		m := <-received
+		assert.Equal(t, []byte("later"), m.Body)
+		assert.Equal(t, []byte("key"), m.Key)
+		assert.Equal(t, "bar", m.Headers["foo"])
+		assert.Equal(t, msg.Headers[metadata.HeaderScheduledID], m.Headers[metadata.HeaderScheduledID])
+
+		// the published message is removed from the store
+		n, err = s.RunOnce(ctx, br)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+	})
+}
+
+func TestCancel(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.TODO()
+		s := New(store)
+		br, received := getBroker(t, s, "test.topic")
+
+		id, err := s.Schedule(ctx, "test.topic", &broker.Message{Body: []byte("canceled")}, time.Now().Add(50*time.Millisecond))
+		require.NoError(t, err)
+
+		require.NoError(t, s.Cancel(ctx, id))
+		assert.ErrorIs(t, s.Cancel(ctx, id), ErrNotScheduled)
+		assert.ErrorIs(t, s.Cancel(ctx, "unknown"), ErrNotScheduled)
+
+		time.Sleep(100 * time.Millisecond)
+
+		n, err := s.RunOnce(ctx, br)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.Empty(t, received)
+	})
+}
+
+func TestLease(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.TODO()
+		now := time.Now()
+
+		for _, id := range []string{"1", "2"} {
+			require.NoError(t, store.Save(ctx, &Message{
+				ID:        id,
+				Topic:     "test.topic",
+				Body:      []byte(id),
+				DeliverAt: now.Add(-time.Second),
+				CreatedAt: now,
+			}))
+		}
+
+		msgs, err := store.Claim(ctx, "owner-1", now, 1, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+
+		// the leased message is not claimed by another owner, nor canceled
+		others, err := store.Claim(ctx, "owner-2", now, 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, others, 1)
+		assert.NotEqual(t, msgs[0].ID, others[0].ID)
+
+		canceled, err := store.Cancel(ctx, msgs[0].ID)
+		require.NoError(t, err)
+		assert.False(t, canceled)
+
+		// the released message is claimed again
+		require.NoError(t, store.Release(ctx, "owner-1"))
+
+		again, err := store.Claim(ctx, "owner-3", now, 10, time.Minute)
+		require.NoError(t, err)
+		require.Len(t, again, 1)
+		assert.Equal(t, msgs[0].ID, again[0].ID)
+	})
+}
+
+func TestRestart(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.TODO()
+
+		// the message scheduled by a stopped instance is published by the next one
+		_, err := New(store).Schedule(ctx, "test.topic", &broker.Message{Body: []byte("restarted")}, time.Now().Add(50*time.Millisecond))
+		require.NoError(t, err)
+
+		s := New(store, WithPollInterval(10*time.Millisecond))
+		br, received := getBroker(t, s, "test.topic")
+
+		require.NoError(t, s.Start(ctx, br))
+		assert.ErrorIs(t, s.Start(ctx, br), ErrSchedulerStarted)
+
+		select {
+		case m := <-received:
+			assert.Equal(t, []byte("restarted"), m.Body)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message received")
+		}
+
+		require.NoError(t, s.Stop(ctx))
+		assert.ErrorIs(t, s.Stop(ctx), ErrSchedulerNotStarted)
+	})
+}
+
+func TestCacheStoreClaimByDeliveryTime(t *testing.T) {
+	store := getCacheStore(t)
+	ctx, now := context.TODO(), time.Now()
+
+	for i, id := range []string{"3", "1", "2", "4", "5"} {
+		deliverAt := now.Add(time.Duration(i-10) * time.Second)
+		if id == "3" {
+			deliverAt = now.Add(-time.Minute)
+		}
+		require.NoError(t, store.Save(ctx, &Message{ID: id, Topic: "test.topic", DeliverAt: deliverAt, CreatedAt: now}))
+	}
+	require.NoError(t, store.Save(ctx, &Message{ID: "later", Topic: "test.topic", DeliverAt: now.Add(time.Minute), CreatedAt: now}))
+
+	ids := func(msgs []*Message) []string {
+		var res []string
+		for _, m := range msgs {
+			res = append(res, m.ID)
+		}
+		return res
+	}
+
+	// the earliest due messages first, the leased ones are skipped
+	msgs, err := store.Claim(ctx, "owner-1", now, 2, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "1"}, ids(msgs))
+
+	msgs, err = store.Claim(ctx, "owner-2", now, 2, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "4"}, ids(msgs))
+
+	msgs, err = store.Claim(ctx, "owner-3", now, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5"}, ids(msgs))
+}
+
+func TestCacheStoreReleaseOwnLeases(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := credis.NewRedisClient(cache.WithAddress(mr.Addr()))
+	require.NoError(t, err)
+
+	store, err := NewCacheStore(client)
+	require.NoError(t, err)
+
+	ctx, now := context.TODO(), time.Now()
+	require.NoError(t, store.Save(ctx, &Message{ID: "1", Topic: "test.topic", DeliverAt: now.Add(-time.Second), CreatedAt: now}))
+
+	msgs, err := store.Claim(ctx, "owner-1", now, 10, time.Second)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	// the expired lease is taken by another owner
+	mr.FastForward(2 * time.Second)
+	msgs, err = store.Claim(ctx, "owner-2", now, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	// the first owner does not release the lease of the second one
+	require.NoError(t, store.Release(ctx, "owner-1"))
+	require.NoError(t, store.Delete(ctx, "owner-1", "1"))
+
+	msgs, err = store.Claim(ctx, "owner-3", now, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestCacheStoreUnsupportedClient(t *testing.T) {
+	_, err := NewCacheStore(cache.DefaultCacheClient)
+	assert.ErrorIs(t, err, ErrUnsupportedCacheClient)
+}
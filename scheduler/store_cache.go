@@ -0,0 +1,210 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/kingstonduy/go-core/cache"
+)
+
+// owner of the leases taken by Cancel
+const cancelOwner = "cancel"
+
+// indexCacheClient is the cache client of the store
+type indexCacheClient interface {
+	cache.CacheClient
+	cache.SortedSetCacheClient
+	cache.CompareAndDeleteCacheClient
+}
+
+type cacheStore struct {
+	client indexCacheClient
+	opts   CacheStoreOptions
+
+	// ids of the messages leased by the owners of this process
+	mu     sync.Mutex
+	leases map[string]map[string]struct{}
+}
+
+// NewCacheStore stores the messages in the cache.
+// A message is stored under its own key, expiring Retention after its delivery time,
+// and indexed by delivery time in a sorted set of pending messages, so that a poll reads the due messages only.
+// The messages are leased with SETNX, the leases are released by their owner only.
+// The client must implement cache.SortedSetCacheClient and cache.CompareAndDeleteCacheClient, e.g. credis.
+func NewCacheStore(client cache.CacheClient, opts ...CacheStoreOption) (Store, error) {
+	c, ok := client.(indexCacheClient)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCacheClient, client)
+	}
+
+	return &cacheStore{
+		client: c,
+		opts:   NewCacheStoreOptions(opts...),
+		leases: make(map[string]map[string]struct{}),
+	}, nil
+}
+
+// Save implements Store.
+func (s *cacheStore) Save(ctx context.Context, msg *Message) error {
+	if err := s.client.Set(ctx, s.messageKey(msg.ID), msg, time.Until(msg.DeliverAt)+s.opts.Retention); err != nil {
+		return fmt.Errorf("failed to store scheduled message: %w", err)
+	}
+
+	if err := s.client.ZAdd(ctx, s.pendingKey(), float64(msg.DeliverAt.UnixMilli()), msg.ID); err != nil {
+		return fmt.Errorf("failed to index scheduled message: %w", err)
+	}
+	return nil
+}
+
+// Claim implements Store.
+func (s *cacheStore) Claim(ctx context.Context, owner string, now time.Time, limit int, lease time.Duration) ([]*Message, error) {
+	var msgs []*Message
+
+	// the due messages by delivery time, a page at a time while the messages are leased by other owners
+	for offset := int64(0); len(msgs) < limit; offset += int64(limit) {
+		ids, err := s.client.ZRangeByScore(ctx, s.pendingKey(), math.Inf(-1), float64(now.UnixMilli()), offset, int64(limit))
+		if err != nil {
+			return msgs, fmt.Errorf("failed to read pending messages: %w", err)
+		}
+
+		for _, id := range ids {
+			if len(msgs) >= limit {
+				break
+			}
+
+			msg, err := s.claim(ctx, owner, id, lease)
+			if err != nil {
+				return msgs, err
+			}
+			if msg != nil {
+				msgs = append(msgs, msg)
+			}
+		}
+
+		if len(ids) < limit {
+			break
+		}
+	}
+
+	return msgs, nil
+}
+
+// claim leases the message, it returns nil when the message is leased by another owner or removed
+func (s *cacheStore) claim(ctx context.Context, owner string, id string, lease time.Duration) (*Message, error) {
+	claimed, err := s.client.SetNX(ctx, s.leaseKey(id), owner, lease).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease scheduled message: %w", err)
+	}
+	if !claimed {
+		return nil, nil
+	}
+
+	var msg Message
+	if _, err := s.client.Get(ctx, s.messageKey(id), &msg); err != nil {
+		if !errors.Is(err, cache.ErrKeyNotFound) {
+			return nil, fmt.Errorf("failed to read scheduled message: %w", err)
+		}
+
+		// canceled meanwhile or expired, drop it from the index
+		return nil, s.remove(ctx, id, owner)
+	}
+
+	s.mu.Lock()
+	if s.leases[owner] == nil {
+		s.leases[owner] = make(map[string]struct{})
+	}
+	s.leases[owner][id] = struct{}{}
+	s.mu.Unlock()
+
+	return &msg, nil
+}
+
+// Delete implements Store.
+func (s *cacheStore) Delete(ctx context.Context, owner string, id string) error {
+	s.mu.Lock()
+	_, ok := s.leases[owner][id]
+	delete(s.leases[owner], id)
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.remove(ctx, id, owner)
+}
+
+// Release implements Store.
+func (s *cacheStore) Release(ctx context.Context, owner string) error {
+	s.mu.Lock()
+	leased := s.leases[owner]
+	delete(s.leases, owner)
+	s.mu.Unlock()
+
+	// the expired leases may be owned by another owner meanwhile
+	for id := range leased {
+		if _, err := s.client.DelIfEqual(ctx, s.leaseKey(id), owner); err != nil {
+			return fmt.Errorf("failed to release scheduled message: %w", err)
+		}
+	}
+	return nil
+}
+
+// Cancel implements Store.
+// The message is leased while it is removed, so that it is not published meanwhile.
+func (s *cacheStore) Cancel(ctx context.Context, id string) (bool, error) {
+	claimed, err := s.client.SetNX(ctx, s.leaseKey(id), cancelOwner, time.Minute).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lease scheduled message: %w", err)
+	}
+	if !claimed {
+		return false, nil
+	}
+
+	var msg Message
+	if _, err := s.client.Get(ctx, s.messageKey(id), &msg); err != nil {
+		if _, delErr := s.client.DelIfEqual(ctx, s.leaseKey(id), cancelOwner); delErr != nil {
+			return false, delErr
+		}
+
+		if errors.Is(err, cache.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := s.remove(ctx, id, cancelOwner); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// remove deletes the message, its index member and the lease of the owner
+func (s *cacheStore) remove(ctx context.Context, id string, owner string) error {
+	if err := s.client.Del(ctx, s.messageKey(id)); err != nil {
+		return fmt.Errorf("failed to delete scheduled message: %w", err)
+	}
+
+	if err := s.client.ZRem(ctx, s.pendingKey(), id); err != nil {
+		return fmt.Errorf("failed to unindex scheduled message: %w", err)
+	}
+
+	if _, err := s.client.DelIfEqual(ctx, s.leaseKey(id), owner); err != nil {
+		return fmt.Errorf("failed to release scheduled message: %w", err)
+	}
+	return nil
+}
+
+func (s *cacheStore) pendingKey() string {
+	return s.opts.KeyPrefix + ":pending"
+}
+
+func (s *cacheStore) messageKey(id string) string {
+	return s.opts.KeyPrefix + ":message:" + id
+}
+
+func (s *cacheStore) leaseKey(id string) string {
+	return s.opts.KeyPrefix + ":lease:" + id
+}
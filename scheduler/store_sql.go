@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kingstonduy/go-core/database"
+)
+
+type sqlStore struct {
+	db   *database.Gdbc
+	opts SQLStoreOptions
+}
+
+// NewSQLStore stores the messages in a SQL table.
+// Save inserts the message in the transaction of the context when there is one,
+// so a message can be scheduled with the changes of a business transaction.
+func NewSQLStore(db *database.Gdbc, opts ...SQLStoreOption) Store {
+	return &sqlStore{
+		db:   db,
+		opts: NewSQLStoreOptions(opts...),
+	}
+}
+
+// Save implements Store.
+func (s *sqlStore) Save(ctx context.Context, msg *Message) error {
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	_, err = s.db.Exec(ctx, s.bind(fmt.Sprintf(
+		"INSERT INTO %s (ID, TOPIC, MESSAGE_KEY, HEADERS, BODY, DELIVER_AT, CREATED_AT) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		s.opts.TableName,
+	)), msg.ID, msg.Topic, msg.Key, string(headers), msg.Body, msg.DeliverAt.UnixMilli(), msg.CreatedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to insert scheduled message: %w", err)
+	}
+	return nil
+}
+
+// Claim implements Store.
+// The lease condition is checked again by the UPDATE, so that the rows leased meanwhile by a concurrent claim are skipped.
+func (s *sqlStore) Claim(ctx context.Context, owner string, now time.Time, limit int, lease time.Duration) ([]*Message, error) {
+	_, err := s.db.Exec(ctx, s.bind(fmt.Sprintf(
+		"UPDATE %[1]s SET LEASE_OWNER = ?, LEASE_UNTIL = ? WHERE ID IN (SELECT ID FROM %[1]s WHERE DELIVER_AT <= ? AND (LEASE_UNTIL IS NULL OR LEASE_UNTIL < ?) ORDER BY DELIVER_AT LIMIT ?) AND (LEASE_UNTIL IS NULL OR LEASE_UNTIL < ?)",
+		s.opts.TableName,
+	)), owner, now.Add(lease).UnixMilli(), now.UnixMilli(), now.UnixMilli(), limit, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease scheduled messages: %w", err)
+	}
+
+	rows, err := s.db.Query(ctx, s.bind(fmt.Sprintf(
+		"SELECT ID, TOPIC, MESSAGE_KEY, HEADERS, BODY, DELIVER_AT, CREATED_AT FROM %s WHERE LEASE_OWNER = ? AND LEASE_UNTIL >= ? ORDER BY DELIVER_AT",
+		s.opts.TableName,
+	)), owner, now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to select scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []*Message
+	for rows.Next() {
+		var (
+			msg                  Message
+			headers              string
+			deliverAt, createdAt int64
+		)
+		if err := rows.Scan(&msg.ID, &msg.Topic, &msg.Key, &headers, &msg.Body, &deliverAt, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled message: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(headers), &msg.Headers); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal headers of scheduled message %s: %w", msg.ID, err)
+		}
+		msg.DeliverAt = time.UnixMilli(deliverAt)
+		msg.CreatedAt = time.UnixMilli(createdAt)
+		msgs = append(msgs, &msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to select scheduled messages: %w", err)
+	}
+	return msgs, nil
+}
+
+// Delete implements Store.
+func (s *sqlStore) Delete(ctx context.Context, owner string, id string) error {
+	_, err := s.db.Exec(ctx, s.bind(fmt.Sprintf(
+		"DELETE FROM %s WHERE ID = ? AND LEASE_OWNER = ?",
+		s.opts.TableName,
+	)), id, owner)
+	return err
+}
+
+// Release implements Store.
+func (s *sqlStore) Release(ctx context.Context, owner string) error {
+	_, err := s.db.Exec(ctx, s.bind(fmt.Sprintf(
+		"UPDATE %s SET LEASE_OWNER = NULL, LEASE_UNTIL = NULL WHERE LEASE_OWNER = ?",
+		s.opts.TableName,
+	)), owner)
+	return err
+}
+
+// Cancel implements Store.
+func (s *sqlStore) Cancel(ctx context.Context, id string) (bool, error) {
+	res, err := s.db.Exec(ctx, s.bind(fmt.Sprintf(
+		"DELETE FROM %s WHERE ID = ? AND (LEASE_UNTIL IS NULL OR LEASE_UNTIL < ?)",
+		s.opts.TableName,
+	)), id, time.Now().UnixMilli())
+	if err != nil {
+		return false, err
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// bind replaces the '?' placeholders by the placeholders of the dialect
+func (s *sqlStore) bind(query string) string {
+	if s.opts.Dialect != DialectPostgres {
+		return query
+	}
+
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
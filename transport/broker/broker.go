@@ -30,6 +30,10 @@ type Broker interface {
 // message and optional Ack method to acknowledge receipt of the message.
 type Handler func(context.Context, Event) error
 
+// BatchHandler is used to process the messages of a subscription by batch.
+// The batch is acked when the handler returns a nil error.
+type BatchHandler func(context.Context, []Event) error
+
 // Message is a message send/received from the broker.
 type Message struct {
 	Headers map[string]string
@@ -0,0 +1,269 @@
+package cloudevents
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+// ToMessage converts the event to a broker message, in binary mode by default.
+// The partitionkey extension is the key of the message.
+func ToMessage(e Event, opts ...Option) (*broker.Message, error) {
+	options := NewOptions(opts...)
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	msg := &broker.Message{
+		Headers: make(map[string]string),
+	}
+
+	if key := e.Extension(ExtensionPartitionKey); len(key) > 0 {
+		msg.Key = []byte(key)
+	}
+
+	if options.Mode == ModeStructured {
+		body, err := marshalStructured(e)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Headers[HeaderContentType] = ContentTypeStructured
+		msg.Body = body
+		return msg, nil
+	}
+
+	for name, value := range attributes(e) {
+		msg.Headers[options.HeaderPrefix+name] = value
+	}
+	for name, value := range e.Extensions {
+		msg.Headers[options.HeaderPrefix+name] = value
+	}
+	if len(e.DataContentType) > 0 {
+		msg.Headers[HeaderContentType] = e.DataContentType
+	}
+	msg.Body = e.Data
+
+	return msg, nil
+}
+
+// FromMessage converts a broker message in binary or structured mode to an event,
+// ErrNotCloudEvent when the message is neither.
+// The key of the message is the partitionkey extension when the event has none.
+func FromMessage(msg *broker.Message, opts ...Option) (Event, error) {
+	options := NewOptions(opts...)
+
+	if msg == nil {
+		return Event{}, broker.EmptyMessageError{}
+	}
+
+	var (
+		e           Event
+		err         error
+		contentType = header(msg.Headers, HeaderContentType)
+	)
+
+	switch {
+	case strings.HasPrefix(contentType, ContentTypeStructured):
+		e, err = unmarshalStructured(msg.Body)
+		if err != nil {
+			return Event{}, err
+		}
+	case len(msg.Headers[options.HeaderPrefix+"specversion"]) > 0:
+		e, err = fromHeaders(msg.Headers, options.HeaderPrefix)
+		if err != nil {
+			return Event{}, err
+		}
+		e.DataContentType = contentType
+		e.Data = msg.Body
+	default:
+		return Event{}, ErrNotCloudEvent
+	}
+
+	if len(msg.Key) > 0 && len(e.Extension(ExtensionPartitionKey)) == 0 {
+		e.SetExtension(ExtensionPartitionKey, string(msg.Key))
+	}
+
+	return e, e.Validate()
+}
+
+// IsCloudEvent reports whether the message carries a cloud event in binary or structured mode
+func IsCloudEvent(msg *broker.Message, opts ...Option) bool {
+	options := NewOptions(opts...)
+
+	return msg != nil && (strings.HasPrefix(header(msg.Headers, HeaderContentType), ContentTypeStructured) ||
+		len(msg.Headers[options.HeaderPrefix+"specversion"]) > 0)
+}
+
+// attributes returns the context attributes of the event except datacontenttype, as strings
+func attributes(e Event) map[string]string {
+	attrs := map[string]string{
+		"id":          e.ID,
+		"source":      e.Source,
+		"specversion": e.SpecVersion,
+		"type":        e.Type,
+	}
+
+	if len(e.DataSchema) > 0 {
+		attrs["dataschema"] = e.DataSchema
+	}
+	if len(e.Subject) > 0 {
+		attrs["subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		attrs["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	return attrs
+}
+
+// setAttribute sets the context attribute or the extension of the name
+func setAttribute(e *Event, name string, value string) error {
+	switch name {
+	case "id":
+		e.ID = value
+	case "source":
+		e.Source = value
+	case "specversion":
+		e.SpecVersion = value
+	case "type":
+		e.Type = value
+	case "datacontenttype":
+		e.DataContentType = value
+	case "dataschema":
+		e.DataSchema = value
+	case "subject":
+		e.Subject = value
+	case "time":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return fmt.Errorf("invalid cloud event time %s: %w", value, err)
+		}
+		e.Time = t
+	default:
+		e.SetExtension(name, value)
+	}
+	return nil
+}
+
+func fromHeaders(headers map[string]string, prefix string) (Event, error) {
+	var e Event
+	for key, value := range headers {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if err := setAttribute(&e, strings.ToLower(strings.TrimPrefix(key, prefix)), value); err != nil {
+			return Event{}, err
+		}
+	}
+	return e, nil
+}
+
+func marshalStructured(e Event) ([]byte, error) {
+	envelope := make(map[string]interface{}, len(e.Extensions)+8)
+	for name, value := range e.Extensions {
+		envelope[name] = value
+	}
+	for name, value := range attributes(e) {
+		envelope[name] = value
+	}
+	if len(e.DataContentType) > 0 {
+		envelope["datacontenttype"] = e.DataContentType
+	}
+
+	switch {
+	case len(e.Data) == 0:
+	case isJSON(e.DataContentType) && json.Valid(e.Data):
+		envelope["data"] = json.RawMessage(e.Data)
+	default:
+		envelope["data_base64"] = base64.StdEncoding.EncodeToString(e.Data)
+	}
+
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cloud event: %w", err)
+	}
+	return body, nil
+}
+
+func unmarshalStructured(body []byte) (Event, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return Event{}, fmt.Errorf("failed to unmarshal cloud event: %w", err)
+	}
+
+	var e Event
+	for name, raw := range envelope {
+		if name == "data" || name == "data_base64" {
+			continue
+		}
+
+		// the extensions may be numbers or booleans, kept as their JSON text
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+
+		if err := setAttribute(&e, name, value); err != nil {
+			return Event{}, err
+		}
+	}
+
+	if raw, ok := envelope["data_base64"]; ok {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return Event{}, fmt.Errorf("invalid cloud event data_base64: %w", err)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return Event{}, fmt.Errorf("invalid cloud event data_base64: %w", err)
+		}
+		e.Data = data
+	}
+
+	if raw, ok := envelope["data"]; ok {
+		e.Data = raw
+
+		// a text data is a JSON string in the envelope
+		var text string
+		if !isJSON(e.DataContentType) && json.Unmarshal(raw, &text) == nil {
+			e.Data = []byte(text)
+		}
+	}
+
+	return e, nil
+}
+
+// isJSON reports whether the data of the content type is JSON, the data without content type is JSON
+func isJSON(contentType string) bool {
+	if len(contentType) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == ContentTypeJSON || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// header returns the value of the header, the name is case insensitive
+func header(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return value
+	}
+
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+// Package cloudevents implements the CloudEvents 1.0 binding of broker.Message for the kafka and rabbitmq brokers:
+// in binary mode the attributes are carried by the ce_* headers and the data by the body,
+// in structured mode the body is the JSON envelope of the event.
+package cloudevents
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+)
+
+const (
+	SpecVersion = "1.0"
+
+	// content type of the structured mode
+	ContentTypeStructured = "application/cloudevents+json"
+	// content type of the data by default
+	ContentTypeJSON = "application/json"
+
+	// header of the content type of the data in binary mode, of the envelope in structured mode
+	HeaderContentType = metadata.HeaderContentType
+
+	// distributed tracing extension, the W3C traceparent of the event
+	ExtensionTraceParent = "traceparent"
+	// kafka partitioning extension, mapped to the message key
+	ExtensionPartitionKey = "partitionkey"
+)
+
+var (
+	ErrNotCloudEvent = errors.New("message is not a cloud event")
+
+	extensionNamePattern = regexp.MustCompile("^[a-z0-9]+$")
+
+	// names of the context attributes, which cannot be used by the extensions
+	contextAttributes = map[string]struct{}{
+		"id":              {},
+		"source":          {},
+		"specversion":     {},
+		"type":            {},
+		"datacontenttype": {},
+		"dataschema":      {},
+		"subject":         {},
+		"time":            {},
+		"data":            {},
+		"data_base64":     {},
+	}
+)
+
+// Event is a CloudEvents 1.0 event
+type Event struct {
+	// required attributes
+	ID          string
+	Source      string
+	SpecVersion string
+	Type        string
+
+	// optional attributes
+	DataContentType string
+	DataSchema      string
+	Subject         string
+	Time            time.Time
+
+	// extension attributes by name, lowercase alphanumeric
+	Extensions map[string]string
+
+	Data []byte
+}
+
+// NewEvent returns an event with a random id, the current time and JSON data
+func NewEvent(source string, eventType string, data []byte) Event {
+	return Event{
+		ID:              uuid.New().String(),
+		Source:          source,
+		SpecVersion:     SpecVersion,
+		Type:            eventType,
+		DataContentType: ContentTypeJSON,
+		Time:            time.Now(),
+		Data:            data,
+	}
+}
+
+// Validate checks the required attributes and the names of the extensions
+func (e Event) Validate() error {
+	var missing []string
+	if len(e.ID) == 0 {
+		missing = append(missing, "id")
+	}
+	if len(e.Source) == 0 {
+		missing = append(missing, "source")
+	}
+	if len(e.SpecVersion) == 0 {
+		missing = append(missing, "specversion")
+	}
+	if len(e.Type) == 0 {
+		missing = append(missing, "type")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing cloud event attributes: %s", strings.Join(missing, ", "))
+	}
+
+	if e.SpecVersion != SpecVersion {
+		return fmt.Errorf("unsupported cloud event specversion %s", e.SpecVersion)
+	}
+
+	for name := range e.Extensions {
+		if _, ok := contextAttributes[name]; ok || !extensionNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid cloud event extension name %s", name)
+		}
+	}
+	return nil
+}
+
+// Extension returns the value of the extension, empty when missing
+func (e Event) Extension(name string) string {
+	return e.Extensions[name]
+}
+
+// SetExtension sets the value of the extension, an empty value removes it
+func (e *Event) SetExtension(name string, value string) {
+	if len(value) == 0 {
+		delete(e.Extensions, name)
+		return
+	}
+
+	if e.Extensions == nil {
+		e.Extensions = make(map[string]string)
+	}
+	e.Extensions[name] = value
+}
@@ -0,0 +1,156 @@
+package cloudevents
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/transport"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func event() Event {
+	e := NewEvent("/orders", "order.created", []byte(`{"id":1}`))
+	e.Subject = "1"
+	e.Time = time.Date(2024, 5, 1, 10, 0, 0, 123, time.UTC)
+	e.SetExtension(ExtensionPartitionKey, "order-1")
+	e.SetTrace(transport.Trace{
+		From:     "order-service",
+		Cid:      "cid-1",
+		Cts:      1714557600000,
+		Username: "alice",
+	})
+	return e
+}
+
+func TestBinaryMode(t *testing.T) {
+	e := event()
+
+	msg, err := ToMessage(e)
+	require.NoError(t, err)
+
+	assert.Equal(t, e.ID, msg.Headers["ce_id"])
+	assert.Equal(t, "/orders", msg.Headers["ce_source"])
+	assert.Equal(t, "1.0", msg.Headers["ce_specversion"])
+	assert.Equal(t, "order.created", msg.Headers["ce_type"])
+	assert.Equal(t, "2024-05-01T10:00:00.000000123Z", msg.Headers["ce_time"])
+	assert.Equal(t, "cid-1", msg.Headers["ce_tracecid"])
+	assert.Equal(t, "application/json", msg.Headers[HeaderContentType])
+	assert.Equal(t, []byte("order-1"), msg.Key)
+	assert.Equal(t, []byte(`{"id":1}`), msg.Body)
+
+	// the other headers of the message are ignored
+	msg.Headers["correlationId"] = "correlation-1"
+
+	decoded, err := FromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, e, decoded)
+
+	tr, ok := decoded.Trace()
+	assert.True(t, ok)
+	assert.Equal(t, transport.Trace{From: "order-service", Cid: "cid-1", Cts: 1714557600000, Username: "alice"}, tr)
+}
+
+func TestStructuredMode(t *testing.T) {
+	e := event()
+
+	msg, err := ToMessage(e, WithMode(ModeStructured))
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeStructured, msg.Headers[HeaderContentType])
+	assert.Equal(t, []byte("order-1"), msg.Key)
+	assert.JSONEq(t, `{
+		"id": "`+e.ID+`",
+		"source": "/orders",
+		"specversion": "1.0",
+		"type": "order.created",
+		"subject": "1",
+		"time": "2024-05-01T10:00:00.000000123Z",
+		"datacontenttype": "application/json",
+		"partitionkey": "order-1",
+		"tracefrm": "order-service",
+		"tracecid": "cid-1",
+		"tracects": "1714557600000",
+		"traceusername": "alice",
+		"data": {"id": 1}
+	}`, string(msg.Body))
+
+	decoded, err := FromMessage(msg)
+	require.NoError(t, err)
+	assert.Equal(t, e, decoded)
+
+	// a binary data is base64 encoded, a text data is a JSON string
+	for _, contentType := range []string{"application/octet-stream", "text/plain"} {
+		e.DataContentType = contentType
+		e.Data = []byte("not json")
+
+		msg, err = ToMessage(e, WithMode(ModeStructured))
+		require.NoError(t, err)
+
+		decoded, err = FromMessage(msg)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("not json"), decoded.Data)
+	}
+
+	decoded, err = FromMessage(&broker.Message{
+		Headers: map[string]string{"Content-Type": ContentTypeStructured + "; charset=utf-8"},
+		Body:    []byte(`{"id":"1","source":"/s","specversion":"1.0","type":"t","datacontenttype":"text/plain","data":"hello","count":3}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("hello"), decoded.Data)
+	assert.Equal(t, "3", decoded.Extension("count"))
+}
+
+func TestNotCloudEvent(t *testing.T) {
+	msg := &broker.Message{Headers: map[string]string{"messageType": "order.created"}, Body: []byte("{}")}
+
+	assert.False(t, IsCloudEvent(msg))
+	_, err := FromMessage(msg)
+	assert.ErrorIs(t, err, ErrNotCloudEvent)
+
+	// the required attributes are checked
+	_, err = ToMessage(Event{ID: "1", SpecVersion: SpecVersion})
+	assert.EqualError(t, err, "missing cloud event attributes: source, type")
+
+	e := event()
+	e.SetExtension("Invalid_Name", "value")
+	_, err = ToMessage(e)
+	assert.Error(t, err)
+}
+
+func TestHeaderPrefix(t *testing.T) {
+	msg, err := ToMessage(event(), WithHeaderPrefix("cloudEvents:"))
+	require.NoError(t, err)
+	assert.Equal(t, "order.created", msg.Headers["cloudEvents:type"])
+	assert.False(t, IsCloudEvent(msg))
+	assert.True(t, IsCloudEvent(msg, WithHeaderPrefix("cloudEvents:")))
+
+	decoded, err := FromMessage(msg, WithHeaderPrefix("cloudEvents:"))
+	require.NoError(t, err)
+	assert.Equal(t, "order.created", decoded.Type)
+}
+
+func TestTraceParent(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	e := event()
+	e.SetExtension(ExtensionTraceParent, traceparent)
+
+	msg, err := ToMessage(e)
+	require.NoError(t, err)
+	assert.Equal(t, traceparent, msg.Headers["ce_traceparent"])
+
+	decoded, err := FromMessage(msg)
+	require.NoError(t, err)
+
+	// the context of the event carries the trace of the traceparent
+	carrier := make(propagation.MapCarrier)
+	propagation.TraceContext{}.Inject(decoded.Context(context.TODO()), carrier)
+	assert.Equal(t, traceparent, carrier.Get("traceparent"))
+
+	var other Event
+	other.SetTraceParent(decoded.Context(context.TODO()))
+	assert.Equal(t, traceparent, other.TraceParent())
+}
@@ -0,0 +1,53 @@
+package cloudevents
+
+// Mode is the content mode of the events in the messages
+type Mode int
+
+const (
+	// ModeBinary carries the attributes in the headers and the data in the body
+	ModeBinary Mode = iota
+	// ModeStructured carries the JSON envelope of the event in the body
+	ModeStructured
+)
+
+var (
+	// prefix of the attribute headers in binary mode, the prefix of the kafka binding
+	DefaultHeaderPrefix = "ce_"
+)
+
+type Options struct {
+	// mode of the messages written by ToMessage, FromMessage reads both modes
+	Mode Mode
+
+	// prefix of the attribute headers in binary mode
+	HeaderPrefix string
+}
+
+type Option func(*Options)
+
+func WithMode(mode Mode) Option {
+	return func(o *Options) {
+		o.Mode = mode
+	}
+}
+
+// WithHeaderPrefix sets the prefix of the attribute headers,
+// e.g. "cloudEvents:" for the consumers of the AMQP binding
+func WithHeaderPrefix(prefix string) Option {
+	return func(o *Options) {
+		o.HeaderPrefix = prefix
+	}
+}
+
+func NewOptions(opts ...Option) Options {
+	options := Options{
+		Mode:         ModeBinary,
+		HeaderPrefix: DefaultHeaderPrefix,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
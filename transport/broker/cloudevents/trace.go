@@ -0,0 +1,90 @@
+package cloudevents
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/kingstonduy/go-core/trace"
+	"github.com/kingstonduy/go-core/transport"
+)
+
+// extensions of the fields of transport.Trace
+const (
+	ExtensionTraceFrom     = "tracefrm"
+	ExtensionTraceTo       = "traceto"
+	ExtensionTraceCid      = "tracecid"
+	ExtensionTraceSid      = "tracesid"
+	ExtensionTraceCts      = "tracects"
+	ExtensionTraceSts      = "tracests"
+	ExtensionTraceDur      = "tracedur"
+	ExtensionTraceUsername = "traceusername"
+	ExtensionTraceClientId = "traceclientid"
+	ExtensionTraceReplyTo  = "tracereplyto"
+	ExtensionTraceTimeout  = "tracetimeout"
+)
+
+// SetTrace maps the fields of the trace to the trace* extensions, the empty fields are omitted
+func (e *Event) SetTrace(t transport.Trace) {
+	e.SetExtension(ExtensionTraceFrom, t.From)
+	e.SetExtension(ExtensionTraceTo, t.To)
+	e.SetExtension(ExtensionTraceCid, t.Cid)
+	e.SetExtension(ExtensionTraceSid, t.Sid)
+	e.SetExtension(ExtensionTraceCts, formatInt(t.Cts))
+	e.SetExtension(ExtensionTraceSts, formatInt(t.Sts))
+	e.SetExtension(ExtensionTraceDur, formatInt(t.Dur))
+	e.SetExtension(ExtensionTraceUsername, t.Username)
+	e.SetExtension(ExtensionTraceClientId, t.ClientId)
+	e.SetExtension(ExtensionTraceReplyTo, t.ReplyTo)
+	e.SetExtension(ExtensionTraceTimeout, formatInt(t.TransactionTimeout))
+}
+
+// Trace returns the trace of the trace* extensions, false when the event has no tracecid
+func (e Event) Trace() (transport.Trace, bool) {
+	if len(e.Extension(ExtensionTraceCid)) == 0 {
+		return transport.Trace{}, false
+	}
+
+	return transport.Trace{
+		From:               e.Extension(ExtensionTraceFrom),
+		To:                 e.Extension(ExtensionTraceTo),
+		Cid:                e.Extension(ExtensionTraceCid),
+		Sid:                e.Extension(ExtensionTraceSid),
+		Cts:                parseInt(e.Extension(ExtensionTraceCts)),
+		Sts:                parseInt(e.Extension(ExtensionTraceSts)),
+		Dur:                parseInt(e.Extension(ExtensionTraceDur)),
+		Username:           e.Extension(ExtensionTraceUsername),
+		ClientId:           e.Extension(ExtensionTraceClientId),
+		ReplyTo:            e.Extension(ExtensionTraceReplyTo),
+		TransactionTimeout: parseInt(e.Extension(ExtensionTraceTimeout)),
+	}, true
+}
+
+// SetTraceParent sets the traceparent extension to the traceparent of the span of the context
+func (e *Event) SetTraceParent(ctx context.Context) {
+	e.SetExtension(ExtensionTraceParent, trace.ExtractTraceparent(ctx))
+}
+
+// TraceParent returns the traceparent extension, empty when missing
+func (e Event) TraceParent() string {
+	return e.Extension(ExtensionTraceParent)
+}
+
+// Context returns the context within the trace of the traceparent extension, ctx when the event has none
+func (e Event) Context(ctx context.Context) context.Context {
+	if traceparent := e.TraceParent(); len(traceparent) > 0 {
+		return trace.InjectTraceparent(ctx, traceparent)
+	}
+	return ctx
+}
+
+func formatInt(i int64) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.FormatInt(i, 10)
+}
+
+func parseInt(s string) int64 {
+	i, _ := strconv.ParseInt(s, 10, 64)
+	return i
+}
@@ -0,0 +1,34 @@
+package broker
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultDrainTimeout bounds the drain of the brokers and the subscribers
+// which drain on Disconnect and Unsubscribe
+var DefaultDrainTimeout = 30 * time.Second
+
+// Drainer is implemented by the brokers and the subscribers which can finish their in-flight work before they close
+type Drainer interface {
+	// Drain stops receiving new messages, waits for the in-flight handlers and the pending publishes
+	// until the deadline of the context, then disconnects the broker or unsubscribes the subscriber.
+	// The broker or the subscriber is closed even when the deadline is exceeded, the error is returned.
+	Drain(ctx context.Context) error
+}
+
+// DrainBroker drains the broker when it implements Drainer, else disconnects it
+func DrainBroker(ctx context.Context, b Broker) error {
+	if d, ok := b.(Drainer); ok {
+		return d.Drain(ctx)
+	}
+	return b.Disconnect()
+}
+
+// DrainSubscriber drains the subscriber when it implements Drainer, else unsubscribes it
+func DrainSubscriber(ctx context.Context, s Subscriber) error {
+	if d, ok := s.(Drainer); ok {
+		return d.Drain(ctx)
+	}
+	return s.Unsubscribe()
+}
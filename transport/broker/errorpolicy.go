@@ -0,0 +1,174 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrSubscriptionStopped = errors.New("subscription stopped by its error policy")
+
+	// DefaultHealthInterval is the interval of the health checks of ErrorActionPause
+	DefaultHealthInterval = 5 * time.Second
+)
+
+// ErrorAction is what a subscription does with a message whose handler returned an error
+type ErrorAction int
+
+const (
+	// ErrorActionSkip passes the message to the error handler and handles the next one, the default
+	ErrorActionSkip ErrorAction = iota
+	// ErrorActionRetry calls the handler again in place with a backoff,
+	// the message is skipped once every retry failed
+	ErrorActionRetry
+	// ErrorActionPause pauses the partition of the message until the health check passes,
+	// then calls the handler again, until it succeeds
+	ErrorActionPause
+	// ErrorActionStop stops the subscription, the message is not acked and is redelivered to the next subscription
+	ErrorActionStop
+)
+
+func (a ErrorAction) String() string {
+	switch a {
+	case ErrorActionRetry:
+		return "retry"
+	case ErrorActionPause:
+		return "pause"
+	case ErrorActionStop:
+		return "stop"
+	default:
+		return "skip"
+	}
+}
+
+// ErrorPolicy is what a subscription does when its handler returns an error.
+// The zero value skips the message.
+//
+// The policy applies to the error of the handler: with WithSubscribeRetry,
+// only the messages which could not be forwarded to the next retry topic.
+type ErrorPolicy struct {
+	Action ErrorAction
+
+	// ErrorActionRetry: the number of retries
+	MaxRetries int
+
+	// ErrorActionRetry: the delay before the retry (starting at 1).
+	// Default: ExponentialBackoff(100ms, 30s)
+	Backoff func(attempt int) time.Duration
+
+	// ErrorActionPause: the partition resumes once it returns nil.
+	// The handler is called again on every interval when nil.
+	HealthCheck func(ctx context.Context) error
+
+	// ErrorActionPause: the interval of the health checks.
+	// Default: DefaultHealthInterval
+	HealthInterval time.Duration
+}
+
+// SkipOnError passes the failed messages to the error handler and handles the next ones
+func SkipOnError() ErrorPolicy {
+	return ErrorPolicy{Action: ErrorActionSkip}
+}
+
+// RetryOnError calls the handler of a failed message up to retries times, waiting the backoff before every retry.
+// The backoff is ExponentialBackoff(100ms, 30s) when nil.
+func RetryOnError(retries int, backoff func(attempt int) time.Duration) ErrorPolicy {
+	return ErrorPolicy{Action: ErrorActionRetry, MaxRetries: retries, Backoff: backoff}
+}
+
+// PauseOnError pauses the partition of a failed message until the health check passes.
+// The interval is DefaultHealthInterval when 0.
+func PauseOnError(healthCheck func(ctx context.Context) error, interval time.Duration) ErrorPolicy {
+	return ErrorPolicy{Action: ErrorActionPause, HealthCheck: healthCheck, HealthInterval: interval}
+}
+
+// StopOnError stops the subscription on the first failed message, see StoppableSubscriber
+func StopOnError() ErrorPolicy {
+	return ErrorPolicy{Action: ErrorActionStop}
+}
+
+// WithSubscribeErrorPolicy sets the error policy of the subscription.
+// The kafka broker applies it, the other brokers skip the failed messages or requeue them.
+func WithSubscribeErrorPolicy(policy ErrorPolicy) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.ErrorPolicy = policy
+	}
+}
+
+// ExponentialBackoff returns a backoff doubling from initial up to maxDelay
+func ExponentialBackoff(initial, maxDelay time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := initial
+		for i := 1; i < attempt && d < maxDelay; i++ {
+			d *= 2
+		}
+		if d > maxDelay {
+			return maxDelay
+		}
+		return d
+	}
+}
+
+func (p ErrorPolicy) backoff(attempt int) time.Duration {
+	if p.Backoff != nil {
+		return p.Backoff(attempt)
+	}
+	return ExponentialBackoff(100*time.Millisecond, 30*time.Second)(attempt)
+}
+
+func (p ErrorPolicy) healthInterval() time.Duration {
+	if p.HealthInterval > 0 {
+		return p.HealthInterval
+	}
+	return DefaultHealthInterval
+}
+
+// Retry calls handle again up to MaxRetries times until it succeeds, waiting the backoff before every call.
+// err is the error of the first call. It returns the error of the last call, or the error of the context when it is done first.
+func (p ErrorPolicy) Retry(ctx context.Context, err error, handle func() error) error {
+	for attempt := 1; attempt <= p.MaxRetries; attempt++ {
+		if wErr := wait(ctx, p.backoff(attempt)); wErr != nil {
+			return wErr
+		}
+		if err = handle(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// WaitHealthy waits until the health check passes, or for the interval when there is no health check.
+// It returns the error of the context when it is done first.
+func (p ErrorPolicy) WaitHealthy(ctx context.Context) error {
+	for {
+		if err := wait(ctx, p.healthInterval()); err != nil {
+			return err
+		}
+		if p.HealthCheck == nil || p.HealthCheck(ctx) == nil {
+			return nil
+		}
+	}
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StoppableSubscriber is implemented by the subscribers which stop on their own, see ErrorActionStop.
+// The stopped subscriber is still to be unsubscribed.
+type StoppableSubscriber interface {
+	// Done is closed once the subscription stopped, by its error policy or by Unsubscribe
+	Done() <-chan struct{}
+	// Err returns the error which stopped the subscription, ErrSubscriptionStopped wrapping the error of the handler.
+	// It is nil while the subscription runs and when it was unsubscribed.
+	Err() error
+}
@@ -0,0 +1,41 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := broker.ExponentialBackoff(100*time.Millisecond, time.Second)
+
+	assert.Equal(t, 100*time.Millisecond, backoff(1))
+	assert.Equal(t, 200*time.Millisecond, backoff(2))
+	assert.Equal(t, 800*time.Millisecond, backoff(4))
+	assert.Equal(t, time.Second, backoff(5))
+	assert.Equal(t, time.Second, backoff(100))
+}
+
+func TestErrorPolicyRetry(t *testing.T) {
+	failed := errors.New("failed")
+	policy := broker.RetryOnError(2, func(int) time.Duration { return time.Millisecond })
+
+	calls := 0
+	err := policy.Retry(context.Background(), failed, func() error {
+		calls++
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	assert.Equal(t, 2, calls)
+
+	// no retry
+	assert.ErrorIs(t, broker.SkipOnError().Retry(context.Background(), failed, func() error { return nil }), failed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, policy.Retry(ctx, failed, func() error { return nil }), context.Canceled)
+}
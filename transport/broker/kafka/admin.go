@@ -0,0 +1,233 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+)
+
+// TopicConfig describes a topic ensured by the TopicAdmin
+type TopicConfig struct {
+	Name string
+
+	// Number of partitions, DefaultTopicPartitions when 0.
+	// The partitions of an existing topic are increased to this number, never decreased.
+	Partitions int32
+
+	// Replication factor, DefaultTopicReplicationFactor when 0
+	ReplicationFactor int16
+
+	// Topic configs, applied when the topic is created.
+	// Example: map[string]string{"retention.ms": "604800000", "cleanup.policy": "compact"}
+	Configs map[string]string
+}
+
+// TopicAdmin is implemented by the kafka broker, it manages the topics with the sarama.ClusterAdmin
+type TopicAdmin interface {
+	// EnsureTopics creates the missing topics and increases the partitions of the existing ones
+	EnsureTopics(ctx context.Context, topics ...TopicConfig) error
+	// ListTopics returns the topics of the cluster by name
+	ListTopics(ctx context.Context) (map[string]sarama.TopicDetail, error)
+	// DescribeTopics returns the metadata of the topics
+	DescribeTopics(ctx context.Context, topics ...string) ([]*sarama.TopicMetadata, error)
+	// DeleteTopics deletes the topics, the unknown topics are ignored
+	DeleteTopics(ctx context.Context, topics ...string) error
+}
+
+// EnsureTopics implements TopicAdmin.
+func (k *kBroker) EnsureTopics(ctx context.Context, topics ...TopicConfig) error {
+	admin, err := k.getAdmin()
+	if err != nil {
+		return err
+	}
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("failed to list kafka topics: %w", err)
+	}
+
+	for _, topic := range topics {
+		topic = k.topicDefaults(topic)
+
+		if detail, ok := existing[topic.Name]; ok {
+			if detail.NumPartitions < topic.Partitions {
+				if err := admin.CreatePartitions(topic.Name, topic.Partitions, nil, false); err != nil {
+					return fmt.Errorf("failed to increase the partitions of kafka topic %s: %w", topic.Name, err)
+				}
+				k.log(ctx, logger.InfoLevel, "Increased the partitions of topic %s to %d", topic.Name, topic.Partitions)
+			}
+			k.ensuredTopics.Store(topic.Name, true)
+			continue
+		}
+
+		var configs map[string]*string
+		if len(topic.Configs) > 0 {
+			configs = make(map[string]*string, len(topic.Configs))
+			for name, value := range topic.Configs {
+				value := value
+				configs[name] = &value
+			}
+		}
+
+		err := admin.CreateTopic(topic.Name, &sarama.TopicDetail{
+			NumPartitions:     topic.Partitions,
+			ReplicationFactor: topic.ReplicationFactor,
+			ConfigEntries:     configs,
+		}, false)
+
+		// the topic may be created by another instance meanwhile
+		if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			return fmt.Errorf("failed to create kafka topic %s: %w", topic.Name, err)
+		}
+
+		if err == nil {
+			k.log(ctx, logger.InfoLevel, "Created topic %s. Partitions: %d. Replication factor: %d", topic.Name, topic.Partitions, topic.ReplicationFactor)
+		}
+		k.ensuredTopics.Store(topic.Name, true)
+	}
+
+	return nil
+}
+
+// ListTopics implements TopicAdmin.
+func (k *kBroker) ListTopics(ctx context.Context) (map[string]sarama.TopicDetail, error) {
+	admin, err := k.getAdmin()
+	if err != nil {
+		return nil, err
+	}
+	return admin.ListTopics()
+}
+
+// DescribeTopics implements TopicAdmin.
+func (k *kBroker) DescribeTopics(ctx context.Context, topics ...string) ([]*sarama.TopicMetadata, error) {
+	admin, err := k.getAdmin()
+	if err != nil {
+		return nil, err
+	}
+	return admin.DescribeTopics(topics)
+}
+
+// DeleteTopics implements TopicAdmin.
+func (k *kBroker) DeleteTopics(ctx context.Context, topics ...string) error {
+	admin, err := k.getAdmin()
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		k.ensuredTopics.Delete(topic)
+
+		err := admin.DeleteTopic(topic)
+		if err != nil && !errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			return fmt.Errorf("failed to delete kafka topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// ensureTopics ensures the topics with the defaults of AutoCreateTopics,
+// the topics already ensured by the broker are skipped
+func (k *kBroker) ensureTopics(ctx context.Context, topics ...string) error {
+	defaults, ok := k.getAutoCreateTopics()
+	if !ok {
+		return nil
+	}
+
+	var missing []TopicConfig
+	for _, topic := range topics {
+		if _, ok := k.ensuredTopics.Load(topic); ok {
+			continue
+		}
+
+		config := defaults
+		config.Name = topic
+		missing = append(missing, config)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return k.EnsureTopics(ctx, missing...)
+}
+
+// ensureSubscribeTopics ensures the topic of the subscription,
+// with its retry topics and dead-letter topic
+func (k *kBroker) ensureSubscribeTopics(ctx context.Context, topic string, opt broker.SubscribeOptions) error {
+	topics := []string{topic}
+	if opt.Retry != nil {
+		retryTopics, deadLetterTopic := opt.Retry.RetryTopics(topic)
+		topics = append(topics, retryTopics...)
+		topics = append(topics, deadLetterTopic)
+	}
+	return k.ensureTopics(ctx, topics...)
+}
+
+func (k *kBroker) topicDefaults(topic TopicConfig) TopicConfig {
+	if topic.Partitions <= 0 {
+		topic.Partitions = DefaultTopicPartitions
+	}
+	if topic.ReplicationFactor <= 0 {
+		topic.ReplicationFactor = DefaultTopicReplicationFactor
+	}
+	return topic
+}
+
+// getAdmin returns the cluster admin of the broker, created on the first call and closed by Disconnect
+func (k *kBroker) getAdmin() (sarama.ClusterAdmin, error) {
+	k.adminMutex.Lock()
+	defer k.adminMutex.Unlock()
+
+	if k.admin != nil {
+		return k.admin, nil
+	}
+
+	// the admin has its own client, closing the admin closes its client
+	config := *k.getProducerConfig(context.Background())
+	if !config.Version.IsAtLeast(sarama.V0_10_2_0) {
+		config.Version = sarama.V0_10_2_0
+	}
+
+	admin, err := sarama.NewClusterAdmin(k.addrs, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka cluster admin: %w", err)
+	}
+
+	k.admin = admin
+	return admin, nil
+}
+
+func (k *kBroker) closeAdmin() error {
+	k.adminMutex.Lock()
+	defer k.adminMutex.Unlock()
+
+	k.ensuredTopics.Range(func(topic, _ any) bool {
+		k.ensuredTopics.Delete(topic)
+		return true
+	})
+
+	if k.admin == nil {
+		return nil
+	}
+
+	err := k.admin.Close()
+	k.admin = nil
+	return err
+}
+
+// getTopics returns the topics ensured at Connect
+func (k *kBroker) getTopics() []TopicConfig {
+	if topics, ok := k.opts.Context.Value(topicsKey{}).([]TopicConfig); ok {
+		return topics
+	}
+	return nil
+}
+
+func (k *kBroker) getAutoCreateTopics() (TopicConfig, bool) {
+	defaults, ok := k.opts.Context.Value(autoCreateTopicsKey{}).(TopicConfig)
+	return defaults, ok
+}
@@ -0,0 +1,123 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClusterAdmin keeps the topics in memory
+type fakeClusterAdmin struct {
+	sarama.ClusterAdmin
+	topics     map[string]sarama.TopicDetail
+	listTopics int
+}
+
+func newFakeClusterAdmin() *fakeClusterAdmin {
+	return &fakeClusterAdmin{topics: map[string]sarama.TopicDetail{}}
+}
+
+func (a *fakeClusterAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	a.listTopics++
+	topics := make(map[string]sarama.TopicDetail, len(a.topics))
+	for name, detail := range a.topics {
+		topics[name] = detail
+	}
+	return topics, nil
+}
+
+func (a *fakeClusterAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	if _, ok := a.topics[topic]; ok {
+		return &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+	}
+	a.topics[topic] = *detail
+	return nil
+}
+
+func (a *fakeClusterAdmin) CreatePartitions(topic string, count int32, assignment [][]int32, validateOnly bool) error {
+	detail := a.topics[topic]
+	detail.NumPartitions = count
+	a.topics[topic] = detail
+	return nil
+}
+
+func (a *fakeClusterAdmin) DeleteTopic(topic string) error {
+	if _, ok := a.topics[topic]; !ok {
+		return sarama.ErrUnknownTopicOrPartition
+	}
+	delete(a.topics, topic)
+	return nil
+}
+
+func (a *fakeClusterAdmin) Close() error {
+	return nil
+}
+
+func TestEnsureTopics(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+	admin := newFakeClusterAdmin()
+	admin.topics["existing"] = sarama.TopicDetail{NumPartitions: 2, ReplicationFactor: 3}
+	k.admin = admin
+
+	err := k.EnsureTopics(context.TODO(),
+		TopicConfig{Name: "created", Partitions: 6, ReplicationFactor: 3, Configs: map[string]string{"retention.ms": "1000"}},
+		TopicConfig{Name: "existing", Partitions: 4},
+		TopicConfig{Name: "defaults"},
+	)
+	assert.NoError(t, err)
+
+	created := admin.topics["created"]
+	assert.Equal(t, int32(6), created.NumPartitions)
+	assert.Equal(t, int16(3), created.ReplicationFactor)
+	assert.Equal(t, "1000", *created.ConfigEntries["retention.ms"])
+
+	// the partitions of an existing topic are increased, its replication is kept
+	assert.Equal(t, int32(4), admin.topics["existing"].NumPartitions)
+	assert.Equal(t, int16(3), admin.topics["existing"].ReplicationFactor)
+
+	assert.Equal(t, DefaultTopicPartitions, admin.topics["defaults"].NumPartitions)
+	assert.Equal(t, DefaultTopicReplicationFactor, admin.topics["defaults"].ReplicationFactor)
+
+	// a topic created meanwhile is not an error
+	admin.topics["raced"] = sarama.TopicDetail{NumPartitions: 1}
+	assert.NoError(t, k.EnsureTopics(context.TODO(), TopicConfig{Name: "raced"}))
+
+	// the unknown topics are ignored
+	assert.NoError(t, k.DeleteTopics(context.TODO(), "created", "unknown"))
+	assert.NotContains(t, admin.topics, "created")
+}
+
+func TestAutoCreateTopics(t *testing.T) {
+	k := NewKafkaBroker(AutoCreateTopics(TopicConfig{Partitions: 3})).(*kBroker)
+	admin := newFakeClusterAdmin()
+	k.admin = admin
+
+	opt := broker.NewSubscribeOptions(broker.WithSubscribeRetry(broker.RetryPolicy{
+		Delays: []time.Duration{time.Second, time.Minute},
+	}))
+	assert.NoError(t, k.ensureSubscribeTopics(context.TODO(), "orders", opt))
+
+	for _, topic := range []string{"orders", "orders.retry.1", "orders.retry.2", "orders.dlq"} {
+		assert.Contains(t, admin.topics, topic)
+		assert.Equal(t, int32(3), admin.topics[topic].NumPartitions)
+	}
+
+	// the ensured topics are not checked again
+	listTopics := admin.listTopics
+	assert.NoError(t, k.ensureTopics(context.TODO(), "orders", "orders.dlq"))
+	assert.Equal(t, listTopics, admin.listTopics)
+}
+
+func TestAutoCreateTopicsDisabled(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+	admin := newFakeClusterAdmin()
+	k.admin = admin
+
+	assert.NoError(t, k.ensureTopics(context.TODO(), "orders"))
+	assert.Empty(t, admin.topics)
+	assert.Equal(t, 0, admin.listTopics)
+}
@@ -0,0 +1,243 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+	"github.com/dnwe/otelsarama"
+)
+
+var (
+	ErrBatchErrorPolicy = errors.New("kafka batch subscription only supports the skip error policy")
+)
+
+// BatchBroker is implemented by the kafka broker
+type BatchBroker interface {
+	// SubscribeBatch subscribes to the topic with a handler of batches.
+	// A batch is flushed when it holds BatchSize messages or when its first message waited BatchWait.
+	// The batches are made per partition, so the messages of a batch are ordered.
+	// A batch is acked or failed as a whole, see BatchSplitOnError to isolate the failing messages.
+	// The subscribe middlewares and the retry policy do not apply to the batch handlers,
+	// the error policy other than broker.SkipOnError is rejected with ErrBatchErrorPolicy.
+	SubscribeBatch(topic string, h broker.BatchHandler, opts ...broker.SubscribeOption) (broker.Subscriber, error)
+}
+
+// SubscribeBatch implements BatchBroker.
+func (k *kBroker) SubscribeBatch(topic string, h broker.BatchHandler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	start := time.Now()
+
+	opt := broker.NewSubscribeOptions(opts...)
+
+	if opt.ErrorPolicy.Action != broker.ErrorActionSkip {
+		return nil, fmt.Errorf("%w: %s", ErrBatchErrorPolicy, opt.ErrorPolicy.Action)
+	}
+
+	if err := k.ensureTopics(opt.Context, topic); err != nil {
+		return nil, err
+	}
+
+	exactlyOnce, _ := opt.Context.Value(exactlyOnceKey{}).(bool)
+	if exactlyOnce && !k.isTransactional() {
+		return nil, ErrNotTransactional
+	}
+
+	cg, err := k.getSaramaConsumerGroup(opt.Context, opt.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	csHandler := &consumerGroupHandler{
+		topic:   topic,
+		subopts: opt,
+		kopts:   k.opts,
+		cg:      cg,
+		ready:   make(chan bool),
+		codec:   k.codec,
+	}
+
+	if exactlyOnce {
+		csHandler.transactor = k
+	}
+
+	if err := k.setSeek(csHandler, opt); err != nil {
+		return nil, err
+	}
+	setRebalanceHooks(csHandler, opt)
+
+	batchHandler := newBatchConsumerGroupHandler(csHandler, h, opt)
+
+	// Wrap instrumentation
+	otelBatchHandler := otelsarama.WrapConsumerGroupHandler(batchHandler)
+
+	return k.consume(start, topic, opt, cg, csHandler, otelBatchHandler)
+}
+
+// batchConsumerGroupHandler is the implementation of sarama.ConsumerGroupHandler for the batch subscriptions
+type batchConsumerGroupHandler struct {
+	*consumerGroupHandler
+
+	batchHandler broker.BatchHandler
+	size         int
+	wait         time.Duration
+	splitOnError bool
+}
+
+func newBatchConsumerGroupHandler(csHandler *consumerGroupHandler, h broker.BatchHandler, opt broker.SubscribeOptions) *batchConsumerGroupHandler {
+	b := &batchConsumerGroupHandler{
+		consumerGroupHandler: csHandler,
+		batchHandler:         h,
+		size:                 DefaultBatchSize,
+		wait:                 DefaultBatchWait,
+	}
+
+	if size, ok := opt.Context.Value(batchSizeKey{}).(int); ok && size > 0 {
+		b.size = size
+	}
+	if wait, ok := opt.Context.Value(batchWaitKey{}).(time.Duration); ok && wait > 0 {
+		b.wait = wait
+	}
+	b.splitOnError, _ = opt.Context.Value(batchSplitOnErrorKey{}).(bool)
+
+	return b
+}
+
+func (h *batchConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var (
+		ctx     = context.Background()
+		batch   = make([]*publication, 0, h.size)
+		timeout <-chan time.Time
+	)
+
+	// a pending batch is counted as one in-flight message
+	flush := func() {
+		if len(batch) > 0 {
+			h.process(ctx, session, batch)
+			h.inflight.end()
+		}
+		batch = make([]*publication, 0, h.size)
+		timeout = nil
+	}
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				h.log(ctx, logger.InfoLevel, "[kafka consumer] message channel was closed")
+				flush()
+				return nil
+			}
+
+			if msg == nil {
+				continue
+			}
+
+			m, err := h.codec.Unmarshal(msg)
+			if err != nil {
+				h.log(ctx, logger.ErrorLevel, "[kafka consumer]: failed to unmarshal consumed message: %v", err)
+				continue
+			}
+
+			// drained, the message is redelivered by the next session
+			if len(batch) == 0 && !h.inflight.begin() {
+				<-session.Context().Done()
+				return nil
+			}
+
+			batch = append(batch, &publication{brokerMessage: m, topic: msg.Topic, kafkaMessage: msg, consumerGroup: h.cg, session: session, timestamp: msg.Timestamp})
+			if len(batch) == 1 {
+				timeout = time.After(h.wait)
+			}
+			if len(batch) >= h.size {
+				flush()
+			}
+		case <-timeout:
+			flush()
+		case <-h.inflight.done():
+			// drained, the pending batch is handled before the producer is flushed
+			flush()
+			<-session.Context().Done()
+			return nil
+		case <-session.Context().Done():
+			// the pending batch is redelivered by the next session
+			if len(batch) > 0 {
+				h.inflight.end()
+			}
+			return nil
+		}
+	}
+}
+
+// process handles the batch, and the halves of the failed batch with BatchSplitOnError
+func (h *batchConsumerGroupHandler) process(ctx context.Context, session sarama.ConsumerGroupSession, batch []*publication) {
+	err := h.handle(ctx, batch)
+	if err == nil {
+		// the offsets of the transactional handler are committed by the transaction
+		if h.subopts.AutoAck && h.transactor == nil {
+			for _, p := range batch {
+				session.MarkMessage(p.kafkaMessage, "")
+			}
+		}
+		return
+	}
+
+	if !h.splitOnError || len(batch) == 1 {
+		h.fail(ctx, batch, err)
+		return
+	}
+
+	half := len(batch) / 2
+	h.process(ctx, session, batch[:half])
+	h.process(ctx, session, batch[half:])
+}
+
+func (h *batchConsumerGroupHandler) handle(ctx context.Context, batch []*publication) (err error) {
+	events := make([]broker.Event, len(batch))
+	for i, p := range batch {
+		events[i] = p
+	}
+
+	// every message of the batch is handled in the duration of the batch
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		for _, p := range batch {
+			broker.EmitHandled(h.getMetrics(), p.topic, err, duration)
+		}
+	}()
+
+	if h.transactor == nil {
+		return h.batchHandler(ctx, events)
+	}
+
+	return h.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := h.batchHandler(ctx, events); err != nil {
+			return err
+		}
+
+		for _, p := range batch {
+			if err := addMessageToTxn(ctx, p.kafkaMessage, h.subopts.Group); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (h *batchConsumerGroupHandler) fail(ctx context.Context, batch []*publication, err error) {
+	errHandler := h.kopts.ErrorHandler
+	if errHandler == nil {
+		h.log(ctx, logger.ErrorLevel, "[kafka] batch subscriber error: %v. Messages: %d", err, len(batch))
+		return
+	}
+
+	for _, p := range batch {
+		p.err = err
+		errHandler(ctx, p) //nolint
+	}
+}
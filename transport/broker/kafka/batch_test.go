@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSession records the marked offsets of a claim
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked []int64
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{ctx: context.Background()}
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeSession) Marked() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64{}, s.marked...)
+}
+
+// fakeClaim delivers the messages of its channel
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func newFakeClaim(n int) *fakeClaim {
+	return &fakeClaim{messages: make(chan *sarama.ConsumerMessage, n)}
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func (c *fakeClaim) send(offset int64, key string, body string) {
+	c.messages <- &sarama.ConsumerMessage{
+		Topic:  "test.batch",
+		Offset: offset,
+		Key:    []byte(key),
+		Value:  []byte(body),
+	}
+}
+
+func newTestBatchHandler(h broker.BatchHandler, opts ...broker.SubscribeOption) *batchConsumerGroupHandler {
+	opt := broker.NewSubscribeOptions(opts...)
+	csHandler := &consumerGroupHandler{
+		subopts: opt,
+		kopts:   broker.NewBrokerOptions(),
+		ready:   make(chan bool),
+		codec:   DefaultMarshaler{},
+	}
+	return newBatchConsumerGroupHandler(csHandler, h, opt)
+}
+
+func bodies(events []broker.Event) []string {
+	var res []string
+	for _, e := range events {
+		res = append(res, string(e.Message().Body))
+	}
+	return res
+}
+
+func TestBatchFlushBySize(t *testing.T) {
+	var batches [][]string
+	h := newTestBatchHandler(func(ctx context.Context, events []broker.Event) error {
+		batches = append(batches, bodies(events))
+		return nil
+	}, BatchSize(2), BatchWait(time.Hour))
+
+	session, claim := newFakeSession(), newFakeClaim(5)
+	for i, body := range []string{"1", "2", "3", "4", "5"} {
+		claim.send(int64(i), "", body)
+	}
+	close(claim.messages)
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+
+	// the last incomplete batch is flushed when the claim ends
+	assert.Equal(t, [][]string{{"1", "2"}, {"3", "4"}, {"5"}}, batches)
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, session.Marked())
+}
+
+func TestBatchFlushByWait(t *testing.T) {
+	flushed := make(chan []string, 1)
+	h := newTestBatchHandler(func(ctx context.Context, events []broker.Event) error {
+		flushed <- bodies(events)
+		return nil
+	}, BatchSize(10), BatchWait(10*time.Millisecond))
+
+	session, claim := newFakeSession(), newFakeClaim(2)
+	claim.send(0, "", "1")
+	claim.send(1, "", "2")
+
+	go h.ConsumeClaim(session, claim) //nolint
+	defer close(claim.messages)
+
+	select {
+	case batch := <-flushed:
+		assert.Equal(t, []string{"1", "2"}, batch)
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch not flushed")
+	}
+}
+
+func TestBatchAllOrNothing(t *testing.T) {
+	h := newTestBatchHandler(func(ctx context.Context, events []broker.Event) error {
+		return errors.New("failed")
+	}, BatchSize(3))
+
+	session, claim := newFakeSession(), newFakeClaim(3)
+	for i, body := range []string{"1", "2", "3"} {
+		claim.send(int64(i), "", body)
+	}
+	close(claim.messages)
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Empty(t, session.Marked())
+}
+
+func TestBatchSplitOnError(t *testing.T) {
+	var failed []string
+	errPoison := errors.New("poison")
+
+	h := newTestBatchHandler(func(ctx context.Context, events []broker.Event) error {
+		for _, e := range events {
+			if string(e.Message().Body) == "3" {
+				return errPoison
+			}
+		}
+		return nil
+	}, BatchSize(4), BatchSplitOnError())
+	h.kopts.ErrorHandler = func(ctx context.Context, e broker.Event) error {
+		assert.ErrorIs(t, e.Error(), errPoison)
+		failed = append(failed, string(e.Message().Body))
+		return nil
+	}
+
+	session, claim := newFakeSession(), newFakeClaim(4)
+	for i, body := range []string{"1", "2", "3", "4"} {
+		claim.send(int64(i), "", body)
+	}
+	close(claim.messages)
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, []string{"3"}, failed)
+	assert.Equal(t, []int64{0, 1, 3}, session.Marked())
+}
+
+func TestBatchErrorPolicy(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+
+	_, err := k.SubscribeBatch("test.batch", func(ctx context.Context, events []broker.Event) error {
+		return nil
+	}, broker.WithSubscribeErrorPolicy(broker.StopOnError()))
+	assert.ErrorIs(t, err, ErrBatchErrorPolicy)
+}
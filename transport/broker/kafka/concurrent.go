@@ -0,0 +1,187 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+)
+
+var (
+	ErrConcurrentExactlyOnce = errors.New("kafka exactly-once subscription cannot be concurrent")
+)
+
+// KeyFunc returns the ordering key of the message
+type KeyFunc func(m *broker.Message) string
+
+// MessageKey returns the key of the message, or the AGGREGATE_ID of the transport.Command in the body
+func MessageKey(m *broker.Message) string {
+	if len(m.Key) > 0 {
+		return string(m.Key)
+	}
+
+	var cmd struct {
+		AggregateID string `json:"AGGREGATE_ID"`
+	}
+	json.Unmarshal(m.Body, &cmd) //nolint
+	return cmd.AggregateID
+}
+
+type work struct {
+	msg     *sarama.ConsumerMessage
+	m       *broker.Message
+	tracked *trackedMessage
+}
+
+// consumeConcurrently dispatches the messages of the claim to the workers by key
+func (h *consumerGroupHandler) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var (
+		tracker = newOffsetTracker(session)
+		workers = make([]chan work, h.concurrency)
+		wg      sync.WaitGroup
+	)
+
+	for i := range workers {
+		workers[i] = make(chan work, 1)
+
+		wg.Add(1)
+		go func(works <-chan work) {
+			defer wg.Done()
+			// the messages after an unhandled one are left unhandled too, they are redelivered in order
+			unhandled := false
+			for w := range works {
+				if !unhandled {
+					if unhandled = !h.handleMessage(session, w.msg, w.m, w.tracked.ack); !unhandled {
+						tracker.complete(w.tracked)
+					}
+				}
+				h.inflight.end()
+			}
+		}(workers[i])
+	}
+
+	// the workers finish the dispatched messages before the claim ends
+	defer func() {
+		for _, works := range workers {
+			close(works)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				h.log(context.Background(), logger.InfoLevel, "[kafka consumer] message channel was closed")
+				return nil
+			}
+
+			if msg == nil {
+				continue
+			}
+
+			// drained, the message is redelivered by the next session
+			if !h.inflight.begin() {
+				<-session.Context().Done()
+				return nil
+			}
+
+			tracked := tracker.add(msg)
+
+			m, ok := h.decode(msg)
+			if !ok {
+				tracker.complete(tracked)
+				h.inflight.end()
+				continue
+			}
+
+			select {
+			case workers[h.worker(m)] <- work{msg: msg, m: m, tracked: tracked}:
+			case <-session.Context().Done():
+				h.inflight.end()
+				return nil
+			}
+		case <-h.inflight.done():
+			// drained, the session ends once the producer is flushed
+			<-session.Context().Done()
+			return nil
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (h *consumerGroupHandler) worker(m *broker.Message) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(h.keyFunc(m))) //nolint
+	return int(hash.Sum32() % uint32(h.concurrency))
+}
+
+// offsetTracker marks the offsets of a claim in order:
+// an offset is marked once the messages before it are completed
+type offsetTracker struct {
+	mu      sync.Mutex
+	session sarama.ConsumerGroupSession
+
+	// the messages not completed yet, and the completed ones after them, in offset order
+	pending []*trackedMessage
+}
+
+type trackedMessage struct {
+	tracker *offsetTracker
+	msg     *sarama.ConsumerMessage
+	acked   bool
+	done    bool
+}
+
+func newOffsetTracker(session sarama.ConsumerGroupSession) *offsetTracker {
+	return &offsetTracker{
+		session: session,
+	}
+}
+
+// add tracks the message, the messages must be added in offset order
+func (t *offsetTracker) add(msg *sarama.ConsumerMessage) *trackedMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := &trackedMessage{tracker: t, msg: msg}
+	t.pending = append(t.pending, m)
+	return m
+}
+
+// ack marks the message as acked, its offset is marked once the messages before it are completed
+func (m *trackedMessage) ack() {
+	m.tracker.mu.Lock()
+	defer m.tracker.mu.Unlock()
+
+	m.acked = true
+}
+
+// complete marks the message as handled and marks the highest acked offset
+// whose previous messages are completed
+func (t *offsetTracker) complete(m *trackedMessage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m.done = true
+
+	var last *sarama.ConsumerMessage
+	for len(t.pending) > 0 && t.pending[0].done {
+		if t.pending[0].acked {
+			last = t.pending[0].msg
+		}
+		t.pending[0] = nil
+		t.pending = t.pending[1:]
+	}
+
+	if last != nil {
+		t.session.MarkMessage(last, "")
+	}
+}
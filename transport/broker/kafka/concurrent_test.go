@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	session := newFakeSession()
+	tracker := newOffsetTracker(session)
+
+	var tracked []*trackedMessage
+	for offset := int64(0); offset < 4; offset++ {
+		tracked = append(tracked, tracker.add(&sarama.ConsumerMessage{Offset: offset}))
+	}
+
+	for _, i := range []int{2, 0, 1} {
+		tracked[i].ack()
+		tracker.complete(tracked[i])
+	}
+
+	// offset 2 waits for offset 1
+	assert.Equal(t, []int64{0, 2}, session.Marked())
+
+	// an unacked message does not hold the next offsets
+	tracker.complete(tracked[3])
+	assert.Equal(t, []int64{0, 2}, session.Marked())
+}
+
+func TestConcurrencyKeepsOrderPerKey(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = map[string][]int64{}
+	)
+
+	opt := broker.NewSubscribeOptions()
+	h := &consumerGroupHandler{
+		handler: func(ctx context.Context, e broker.Event) error {
+			key := string(e.Message().Key)
+			if key == "a" {
+				// the slow key does not hold the other keys
+				time.Sleep(time.Millisecond)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			received[key] = append(received[key], e.(*publication).kafkaMessage.Offset)
+			return nil
+		},
+		subopts:     opt,
+		kopts:       broker.NewBrokerOptions(),
+		ready:       make(chan bool),
+		codec:       DefaultMarshaler{},
+		concurrency: 4,
+		keyFunc:     MessageKey,
+	}
+
+	session, claim := newFakeSession(), newFakeClaim(100)
+	keys := []string{"a", "b", "c"}
+	for offset := int64(0); offset < 90; offset++ {
+		claim.send(offset, keys[offset%3], "{}")
+	}
+	close(claim.messages)
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+
+	for i, key := range keys {
+		offsets := received[key]
+		assert.Len(t, offsets, 30)
+		assert.True(t, sort.SliceIsSorted(offsets, func(a, b int) bool { return offsets[a] < offsets[b] }))
+		assert.Equal(t, int64(i), offsets[0])
+	}
+
+	// the offsets are marked in order, up to the last message
+	marked := session.Marked()
+	assert.True(t, sort.SliceIsSorted(marked, func(a, b int) bool { return marked[a] < marked[b] }))
+	assert.Equal(t, int64(89), marked[len(marked)-1])
+}
+
+func TestDefaultKeyFunc(t *testing.T) {
+	assert.Equal(t, "key", MessageKey(&broker.Message{Key: []byte("key"), Body: []byte(`{"AGGREGATE_ID":"aggregate"}`)}))
+	assert.Equal(t, "aggregate", MessageKey(&broker.Message{Body: []byte(`{"AGGREGATE_ID":"aggregate"}`)}))
+	assert.Equal(t, "", MessageKey(&broker.Message{Body: []byte(`not json`)}))
+}
+
+func TestConcurrentExactlyOnce(t *testing.T) {
+	br := NewKafkaBroker(Transactional("test"))
+
+	_, err := br.Subscribe("test.concurrency", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, ExactlyOnce(), Concurrency(4))
+	assert.ErrorIs(t, err, ErrConcurrentExactlyOnce)
+}
@@ -24,6 +24,15 @@ type KafkaBrokerConfig struct {
 	TLSClientCertFile string
 	TLSClientKeyFile  string
 	TLSCaCertFile     string
+
+	// Topics ensured at Connect
+	Topics []TopicConfig
+
+	// Creates the subscribed, retry, dead-letter and reply topics before they are used
+	AutoCreateTopics       bool
+	TopicPartitions        int32
+	TopicReplicationFactor int16
+	TopicConfigs           map[string]string
 }
 
 func createTLSConfiguration(certFile string, keyFile string, caFile string, skipVerify bool) (*tls.Config, error) {
@@ -102,6 +111,19 @@ func GetKafkaBroker(cfg *KafkaBrokerConfig, opts ...broker.BrokerOption) (broker
 		ConsumerConfig(conf), // for consumers
 	}
 
+	// Topic administration
+	if len(cfg.Topics) > 0 {
+		brokerOptions = append(brokerOptions, Topics(cfg.Topics...))
+	}
+
+	if cfg.AutoCreateTopics {
+		brokerOptions = append(brokerOptions, AutoCreateTopics(TopicConfig{
+			Partitions:        cfg.TopicPartitions,
+			ReplicationFactor: cfg.TopicReplicationFactor,
+			Configs:           cfg.TopicConfigs,
+		}))
+	}
+
 	opts = append(
 		brokerOptions,
 		opts...,
@@ -2,6 +2,9 @@ package kafka
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/kingstonduy/go-core/logger"
 	"github.com/kingstonduy/go-core/transport/broker"
@@ -13,32 +16,105 @@ import (
 
 // consumerGroupHandler is the implementation of sarama.ConsumerGroupHandler
 type consumerGroupHandler struct {
+	topic   string
 	handler broker.Handler
 	subopts broker.SubscribeOptions
 	kopts   broker.BrokerOptions
 	cg      sarama.ConsumerGroup
 	ready   chan bool
 	codec   Codec
+
+	// the first error of Setup, the subscription fails instead of waiting for ready
+	setupErr chan error
+
+	// handles the messages within kafka transactions, see ExactlyOnce
+	transactor Transactor
+
+	// workers per partition and key of the messages, see Concurrency
+	concurrency int
+	keyFunc     KeyFunc
+
+	// offsets reset by the first session, see Seek
+	seek     *OffsetReset
+	resolver offsetResolver
+
+	// the rebalance hooks and the partitions claimed by the session, see OnPartitionsAssigned
+	onAssigned PartitionsFunc
+	onRevoked  PartitionsFunc
+	claimed    []int32
+
+	// the messages handled by the claims, see kBroker.Drain
+	inflight *inflight
+
+	// stops the subscription, see broker.ErrorActionStop
+	stopSubscription func(err error)
+
+	// the pauses by partition of the workers, see broker.ErrorActionPause
+	pauseMu sync.Mutex
+	paused  map[int32]int
 }
 
-func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+func (h *consumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	// a session starts with every rebalance of the group
+	h.emitRebalance()
+
+	// the subscription waits for the ready session and fails with the error of the seek
+	if h.seek != nil {
+		if err := h.seekClaims(session); err != nil {
+			h.setupFailed(err)
+			return err
+		}
+		h.seek = nil
+	}
+
+	h.assign(session)
+
 	close(h.ready)
 	return nil
 }
 
-func (*consumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
+// setupFailed passes the error of the session to the subscription waiting for its first session
+func (h *consumerGroupHandler) setupFailed(err error) {
+	select {
+	case h.setupErr <- err:
+	default:
+	}
+}
+
+// seekClaims moves the offsets of the claimed partitions to the position of the seek,
+// the partition consumers start from these offsets
+func (h *consumerGroupHandler) seekClaims(session sarama.ConsumerGroupSession) error {
+	offsets, err := resolveOffsets(h.resolver, h.topic, session.Claims()[h.topic], *h.seek)
+	if err != nil {
+		return err
+	}
+
+	for partition, offset := range offsets {
+		// ResetOffset only moves the offset backwards and MarkOffset only forwards
+		session.ResetOffset(h.topic, partition, offset, "")
+		session.MarkOffset(h.topic, partition, offset, "")
+	}
+
+	h.log(session.Context(), logger.InfoLevel, "Sought the offsets of group %s on topic %s: %v", h.subopts.Group, h.topic, offsets)
+	return nil
+}
+
+// Cleanup runs once the claims of the session returned, before the session commits the offsets
+func (h *consumerGroupHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
+	h.revoke()
 	return nil
 }
 
 func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if h.concurrency > 1 {
+		return h.consumeConcurrently(session, claim)
+	}
+
 	for {
 		select {
 		case msg, ok := <-claim.Messages():
-			// opentelemetry tracing
-			ctx := otel.GetTextMapPropagator().Extract(context.Background(), otelsarama.NewConsumerMessageCarrier(msg))
-
 			if !ok {
-				h.log(ctx, logger.InfoLevel, "[kafka consumer] message channel was closed")
+				h.log(context.Background(), logger.InfoLevel, "[kafka consumer] message channel was closed")
 				return nil
 			}
 
@@ -46,37 +122,172 @@ func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession,
 				continue
 			}
 
-			m, err := h.codec.Unmarshal(msg)
-			if err != nil {
-				h.log(ctx, logger.ErrorLevel, "[kafka consumer]: failed to unmarshal consumed message: %v", err)
-				continue
+			// drained, the message is redelivered by the next session
+			if !h.inflight.begin() {
+				<-session.Context().Done()
+				return nil
 			}
 
-			p := &publication{brokerMessage: m, topic: msg.Topic, kafkaMessage: msg, consumerGroup: h.cg, session: session, timestamp: msg.Timestamp}
-			// logger.Fields(
-			// 	map[string]interface{}{
-			// 		logger.FIELD_OPERATOR_NAME: p.topic,
-			// 		logger.FIELD_STEP_NAME:     "message-received",
-			// 	},
-			// ).Info(ctx, broker.MakeStringLogsKafka(ctx, *p.brokerMessage))
-			err = h.handler(ctx, p)
-			if err == nil && h.subopts.AutoAck {
-				session.MarkMessage(msg, "")
-			} else if err != nil {
-				p.err = err
-				errHandler := h.kopts.ErrorHandler
-				if errHandler != nil {
-					errHandler(ctx, p) //nolint
-				} else {
-					h.log(ctx, logger.ErrorLevel, "[kafka] subscriber error: %v", err)
-				}
+			m, ok := h.decode(msg)
+			handled := !ok || h.handleMessage(session, msg, m, nil)
+			h.inflight.end()
+
+			// the next messages are redelivered with the unhandled one
+			if !handled {
+				return nil
 			}
+		case <-h.inflight.done():
+			// drained, the session ends once the producer is flushed
+			<-session.Context().Done()
+			return nil
 		case <-session.Context().Done():
 			return nil
 		}
 	}
 }
 
+// decode unmarshals the kafka message, the messages which cannot be decoded are skipped
+func (h *consumerGroupHandler) decode(msg *sarama.ConsumerMessage) (*broker.Message, bool) {
+	m, err := h.codec.Unmarshal(msg)
+	if err != nil {
+		h.log(context.Background(), logger.ErrorLevel, "[kafka consumer]: failed to unmarshal consumed message: %v", err)
+		return nil, false
+	}
+	return m, true
+}
+
+// handleMessage calls the handler with the message and applies the error policy of the subscription.
+// ack marks the offset of the message when it is acked, the session marks it when nil.
+// It returns false when the message is left unhandled, its offset must not be marked.
+func (h *consumerGroupHandler) handleMessage(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage, m *broker.Message, ack func()) bool {
+	// opentelemetry tracing
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), otelsarama.NewConsumerMessageCarrier(msg))
+
+	// the handler is cancelled when the session ends, e.g. while waiting for the delivery time of a retry topic
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(session.Context(), cancel)()
+
+	p := &publication{brokerMessage: m, topic: msg.Topic, kafkaMessage: msg, consumerGroup: h.cg, session: session, timestamp: msg.Timestamp, ack: ack}
+	// logger.Fields(
+	// 	map[string]interface{}{
+	// 		logger.FIELD_OPERATOR_NAME: p.topic,
+	// 		logger.FIELD_STEP_NAME:     "message-received",
+	// 	},
+	// ).Info(ctx, broker.MakeStringLogsKafka(ctx, *p.brokerMessage))
+	start := time.Now()
+	err := h.handle(ctx, p)
+	broker.EmitHandled(h.getMetrics(), msg.Topic, err, time.Since(start))
+
+	// interrupted by the end of the session, the message is redelivered
+	if err != nil && session.Context().Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		var handled bool
+		if handled, err = h.applyErrorPolicy(ctx, session, p, err); !handled {
+			return false
+		}
+	}
+
+	// the offset of the transactional handler is committed by the transaction
+	if err == nil && h.subopts.AutoAck && h.transactor == nil {
+		p.Ack() //nolint
+	} else if err != nil {
+		p.err = err
+		errHandler := h.kopts.ErrorHandler
+		if errHandler != nil {
+			errHandler(ctx, p) //nolint
+		} else {
+			h.log(ctx, logger.ErrorLevel, "[kafka] subscriber error: %v", err)
+		}
+	}
+	return true
+}
+
+func (h *consumerGroupHandler) handle(ctx context.Context, p *publication) error {
+	if h.transactor != nil {
+		return h.handleWithinTransaction(ctx, p)
+	}
+	return h.handler(ctx, p)
+}
+
+// applyErrorPolicy applies the error policy of the subscription to the failed message
+// and returns the error left to the error handler. The message is left unhandled when
+// the subscription stops or the session ends first, it is redelivered.
+func (h *consumerGroupHandler) applyErrorPolicy(ctx context.Context, session sarama.ConsumerGroupSession, p *publication, err error) (bool, error) {
+	policy := h.subopts.ErrorPolicy
+	msg := p.kafkaMessage
+
+	switch policy.Action {
+	case broker.ErrorActionRetry:
+		err = policy.Retry(session.Context(), err, func() error {
+			return h.handle(ctx, p)
+		})
+		return session.Context().Err() == nil, err
+
+	case broker.ErrorActionPause:
+		h.pause(msg.Partition)
+		defer h.resume(msg.Partition)
+
+		h.log(ctx, logger.WarnLevel, "[kafka consumer] paused %s/%d at offset %d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		for {
+			if policy.WaitHealthy(session.Context()) != nil {
+				return false, err
+			}
+			if err = h.handle(ctx, p); err == nil {
+				h.log(ctx, logger.InfoLevel, "[kafka consumer] resumed %s/%d at offset %d", msg.Topic, msg.Partition, msg.Offset)
+				return true, nil
+			}
+		}
+
+	case broker.ErrorActionStop:
+		h.log(ctx, logger.ErrorLevel, "[kafka consumer] stopped the subscription to %s: %s/%d at offset %d: %v", h.topic, msg.Topic, msg.Partition, msg.Offset, err)
+		broker.EmitConsumerError(h.getMetrics(), msg.Topic, h.subopts.Group)
+		if h.stopSubscription != nil {
+			h.stopSubscription(fmt.Errorf("%w: %s/%d at offset %d: %w", broker.ErrSubscriptionStopped, msg.Topic, msg.Partition, msg.Offset, err))
+		}
+		return false, err
+
+	default:
+		return true, err
+	}
+}
+
+// pause stops fetching the partition until every worker which paused it resumed it
+func (h *consumerGroupHandler) pause(partition int32) {
+	h.pauseMu.Lock()
+	defer h.pauseMu.Unlock()
+
+	if h.paused == nil {
+		h.paused = make(map[int32]int)
+	}
+	if h.paused[partition]++; h.paused[partition] == 1 {
+		h.cg.Pause(map[string][]int32{h.topic: {partition}})
+	}
+}
+
+func (h *consumerGroupHandler) resume(partition int32) {
+	h.pauseMu.Lock()
+	defer h.pauseMu.Unlock()
+
+	if h.paused[partition]--; h.paused[partition] == 0 {
+		delete(h.paused, partition)
+		h.cg.Resume(map[string][]int32{h.topic: {partition}})
+	}
+}
+
+// handleWithinTransaction commits the messages published by the handler with the offset of the consumed message
+func (h *consumerGroupHandler) handleWithinTransaction(ctx context.Context, p *publication) error {
+	return h.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if err := h.handler(ctx, p); err != nil {
+			return err
+		}
+		return addMessageToTxn(ctx, p.kafkaMessage, h.subopts.Group)
+	})
+}
+
 func (c *consumerGroupHandler) log(ctx context.Context, level logger.Level, message string, args ...interface{}) {
 	c.getLogger().Logf(ctx, level, message, args...)
 }
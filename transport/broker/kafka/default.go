@@ -1,5 +1,21 @@
 package kafka
 
+import "time"
+
 var (
 	DefaultKafkaBroker = "127.0.0.1:9092"
+
+	// batch subscriptions
+	DefaultBatchSize = 100
+	DefaultBatchWait = time.Second
+
+	// topics created by the TopicAdmin
+	DefaultTopicPartitions        int32 = 1
+	DefaultTopicReplicationFactor int16 = 1
+
+	// interval of the consumer lag metric
+	DefaultLagInterval = 30 * time.Second
+
+	// wait before joining the group again when the session failed
+	DefaultConsumeRetryBackoff = 2 * time.Second
 )
@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kingstonduy/go-core/logger"
+)
+
+// Drain implements broker.Drainer.
+// The subscriptions stop taking new messages while their sessions stay open, until the in-flight handlers returned.
+// The async producer is flushed, so the messages published by the handlers are sent,
+// then the sessions end and commit the offsets of the handled messages, and the broker is disconnected.
+func (k *kBroker) Drain(ctx context.Context) error {
+	k.scMutex.Lock()
+	subscribers := make([]*subscriber, len(k.subscribers))
+	copy(subscribers, k.subscribers)
+	k.scMutex.Unlock()
+
+	idles := make([]<-chan struct{}, len(subscribers))
+	for i, s := range subscribers {
+		idles[i] = s.quiesce()
+	}
+
+	var err error
+	for i, s := range subscribers {
+		if err = s.waitIdle(ctx, idles[i]); err != nil {
+			break
+		}
+	}
+
+	// the handlers are done, nothing is published anymore
+	if err == nil {
+		err = k.flush(ctx)
+	}
+
+	// the sessions commit the offsets once the output of the handlers is sent
+	for _, s := range subscribers {
+		s.stop()
+	}
+	if err == nil {
+		for _, s := range subscribers {
+			if err = s.wait(ctx); err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		k.log(ctx, logger.ErrorLevel, "failed to drain kafka broker, disconnecting: %s", err)
+	}
+
+	if dErr := k.disconnect(); dErr != nil && err == nil {
+		err = dErr
+	}
+	return err
+}
+
+// Drain implements broker.Drainer, the session ends once the in-flight handlers returned
+// and the consumer group is closed once the consume loop returned
+func (s *subscriber) Drain(ctx context.Context) error {
+	err := s.waitIdle(ctx, s.quiesce())
+
+	s.stop()
+	if err == nil {
+		err = s.wait(ctx)
+	}
+	if cErr := s.close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// quiesce stops the claims from taking new messages, the sessions stay open.
+// The returned channel is closed once the in-flight handlers returned.
+func (s *subscriber) quiesce() <-chan struct{} {
+	s.consumerGroup.PauseAll()
+	return s.inflight.quiesce()
+}
+
+// waitIdle waits for the in-flight handlers of the quiesced subscription
+func (s *subscriber) waitIdle(ctx context.Context, idle <-chan struct{}) error {
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain subscription to %s: %w", s.topic, ctx.Err())
+	}
+}
+
+// wait waits for the consume loop to return
+func (s *subscriber) wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain subscription to %s: %w", s.topic, ctx.Err())
+	}
+}
+
+// flush closes the async producer, which sends the buffered messages first
+func (k *kBroker) flush(ctx context.Context) error {
+	// waits for the publishes sending to the producer
+	k.apMutex.Lock()
+	ap := k.asyncProducer
+	k.asyncProducer = nil
+	k.apMutex.Unlock()
+
+	if ap == nil {
+		return nil
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- ap.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("failed to flush kafka async producer: %w", ctx.Err())
+	}
+}
+
+// inflight counts the messages handled by the claims of a subscription,
+// the claims take no new message once it is quiesced
+type inflight struct {
+	mu       sync.Mutex
+	n        int
+	quiesced chan struct{}
+	idle     chan struct{}
+}
+
+func newInflight() *inflight {
+	return &inflight{quiesced: make(chan struct{})}
+}
+
+// begin counts a message, false once quiesced: the message is left to the next session
+func (f *inflight) begin() bool {
+	if f == nil {
+		return true
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.idle != nil {
+		return false
+	}
+	f.n++
+	return true
+}
+
+// end uncounts a handled message
+func (f *inflight) end() {
+	if f == nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.n--; f.n == 0 && f.idle != nil {
+		close(f.idle)
+	}
+}
+
+// done is closed once quiesced
+func (f *inflight) done() <-chan struct{} {
+	if f == nil {
+		return nil
+	}
+	return f.quiesced
+}
+
+// quiesce stops counting new messages, the returned channel is closed once the counted ones are handled
+func (f *inflight) quiesce() <-chan struct{} {
+	if f == nil {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.idle == nil {
+		f.idle = make(chan struct{})
+		close(f.quiesced)
+		if f.n == 0 {
+			close(f.idle)
+		}
+	}
+	return f.idle
+}
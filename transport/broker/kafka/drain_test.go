@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeConsumerGroup struct {
+	sarama.ConsumerGroup
+	closed atomic.Bool
+}
+
+func (cg *fakeConsumerGroup) Close() error {
+	cg.closed.Store(true)
+	return nil
+}
+
+func (cg *fakeConsumerGroup) PauseAll() {}
+
+// fakeAsyncProducer counts the messages of its input, its input is closed by Close
+type fakeAsyncProducer struct {
+	sarama.AsyncProducer
+	input    chan *sarama.ProducerMessage
+	received atomic.Int64
+}
+
+func newFakeAsyncProducer() *fakeAsyncProducer {
+	p := &fakeAsyncProducer{input: make(chan *sarama.ProducerMessage)}
+	go func() {
+		for range p.input {
+			p.received.Add(1)
+		}
+	}()
+	return p
+}
+
+func (p *fakeAsyncProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *fakeAsyncProducer) Close() error {
+	close(p.input)
+	return nil
+}
+
+// newTestSubscriber runs a consume loop with an in-flight handler called once the subscription is quiesced,
+// the session ends once the subscription is stopped. sessionEnd is called when the session ends.
+func newTestSubscriber(k *kBroker, handler func(), sessionEnd func()) (*subscriber, *fakeConsumerGroup) {
+	ctx, stop := context.WithCancel(context.Background())
+	cg := &fakeConsumerGroup{}
+	s := &subscriber{
+		kBroker:       k,
+		consumerGroup: cg,
+		topic:         "test.drain",
+		stop:          stop,
+		done:          make(chan struct{}),
+		inflight:      newInflight(),
+	}
+
+	s.inflight.begin()
+	go func() {
+		defer close(s.done)
+
+		<-s.inflight.done()
+		handler()
+		s.inflight.end()
+
+		<-ctx.Done()
+		if sessionEnd != nil {
+			sessionEnd()
+		}
+	}()
+
+	k.consumerGroups = append(k.consumerGroups, cg)
+	k.subscribers = append(k.subscribers, s)
+	return s, cg
+}
+
+func TestDrain(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+
+	producer := mocks.NewAsyncProducer(t, nil)
+	producer.ExpectInputAndSucceed()
+	k.asyncProducer = producer
+
+	var published, flushedFirst atomic.Bool
+	_, cg := newTestSubscriber(k, func() {
+		// the in-flight handler publishes its output before the producer is closed
+		time.Sleep(50 * time.Millisecond)
+		published.Store(k.Publish(context.TODO(), "test.output", &broker.Message{Body: []byte("{}")}) == nil)
+	}, func() {
+		// the session commits its offsets once the output is sent
+		k.apMutex.RLock()
+		defer k.apMutex.RUnlock()
+		flushedFirst.Store(k.asyncProducer == nil)
+	})
+
+	assert.NoError(t, broker.DrainBroker(context.TODO(), k))
+	assert.True(t, published.Load())
+	assert.True(t, flushedFirst.Load())
+	assert.True(t, cg.closed.Load())
+	assert.Nil(t, k.asyncProducer)
+	assert.Empty(t, k.subscribers)
+}
+
+func TestDrainDeadline(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	_, cg := newTestSubscriber(k, func() { <-release }, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// closed even though the handler did not return
+	assert.ErrorIs(t, k.Drain(ctx), context.DeadlineExceeded)
+	assert.True(t, cg.closed.Load())
+}
+
+func TestDrainSubscriber(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+
+	var handled atomic.Bool
+	s, cg := newTestSubscriber(k, func() {
+		time.Sleep(50 * time.Millisecond)
+		handled.Store(true)
+	}, nil)
+	_, other := newTestSubscriber(k, func() {}, nil)
+
+	assert.NoError(t, s.Unsubscribe())
+	assert.True(t, handled.Load())
+	assert.True(t, cg.closed.Load())
+
+	assert.False(t, other.closed.Load())
+	assert.Len(t, k.subscribers, 1)
+	assert.Equal(t, []sarama.ConsumerGroup{other}, k.consumerGroups)
+}
+
+func TestInflight(t *testing.T) {
+	f := newInflight()
+	assert.True(t, f.begin())
+
+	idle := f.quiesce()
+	assert.False(t, f.begin())
+
+	select {
+	case <-f.done():
+	default:
+		t.Fatal("not quiesced")
+	}
+
+	select {
+	case <-idle:
+		t.Fatal("idle with a message in flight")
+	default:
+	}
+
+	f.end()
+	<-idle
+	assert.Equal(t, idle, f.quiesce())
+}
+
+func TestPublishWhileFlushing(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+	producer := newFakeAsyncProducer()
+	k.asyncProducer = producer
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the publishes after the flush fail without producer
+			for j := 0; j < 100; j++ {
+				k.Publish(context.TODO(), "test.output", &broker.Message{Body: []byte("{}")}) //nolint
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, k.flush(context.TODO()))
+	wg.Wait()
+}
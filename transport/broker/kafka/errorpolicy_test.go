@@ -0,0 +1,222 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePausingGroup records the paused and resumed partitions
+type fakePausingGroup struct {
+	sarama.ConsumerGroup
+
+	mu      sync.Mutex
+	paused  []int32
+	resumed []int32
+}
+
+func (cg *fakePausingGroup) Pause(partitions map[string][]int32) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.paused = append(cg.paused, partitions["test.policy"]...)
+}
+
+func (cg *fakePausingGroup) Resume(partitions map[string][]int32) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.resumed = append(cg.resumed, partitions["test.policy"]...)
+}
+
+// newTestPolicyHandler fails the messages whose body is "fail" while failing returns true
+func newTestPolicyHandler(policy broker.ErrorPolicy, failing func() bool) (*consumerGroupHandler, *[]error) {
+	var (
+		mu      sync.Mutex
+		skipped []error
+	)
+
+	bOpts := broker.NewBrokerOptions(broker.WithBrokerErrorHandler(func(ctx context.Context, e broker.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		skipped = append(skipped, e.Error())
+		return nil
+	}))
+
+	h := &consumerGroupHandler{
+		topic: "test.policy",
+		handler: func(ctx context.Context, e broker.Event) error {
+			if string(e.Message().Body) == "fail" && failing() {
+				return errors.New("downstream unavailable")
+			}
+			return nil
+		},
+		subopts: broker.NewSubscribeOptions(broker.WithSubscribeErrorPolicy(policy)),
+		kopts:   bOpts,
+		cg:      &fakePausingGroup{},
+		ready:   make(chan bool),
+		codec:   DefaultMarshaler{},
+	}
+	return h, &skipped
+}
+
+func sendPolicyMessages(claim *fakeClaim, bodies ...string) {
+	for i, body := range bodies {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "test.policy", Partition: 1, Offset: int64(i), Value: []byte(body)}
+	}
+	close(claim.messages)
+}
+
+func TestErrorPolicySkip(t *testing.T) {
+	h, skipped := newTestPolicyHandler(broker.SkipOnError(), func() bool { return true })
+
+	session, claim := newFakeSession(), newFakeClaim(3)
+	sendPolicyMessages(claim, "ok", "fail", "ok")
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{0, 2}, session.Marked())
+	assert.Len(t, *skipped, 1)
+}
+
+func TestErrorPolicyRetry(t *testing.T) {
+	attempts := 0
+	backoff := func(int) time.Duration { return time.Millisecond }
+
+	// succeeds on the third attempt
+	h, skipped := newTestPolicyHandler(broker.RetryOnError(3, backoff), func() bool {
+		attempts++
+		return attempts < 3
+	})
+
+	session, claim := newFakeSession(), newFakeClaim(3)
+	sendPolicyMessages(claim, "ok", "fail", "ok")
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int64{0, 1, 2}, session.Marked())
+	assert.Empty(t, *skipped)
+
+	// skipped once every retry failed
+	attempts = 0
+	h, skipped = newTestPolicyHandler(broker.RetryOnError(2, backoff), func() bool {
+		attempts++
+		return true
+	})
+
+	session, claim = newFakeSession(), newFakeClaim(3)
+	sendPolicyMessages(claim, "ok", "fail", "ok")
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []int64{0, 2}, session.Marked())
+	assert.Len(t, *skipped, 1)
+}
+
+func TestErrorPolicyPause(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		healthy bool
+		checks  int
+	)
+
+	healthCheck := func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if checks++; checks == 3 {
+			healthy = true
+		}
+		if !healthy {
+			return errors.New("unhealthy")
+		}
+		return nil
+	}
+
+	h, skipped := newTestPolicyHandler(broker.PauseOnError(healthCheck, time.Millisecond), func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return !healthy
+	})
+
+	session, claim := newFakeSession(), newFakeClaim(3)
+	sendPolicyMessages(claim, "ok", "fail", "ok")
+
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, 3, checks)
+	assert.Equal(t, []int64{0, 1, 2}, session.Marked())
+	assert.Empty(t, *skipped)
+
+	cg := h.cg.(*fakePausingGroup)
+	assert.Equal(t, []int32{1}, cg.paused)
+	assert.Equal(t, []int32{1}, cg.resumed)
+}
+
+func TestErrorPolicyPauseUntilSessionEnds(t *testing.T) {
+	h, skipped := newTestPolicyHandler(broker.PauseOnError(nil, time.Millisecond), func() bool { return true })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	session, claim := newFakeSession(), newFakeClaim(3)
+	session.ctx = ctx
+	sendPolicyMessages(claim, "ok", "fail", "ok")
+
+	// the failed message is redelivered by the next session
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{0}, session.Marked())
+	assert.Empty(t, *skipped)
+
+	cg := h.cg.(*fakePausingGroup)
+	assert.Equal(t, []int32{1}, cg.resumed)
+}
+
+func TestHandlerCanceledBySession(t *testing.T) {
+	h, skipped := newTestPolicyHandler(broker.SkipOnError(), func() bool { return true })
+	h.handler = func(ctx context.Context, e broker.Event) error {
+		if string(e.Message().Body) != "wait" {
+			return nil
+		}
+		// e.g. the delivery time of a retry topic
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	session, claim := newFakeSession(), newFakeClaim(3)
+	session.ctx = ctx
+	sendPolicyMessages(claim, "ok", "wait", "ok")
+
+	// the interrupted message is redelivered by the next session
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.Equal(t, []int64{0}, session.Marked())
+	assert.Empty(t, *skipped)
+}
+
+func TestErrorPolicyStop(t *testing.T) {
+	for _, concurrency := range []int{0, 4} {
+		h, skipped := newTestPolicyHandler(broker.StopOnError(), func() bool { return true })
+		h.concurrency = concurrency
+		h.keyFunc = MessageKey
+
+		ctx, stop := context.WithCancel(context.Background())
+		s := &subscriber{topic: "test.policy", stop: stop, done: make(chan struct{})}
+		h.stopSubscription = s.fail
+
+		session, claim := newFakeSession(), newFakeClaim(3)
+		session.ctx = ctx
+		sendPolicyMessages(claim, "ok", "fail", "ok")
+
+		assert.NoError(t, h.ConsumeClaim(session, claim))
+		assert.Equal(t, []int64{0}, session.Marked())
+		assert.Empty(t, *skipped)
+
+		assert.Error(t, ctx.Err())
+		assert.ErrorIs(t, s.Err(), broker.ErrSubscriptionStopped)
+		assert.EqualError(t, s.Err(), "subscription stopped by its error policy: test.policy/1 at offset 1: downstream unavailable")
+	}
+}
@@ -2,7 +2,6 @@ package kafka
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -12,27 +11,40 @@ import (
 
 	"github.com/IBM/sarama"
 	"github.com/dnwe/otelsarama"
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 )
 
-var (
-	RequestReplyTimeout = time.Second * 60
-)
-
 type kBroker struct {
 	addrs []string
 
 	client         sarama.Client        // broker connection client
 	syncProducer   sarama.SyncProducer  // sync producer
-	asyncProducer  sarama.AsyncProducer // async producer
+	asyncProducer  sarama.AsyncProducer // async producer, guarded by apMutex
+	apMutex        sync.RWMutex
 	consumerGroups []sarama.ConsumerGroup
+	subscribers    []*subscriber
 	connected      bool
 	scMutex        sync.Mutex
 	opts           broker.BrokerOptions
 
+	// transactional producer, one transaction at a time
+	txnMutex sync.Mutex
+
 	// request-reply patterns
-	resps           sync.Map
-	respSubscribers sync.Map
+	instanceID       string   // default instance id, see InstanceID
+	resps            sync.Map // correlation id -> chan *broker.Message
+	replyMutex       sync.Mutex
+	replySubscribers map[string]*replySubscription // reply topic -> subscription
+	inflight         sync.Map                      // request topic -> *int64
+
+	// topic administration
+	admin         sarama.ClusterAdmin
+	adminMutex    sync.Mutex
+	ensuredTopics sync.Map // topic -> true
+
+	// partition or partition key of the messages published with the publish options
+	routings sync.Map // *sarama.ProducerMessage -> messageRouting
 
 	codec Codec
 }
@@ -52,10 +64,16 @@ func NewKafkaBroker(opts ...broker.BrokerOption) broker.Broker {
 		cAddrs = []string{DefaultKafkaBroker}
 	}
 
+	var codec Codec = DefaultMarshaler{}
+	if c, ok := options.Context.Value(codecKey{}).(Codec); ok && c != nil {
+		codec = c
+	}
+
 	return &kBroker{
-		addrs: cAddrs,
-		codec: DefaultMarshaler{},
-		opts:  options,
+		addrs:      cAddrs,
+		codec:      codec,
+		opts:       options,
+		instanceID: uuid.New().String(),
 	}
 }
 
@@ -64,6 +82,17 @@ type subscriber struct {
 	consumerGroup sarama.ConsumerGroup
 	topic         string
 	opts          broker.SubscribeOptions
+
+	// stops the consume loop, done is closed once it returned
+	stop context.CancelFunc
+	done chan struct{}
+
+	// the messages handled by the claims, see Drain
+	inflight *inflight
+
+	// the error which stopped the subscription, see broker.ErrorActionStop
+	mu  sync.Mutex
+	err error
 }
 
 type publication struct {
@@ -74,6 +103,9 @@ type publication struct {
 	brokerMessage *broker.Message
 	session       sarama.ConsumerGroupSession
 	timestamp     time.Time
+
+	// marks the offset instead of the session, see Concurrency
+	ack func()
 }
 
 func (p *publication) Topic() string {
@@ -85,6 +117,10 @@ func (p *publication) Message() *broker.Message {
 }
 
 func (p *publication) Ack() error {
+	if p.ack != nil {
+		p.ack()
+		return nil
+	}
 	p.session.MarkMessage(p.kafkaMessage, "")
 	return nil
 }
@@ -105,7 +141,38 @@ func (s *subscriber) Topic() string {
 	return s.topic
 }
 
+// Done implements broker.StoppableSubscriber.
+func (s *subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err implements broker.StoppableSubscriber.
+func (s *subscriber) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// fail stops the consume loop on the error of the error policy
+func (s *subscriber) fail(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	s.stop()
+}
+
+// Unsubscribe drains the subscription within broker.DefaultDrainTimeout, see Drain
 func (s *subscriber) Unsubscribe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return s.Drain(ctx)
+}
+
+func (s *subscriber) close() error {
 	if err := s.consumerGroup.Close(); err != nil {
 		return err
 	}
@@ -114,6 +181,13 @@ func (s *subscriber) Unsubscribe() error {
 	k.scMutex.Lock()
 	defer k.scMutex.Unlock()
 
+	for i, sub := range k.subscribers {
+		if sub == s {
+			k.subscribers = append(k.subscribers[:i], k.subscribers[i+1:]...)
+			break
+		}
+	}
+
 	for i, cg := range k.consumerGroups {
 		if cg == s.consumerGroup {
 			k.consumerGroups = append(k.consumerGroups[:i], k.consumerGroups[i+1:]...)
@@ -150,6 +224,15 @@ func (k *kBroker) Connect() error {
 	pconfig.Producer.Return.Successes = true
 	pconfig.Producer.Return.Errors = true
 
+	if k.isTransactional() {
+		pconfig = transactionalProducerConfig(pconfig, k.getTransactionalID())
+	}
+
+	// the partition and partition key publish options
+	routingConfig := *pconfig
+	routingConfig.Producer.Partitioner = newRoutingPartitioner(&k.routings, pconfig.Producer.Partitioner)
+	pconfig = &routingConfig
+
 	c, err := sarama.NewClient(k.addrs, pconfig)
 	if err != nil {
 		return err
@@ -165,7 +248,8 @@ func (k *kBroker) Connect() error {
 	// If set the error chan, will use async produce
 	// else use sync produce
 	// only keep one client resource, is c variable
-	if errChan != nil {
+	// The transactional producer is always sync
+	if errChan != nil && !k.isTransactional() {
 		ap, err = sarama.NewAsyncProducerFromClient(c)
 
 		// opentelemetry tracing
@@ -178,17 +262,23 @@ func (k *kBroker) Connect() error {
 		// So the goroutine will auto exit
 		go func() {
 			for v := range ap.Errors() {
+				// the routing is left when the message fails before its partitioning
+				k.routings.Delete(v.Msg)
+				broker.EmitPublished(k.getMetrics(), v.Msg.Topic, v.Err)
 				errChan <- v
 			}
 		}()
 
-		if successChan != nil {
-			go func() {
-				for v := range ap.Successes() {
+		// the successes are drained without success chan,
+		// the producer would block once the channel is full
+		go func() {
+			for v := range ap.Successes() {
+				broker.EmitPublished(k.getMetrics(), v.Topic, nil)
+				if successChan != nil {
 					successChan <- v
 				}
-			}()
-		}
+			}
+		}()
 	} else {
 		p, err = sarama.NewSyncProducerFromClient(c)
 
@@ -206,41 +296,80 @@ func (k *kBroker) Connect() error {
 		k.syncProducer = p
 	}
 	if ap != nil {
+		k.apMutex.Lock()
 		k.asyncProducer = ap
+		k.apMutex.Unlock()
 	}
 	k.consumerGroups = make([]sarama.ConsumerGroup, 0)
+	k.subscribers = nil
 	k.connected = true
 
+	k.scMutex.Unlock()
+
+	if topics := k.getTopics(); len(topics) > 0 {
+		if err := k.EnsureTopics(context.Background(), topics...); err != nil {
+			return err
+		}
+	}
+
 	// request-reply pattern
+	k.replyMutex.Lock()
 	k.resps = sync.Map{}
-	k.respSubscribers = sync.Map{}
+	k.replySubscribers = make(map[string]*replySubscription)
+	k.replyMutex.Unlock()
 
-	k.scMutex.Unlock()
+	// subscribe the reply topics before the first request
+	for _, topic := range k.getReplyTopics() {
+		if _, err := k.subscribeReply(context.Background(), topic, ""); err != nil {
+			return fmt.Errorf("failed to subscribe reply topic %s: %w", topic, err)
+		}
+	}
 
 	return nil
 }
 
+// Disconnect drains the broker within broker.DefaultDrainTimeout, see Drain
 func (k *kBroker) Disconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return k.Drain(ctx)
+}
+
+// disconnect closes the consumer groups, the producers and the client
+func (k *kBroker) disconnect() error {
 	k.scMutex.Lock()
 	defer k.scMutex.Unlock()
 	for _, consumer := range k.consumerGroups {
 		consumer.Close()
 	}
 	k.consumerGroups = nil
+	k.subscribers = nil
 	if k.syncProducer != nil {
 		k.syncProducer.Close()
+		k.syncProducer = nil
 	}
+	k.apMutex.Lock()
 	if k.asyncProducer != nil {
 		k.asyncProducer.Close()
+		k.asyncProducer = nil
 	}
-	if err := k.client.Close(); err != nil {
-		return err
+	k.apMutex.Unlock()
+	if err := k.closeAdmin(); err != nil {
+		k.log(context.Background(), logger.ErrorLevel, "failed to close kafka cluster admin: %s", err)
+	}
+	if k.client != nil {
+		if err := k.client.Close(); err != nil {
+			return err
+		}
 	}
 	k.connected = false
 
 	// request-reply pattern
+	k.replyMutex.Lock()
 	k.resps = sync.Map{}
-	k.respSubscribers = sync.Map{}
+	k.replySubscribers = make(map[string]*replySubscription)
+	k.replyMutex.Unlock()
 
 	return nil
 }
@@ -268,113 +397,65 @@ func (k *kBroker) Options() broker.BrokerOptions {
 }
 
 func (k *kBroker) Publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
-	// not used here
-	_ = broker.NewPublishOptions(opts...)
+	publish := broker.ChainPublishMiddleware(k.publish, k.opts.PublishMiddlewares...)
+	return publish(ctx, topic, msg, opts...)
+}
 
-	return k.sendMessage(ctx, topic, msg)
+func (k *kBroker) publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	return k.sendMessage(ctx, topic, msg, broker.NewPublishOptions(opts...))
 }
 
-func (k *kBroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (*broker.Message, error) {
-	options := broker.PublishOptions{
-		ReplyToTopic: fmt.Sprintf("%s.reply", topic),
-		Timeout:      RequestReplyTimeout,
+func (k *kBroker) sendMessage(ctx context.Context, topic string, msg *broker.Message, options broker.PublishOptions) error {
+	kMsg, err := k.codec.Marshal(topic, msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal to kafka message: %w", err)
 	}
 
-	for _, opt := range opts {
-		opt(&options)
-	}
+	k.applyPublishOptions(kMsg, options)
 
-	var (
-		replyTopic         = options.ReplyToTopic
-		replyConsumerGroup = options.ReplyConsumerGroup
-		timeout            = options.Timeout
-		errChan            = make(chan error)
-		msgChan            = make(chan *broker.Message, 1)
-	)
+	// opentelemetry tracing
+	otel.GetTextMapPropagator().Inject(ctx, otelsarama.NewProducerMessageCarrier(kMsg))
 
-	err := k.sendMessage(ctx, topic, msg)
-	if err != nil {
-		return nil, err
-	}
+	res, _ := options.Context.Value(resultKey{}).(*PublishResult)
 
-	// Create a channel to receive reply messages
-	correlationId, correlationIdOk := msg.Headers[CorrelationIdHeader]
-	if !correlationIdOk {
-		return nil, fmt.Errorf("missing correlation id in message")
+	// publish within the transaction of the context,
+	// or within its own transaction with the transactional producer
+	if txn := extractTxn(ctx); txn != nil {
+		return k.sendSync(txn.producer, kMsg, res)
+	} else if k.isTransactional() {
+		return k.WithinTransaction(ctx, func(ctx context.Context) error {
+			return k.sendSync(extractTxn(ctx).producer, kMsg, res)
+		})
 	}
-	k.resps.Store(correlationId, msgChan)
-
-	// Subscribe for reply topic if didn't
-	go func() {
-		if _, ok := k.respSubscribers.LoadOrStore(replyTopic, true); !ok {
-			var subOpts = make([]broker.SubscribeOption, 0)
-			if len(replyConsumerGroup) != 0 {
-				subOpts = append(subOpts, broker.WithSubscribeGroup(replyConsumerGroup))
-			}
 
-			_, err := k.Subscribe(replyTopic, func(ctx context.Context, e broker.Event) error {
-				go func() {
-					if e.Message() == nil {
-						return
-					}
-
-					cId, correlationIdOk := e.Message().Headers[CorrelationIdHeader]
-					if !correlationIdOk {
-						return
-					}
+	return k.send(kMsg, options)
+}
 
-					msgChan, msgChanOk := k.resps.LoadAndDelete(cId)
-					if msgChanOk {
-						msgChan.(chan *broker.Message) <- e.Message()
-					}
-				}()
-				return nil
-			}, subOpts...)
+func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	start := time.Now()
 
-			if err != nil {
-				errChan <- err
-				k.respSubscribers.Delete(replyTopic)
-			}
-		}
-	}()
+	opt := broker.NewSubscribeOptions(opts...)
 
-	select {
-	case body := <-msgChan:
-		return body, nil
-	case err := <-errChan:
+	if err := k.ensureSubscribeTopics(opt.Context, topic, opt); err != nil {
 		return nil, err
-	case <-time.After(timeout):
-		// remove processed channel
-		k.resps.Delete(correlationId)
-		return nil, broker.RequestTimeoutResponse{
-			Timeout: timeout,
-		}
 	}
-}
 
-func (k *kBroker) sendMessage(ctx context.Context, topic string, msg *broker.Message) error {
-	kMsg, err := k.codec.Marshal(topic, msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal to kafka message: %w", err)
+	// retry topics & dead-letter queue
+	if opt.Retry != nil {
+		return broker.SubscribeWithRetry(k, topic, handler, opts...)
 	}
 
-	// opentelemetry tracing
-	otel.GetTextMapPropagator().Inject(ctx, otelsarama.NewProducerMessageCarrier(kMsg))
-
-	if k.asyncProducer != nil {
-		k.asyncProducer.Input() <- kMsg
-		return nil
-	} else if k.syncProducer != nil {
-		_, _, err := k.syncProducer.SendMessage(kMsg)
-		return err
+	exactlyOnce, _ := opt.Context.Value(exactlyOnceKey{}).(bool)
+	if exactlyOnce && !k.isTransactional() {
+		return nil, ErrNotTransactional
 	}
-	return errors.New(`no connection resources available`)
-}
 
-func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
-	start := time.Now()
+	concurrency, _ := opt.Context.Value(concurrencyKey{}).(int)
+	if exactlyOnce && concurrency > 1 {
+		return nil, ErrConcurrentExactlyOnce
+	}
 
-	opt := broker.NewSubscribeOptions(opts...)
+	handler = broker.WrapHandler(handler, k.opts, opt)
 
 	// we need to create a new client per consumer
 	cg, err := k.getSaramaConsumerGroup(opt.Context, opt.Group)
@@ -383,6 +464,7 @@ func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 	}
 
 	csHandler := &consumerGroupHandler{
+		topic:   topic,
 		handler: handler,
 		subopts: opt,
 		kopts:   k.opts,
@@ -391,20 +473,64 @@ func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		codec:   k.codec,
 	}
 
+	if exactlyOnce {
+		csHandler.transactor = k
+	}
+
+	if err := k.setSeek(csHandler, opt); err != nil {
+		return nil, err
+	}
+	setRebalanceHooks(csHandler, opt)
+
+	if concurrency > 1 {
+		csHandler.concurrency = concurrency
+		csHandler.keyFunc = MessageKey
+		if keyFunc, ok := opt.Context.Value(keyFuncKey{}).(KeyFunc); ok {
+			csHandler.keyFunc = keyFunc
+		}
+	}
+
 	// Wrap instrumentation
 	otelCsHandler := otelsarama.WrapConsumerGroupHandler(csHandler)
 
-	ctx := context.Background()
+	return k.consume(start, topic, opt, cg, csHandler, otelCsHandler)
+}
+
+// consume runs the consumer group in background and waits until it is ready
+func (k *kBroker) consume(start time.Time, topic string, opt broker.SubscribeOptions, cg sarama.ConsumerGroup, csHandler *consumerGroupHandler, handler sarama.ConsumerGroupHandler) (broker.Subscriber, error) {
+	ctx, stop := context.WithCancel(context.Background())
+	s := &subscriber{
+		kBroker:       k,
+		consumerGroup: cg,
+		opts:          opt,
+		topic:         topic,
+		stop:          stop,
+		done:          make(chan struct{}),
+		inflight:      newInflight(),
+	}
+	csHandler.stopSubscription = s.fail
+	csHandler.inflight = s.inflight
+	csHandler.setupErr = make(chan error, 1)
+
+	// the ready channel is made again by the consume loop for the next session
+	ready := csHandler.ready
+
 	topics := []string{topic}
 	go func() {
+		defer close(s.done)
 		for {
 			select {
 			case err := <-cg.Errors():
 				if err != nil {
 					k.log(ctx, logger.ErrorLevel, "consumer error: %s", err)
+					broker.EmitConsumerError(k.getMetrics(), topic, opt.Group)
 				}
 			default:
-				err := cg.Consume(ctx, topics, otelCsHandler)
+				err := cg.Consume(ctx, topics, handler)
+				// drained, the session committed the offsets of the handled messages
+				if ctx.Err() != nil {
+					return
+				}
 				switch err {
 				case sarama.ErrClosedConsumerGroup:
 					return
@@ -413,22 +539,38 @@ func (k *kBroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 					continue
 				default:
 					k.log(ctx, logger.ErrorLevel, "consumer error: %s", err)
+					broker.EmitConsumerError(k.getMetrics(), topic, opt.Group)
+
+					// the group is joined again after the backoff, e.g. when the brokers are unavailable
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(DefaultConsumeRetryBackoff):
+					}
 				}
 			}
 		}
 	}()
 
+	go k.reportLag(ctx, topic, opt.Group)
+
 	// wait until consumer group running
-	<-csHandler.ready
+	select {
+	case <-ready:
+	case err := <-csHandler.setupErr:
+		s.stop()
+		<-s.done
+		s.close() //nolint
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", topic, err)
+	}
 
 	k.log(ctx, logger.InfoLevel, "Subcribed to topic: %s. Consumer group: %s. Duration: %dms", topic, opt.Group, time.Since(start).Milliseconds())
 
-	return &subscriber{
-		kBroker:       k,
-		consumerGroup: cg,
-		opts:          opt,
-		topic:         topic,
-	}, nil
+	k.scMutex.Lock()
+	k.subscribers = append(k.subscribers, s)
+	k.scMutex.Unlock()
+
+	return s, nil
 }
 
 func (k *kBroker) getProducerConfig(pContext context.Context) *sarama.Config {
@@ -456,6 +598,10 @@ func (k *kBroker) getConsumerConfig(cContext context.Context) *sarama.Config {
 
 	config.Consumer.Return.Errors = true
 
+	if exactlyOnce, _ := cContext.Value(exactlyOnceKey{}).(bool); exactlyOnce {
+		config = exactlyOnceConsumerConfig(config)
+	}
+
 	return config
 }
 
@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+// reportLag emits the lag of the group on the partitions of the topic every LagInterval, until ctx is done
+func (k *kBroker) reportLag(ctx context.Context, topic string, group string) {
+	interval := k.getLagInterval()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := k.emitLag(topic, group); err != nil {
+			k.log(ctx, logger.WarnLevel, "failed to report the lag of %s for group %s: %s", topic, group, err)
+		}
+	}
+}
+
+// emitLag emits the high-water mark minus the committed offset of the group, per partition of the topic.
+// The partitions without committed offset lag from their oldest offset.
+func (k *kBroker) emitLag(topic string, group string) error {
+	k.scMutex.Lock()
+	client := k.client
+	k.scMutex.Unlock()
+
+	if client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+
+	admin, err := k.getAdmin()
+	if err != nil {
+		return err
+	}
+
+	offsets, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return err
+	}
+
+	for _, partition := range partitions {
+		newest, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return err
+		}
+
+		committed := int64(-1)
+		if block := offsets.GetBlock(topic, partition); block != nil {
+			committed = block.Offset
+		}
+		if committed < 0 {
+			if committed, err = client.GetOffset(topic, partition, sarama.OffsetOldest); err != nil {
+				return err
+			}
+		}
+
+		lag := newest - committed
+		if lag < 0 {
+			lag = 0
+		}
+
+		k.getMetrics().SetGaugeWithLabels(
+			broker.MetricKeyClientLag,
+			float32(lag),
+			[]metrics.Label{
+				{
+					Name:  broker.MetricLabelTopic,
+					Value: topic,
+				},
+				{
+					Name:  broker.MetricLabelPartition,
+					Value: strconv.Itoa(int(partition)),
+				},
+				{
+					Name:  broker.MetricLabelGroup,
+					Value: group,
+				},
+			},
+		)
+	}
+
+	return nil
+}
+
+// emitRebalance counts the new session of the consumer group
+func (h *consumerGroupHandler) emitRebalance() {
+	h.getMetrics().IncrCounterWithLabels(
+		broker.MetricKeyClientRebalanceTotal,
+		1,
+		[]metrics.Label{
+			{
+				Name:  broker.MetricLabelTopic,
+				Value: h.topic,
+			},
+			{
+				Name:  broker.MetricLabelGroup,
+				Value: h.subopts.Group,
+			},
+		},
+	)
+}
+
+func (h *consumerGroupHandler) getMetrics() *metrics.Metrics {
+	if h.kopts.Metrics != nil {
+		return h.kopts.Metrics
+	}
+	return metrics.Default()
+}
+
+func (k *kBroker) getMetrics() *metrics.Metrics {
+	if k.opts.Metrics != nil {
+		return k.opts.Metrics
+	}
+	return metrics.Default()
+}
+
+func (k *kBroker) getLagInterval() time.Duration {
+	if interval, ok := k.opts.Context.Value(lagIntervalKey{}).(time.Duration); ok {
+		return interval
+	}
+	return DefaultLagInterval
+}
@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeOffsetClient returns the offsets of its partitions
+type fakeOffsetClient struct {
+	sarama.Client
+	newest map[int32]int64
+	oldest map[int32]int64
+}
+
+func (c *fakeOffsetClient) Partitions(topic string) ([]int32, error) {
+	partitions := make([]int32, 0, len(c.newest))
+	for partition := range c.newest {
+		partitions = append(partitions, partition)
+	}
+	return partitions, nil
+}
+
+func (c *fakeOffsetClient) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return c.oldest[partition], nil
+	}
+	return c.newest[partition], nil
+}
+
+// fakeOffsetAdmin returns the committed offsets of the group
+type fakeOffsetAdmin struct {
+	sarama.ClusterAdmin
+	committed map[int32]int64
+}
+
+func (a *fakeOffsetAdmin) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	res := &sarama.OffsetFetchResponse{}
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			offset, ok := a.committed[partition]
+			if !ok {
+				offset = -1
+			}
+			res.AddBlock(topic, partition, &sarama.OffsetFetchResponseBlock{Offset: offset})
+		}
+	}
+	return res, nil
+}
+
+func newTestMetrics(t *testing.T) (*metrics.Metrics, *metrics.InmemSink) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	m, err := metrics.New(&metrics.Config{FilterDefault: true}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, sink
+}
+
+func TestEmitLag(t *testing.T) {
+	m, sink := newTestMetrics(t)
+
+	k := NewKafkaBroker(broker.WithBrokerMetrics(m)).(*kBroker)
+	k.client = &fakeOffsetClient{
+		newest: map[int32]int64{0: 100, 1: 50},
+		oldest: map[int32]int64{0: 0, 1: 20},
+	}
+	k.admin = &fakeOffsetAdmin{committed: map[int32]int64{0: 90}}
+
+	assert.NoError(t, k.emitLag("test.lag", "group"))
+
+	gauges := sink.Data()[0].Gauges
+	assert.Equal(t, float32(10), gauges["broker.client.lag;topic=test.lag;partition=0;group=group"].Value)
+	// no committed offset, from the oldest offset
+	assert.Equal(t, float32(30), gauges["broker.client.lag;topic=test.lag;partition=1;group=group"].Value)
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	m, sink := newTestMetrics(t)
+
+	h := &consumerGroupHandler{
+		topic:   "test.metrics",
+		kopts:   broker.NewBrokerOptions(broker.WithBrokerMetrics(m), broker.WithBrokerErrorHandler(func(ctx context.Context, e broker.Event) error { return nil })),
+		subopts: broker.NewSubscribeOptions(broker.WithSubscribeGroup("group")),
+		ready:   make(chan bool),
+		handler: func(ctx context.Context, e broker.Event) error {
+			if string(e.Message().Body) == "fail" {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	}
+	h.subopts.AutoAck = false
+
+	assert.NoError(t, h.Setup(nil))
+
+	msg := &sarama.ConsumerMessage{Topic: "test.metrics"}
+	h.handleMessage(newFakeSession(), msg, &broker.Message{Body: []byte("ok")}, nil)
+	h.handleMessage(newFakeSession(), msg, &broker.Message{Body: []byte("fail")}, nil)
+
+	interval := sink.Data()[0]
+	assert.Equal(t, 1, interval.Counters["broker.client.rebalance.total;topic=test.metrics;group=group"].Count)
+	assert.Equal(t, 1, interval.Counters["broker.client.consume.total;topic=test.metrics;status_code=200;error_code=00"].Count)
+	assert.Equal(t, 2, interval.Samples["broker.client.handle.duration.milliseconds;topic=test.metrics"].Count)
+}
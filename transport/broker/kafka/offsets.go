@@ -0,0 +1,239 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+)
+
+var (
+	ErrGroupActive = errors.New("kafka consumer group has active members")
+)
+
+// OffsetReset is the position a consumer group is reset to on a topic.
+// The first set field applies: Timestamp, Offsets, then Position.
+type OffsetReset struct {
+	// the first offset of each partition with a timestamp at or after the time,
+	// the newest offset when the partition has no such message
+	Timestamp time.Time
+
+	// the offset of each partition, the other partitions are not reset
+	Offsets map[int32]int64
+
+	// sarama.OffsetOldest (earliest) or sarama.OffsetNewest (latest), latest when 0
+	Position int64
+}
+
+// ResetToTimestamp resets the partitions to their first message at or after t
+func ResetToTimestamp(t time.Time) OffsetReset {
+	return OffsetReset{Timestamp: t}
+}
+
+// ResetToOffsets resets the partitions to the offsets by partition
+func ResetToOffsets(offsets map[int32]int64) OffsetReset {
+	return OffsetReset{Offsets: offsets}
+}
+
+// ResetToEarliest resets the partitions to their oldest offset
+func ResetToEarliest() OffsetReset {
+	return OffsetReset{Position: sarama.OffsetOldest}
+}
+
+// ResetToLatest resets the partitions to their newest offset, the existing messages are skipped
+func ResetToLatest() OffsetReset {
+	return OffsetReset{Position: sarama.OffsetNewest}
+}
+
+// OffsetAdmin is implemented by the kafka broker, it manages the committed offsets of the consumer groups
+type OffsetAdmin interface {
+	// ResetOffsets commits the offsets of the reset for the group on the topic and returns them by partition.
+	// The group must have no active member, ErrGroupActive otherwise: stop its subscriptions first.
+	ResetOffsets(ctx context.Context, group string, topic string, reset OffsetReset) (map[int32]int64, error)
+	// CommittedOffsets returns the offsets committed by the group on the topic by partition, -1 when none
+	CommittedOffsets(ctx context.Context, group string, topic string) (map[int32]int64, error)
+}
+
+// offsetResolver is the part of sarama.Client resolving the offsets
+type offsetResolver interface {
+	Partitions(topic string) ([]int32, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+}
+
+// ResetOffsets implements OffsetAdmin.
+func (k *kBroker) ResetOffsets(ctx context.Context, group string, topic string, reset OffsetReset) (map[int32]int64, error) {
+	client, err := k.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := k.getAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe kafka consumer group %s: %w", group, err)
+	}
+	for _, g := range groups {
+		if len(g.Members) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrGroupActive, group)
+		}
+	}
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the partitions of kafka topic %s: %w", topic, err)
+	}
+
+	offsets, err := resolveOffsets(client, topic, partitions, reset)
+	if err != nil {
+		return nil, err
+	}
+
+	om, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka offset manager: %w", err)
+	}
+	defer om.Close() //nolint
+
+	for partition, offset := range offsets {
+		pom, err := om.ManagePartition(topic, partition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to manage the offset of %s/%d: %w", topic, partition, err)
+		}
+
+		// ResetOffset only moves the offset backwards and MarkOffset only forwards
+		pom.ResetOffset(offset, "")
+		pom.MarkOffset(offset, "")
+		defer pom.AsyncClose()
+	}
+
+	om.Commit()
+
+	// the offset manager reports the commit errors on the partition managers, read them back to verify
+	committed, err := k.CommittedOffsets(ctx, group, topic)
+	if err != nil {
+		return nil, err
+	}
+	for partition, offset := range offsets {
+		if committed[partition] != offset {
+			return nil, fmt.Errorf("failed to commit the offset %d of %s/%d for group %s", offset, topic, partition, group)
+		}
+	}
+
+	k.log(ctx, logger.InfoLevel, "Reset the offsets of group %s on topic %s: %v", group, topic, offsets)
+	return offsets, nil
+}
+
+// CommittedOffsets implements OffsetAdmin.
+func (k *kBroker) CommittedOffsets(ctx context.Context, group string, topic string) (map[int32]int64, error) {
+	client, err := k.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the partitions of kafka topic %s: %w", topic, err)
+	}
+
+	admin, err := k.getAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the offsets of kafka consumer group %s: %w", group, err)
+	}
+
+	offsets := make(map[int32]int64, len(partitions))
+	for _, partition := range partitions {
+		offsets[partition] = -1
+		if block := res.GetBlock(topic, partition); block != nil {
+			offsets[partition] = block.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// resolveOffsets returns the offsets of the reset for the partitions
+func resolveOffsets(client offsetResolver, topic string, partitions []int32, reset OffsetReset) (map[int32]int64, error) {
+	offsets := make(map[int32]int64, len(partitions))
+
+	if reset.Timestamp.IsZero() && len(reset.Offsets) > 0 {
+		for _, partition := range partitions {
+			if offset, ok := reset.Offsets[partition]; ok {
+				offsets[partition] = offset
+			}
+		}
+		return offsets, nil
+	}
+
+	for _, partition := range partitions {
+		offset, err := resolveOffset(client, topic, partition, reset)
+		if err != nil {
+			return nil, err
+		}
+		offsets[partition] = offset
+	}
+	return offsets, nil
+}
+
+func resolveOffset(client offsetResolver, topic string, partition int32, reset OffsetReset) (int64, error) {
+	position := reset.Position
+	if !reset.Timestamp.IsZero() {
+		position = reset.Timestamp.UnixMilli()
+	}
+	if position == 0 {
+		position = sarama.OffsetNewest
+	}
+
+	offset, err := client.GetOffset(topic, partition, position)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the offset of %s/%d: %w", topic, partition, err)
+	}
+
+	// no message at or after the timestamp
+	if offset < 0 {
+		if offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest); err != nil {
+			return 0, fmt.Errorf("failed to read the offset of %s/%d: %w", topic, partition, err)
+		}
+	}
+	return offset, nil
+}
+
+// setSeek sets the offset reset of the Seek option to the handler of the subscription
+func (k *kBroker) setSeek(h *consumerGroupHandler, opt broker.SubscribeOptions) error {
+	reset, ok := opt.Context.Value(seekKey{}).(OffsetReset)
+	if !ok {
+		return nil
+	}
+
+	client, err := k.getClient()
+	if err != nil {
+		return err
+	}
+
+	h.seek = &reset
+	h.resolver = client
+	return nil
+}
+
+// getClient returns the client of the connected broker
+func (k *kBroker) getClient() (sarama.Client, error) {
+	k.scMutex.Lock()
+	defer k.scMutex.Unlock()
+
+	if k.client == nil {
+		return nil, errors.New(`no connection resources available`)
+	}
+	return k.client, nil
+}
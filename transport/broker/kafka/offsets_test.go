@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOffsetResolver resolves the offsets of a partition by timestamp,
+// the messages of a partition are one millisecond apart from the oldest one
+type fakeOffsetResolver struct {
+	partitions []int32
+	oldest     map[int32]int64
+	newest     map[int32]int64
+	start      time.Time
+}
+
+func (r *fakeOffsetResolver) Partitions(_ string) ([]int32, error) {
+	return r.partitions, nil
+}
+
+func (r *fakeOffsetResolver) GetOffset(_ string, partition int32, time int64) (int64, error) {
+	switch time {
+	case sarama.OffsetOldest:
+		return r.oldest[partition], nil
+	case sarama.OffsetNewest:
+		return r.newest[partition], nil
+	}
+
+	offset := r.oldest[partition] + max(time-r.start.UnixMilli(), 0)
+	if offset >= r.newest[partition] {
+		return -1, nil
+	}
+	return offset, nil
+}
+
+func TestResolveOffsets(t *testing.T) {
+	r := &fakeOffsetResolver{
+		partitions: []int32{0, 1, 2},
+		oldest:     map[int32]int64{0: 0, 1: 10, 2: 100},
+		newest:     map[int32]int64{0: 50, 1: 20, 2: 200},
+		start:      time.UnixMilli(1714557600000),
+	}
+
+	cases := []struct {
+		name  string
+		reset OffsetReset
+		want  map[int32]int64
+	}{
+		{
+			name:  "timestamp",
+			reset: ResetToTimestamp(r.start.Add(15 * time.Millisecond)),
+			// the partition 1 has no message at or after the time
+			want: map[int32]int64{0: 15, 1: 20, 2: 115},
+		},
+		{
+			name:  "timestamp before the oldest message",
+			reset: ResetToTimestamp(r.start.Add(-time.Hour)),
+			want:  map[int32]int64{0: 0, 1: 10, 2: 100},
+		},
+		{
+			name:  "offsets",
+			reset: ResetToOffsets(map[int32]int64{0: 7, 2: 150, 5: 1}),
+			// the other partitions are not reset
+			want: map[int32]int64{0: 7, 2: 150},
+		},
+		{
+			name:  "earliest",
+			reset: ResetToEarliest(),
+			want:  map[int32]int64{0: 0, 1: 10, 2: 100},
+		},
+		{
+			name:  "latest",
+			reset: ResetToLatest(),
+			want:  map[int32]int64{0: 50, 1: 20, 2: 200},
+		},
+		{
+			name:  "zero value",
+			reset: OffsetReset{},
+			want:  map[int32]int64{0: 50, 1: 20, 2: 200},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			offsets, err := resolveOffsets(r, "account.created", r.partitions, c.reset)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, offsets)
+		})
+	}
+}
+
+func TestSeekOption(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+	h := &consumerGroupHandler{}
+
+	// without the option, the handler is not sought
+	assert.NoError(t, k.setSeek(h, broker.NewSubscribeOptions()))
+	assert.Nil(t, h.seek)
+
+	// the option needs the client of the connected broker
+	assert.Error(t, k.setSeek(h, broker.NewSubscribeOptions(Seek(ResetToEarliest()))))
+}
+
+// fakeSessionGroup fails to join the group, then runs the sessions with Setup
+type fakeSessionGroup struct {
+	fakeConsumerGroup
+	session sarama.ConsumerGroupSession
+	errors  chan error
+	calls   int
+}
+
+func (cg *fakeSessionGroup) Errors() <-chan error {
+	return cg.errors
+}
+
+func (cg *fakeSessionGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	if cg.calls++; cg.calls == 1 {
+		return errors.New("coordinator unavailable")
+	}
+	if err := handler.Setup(cg.session); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+func TestSubscribeSetupFails(t *testing.T) {
+	backoff := DefaultConsumeRetryBackoff
+	DefaultConsumeRetryBackoff = 20 * time.Millisecond
+	defer func() { DefaultConsumeRetryBackoff = backoff }()
+
+	k := NewKafkaBroker().(*kBroker)
+	cg := &fakeSessionGroup{
+		session: &fakeClaimsSession{fakeSession: newFakeSession(), claims: map[string][]int32{"test.seek": {0}}},
+		errors:  make(chan error),
+	}
+	k.consumerGroups = append(k.consumerGroups, cg)
+
+	h := &consumerGroupHandler{
+		topic:    "test.seek",
+		kopts:    k.opts,
+		ready:    make(chan bool),
+		seek:     &OffsetReset{Position: sarama.OffsetOldest},
+		resolver: failingResolver{},
+	}
+
+	// the subscription fails with the error of the seek, after the backoff of the failed join
+	start := time.Now()
+	_, err := k.consume(start, "test.seek", broker.NewSubscribeOptions(), cg, h, h)
+	assert.ErrorContains(t, err, "unavailable")
+	assert.GreaterOrEqual(t, time.Since(start), DefaultConsumeRetryBackoff)
+	assert.Equal(t, 2, cg.calls)
+
+	assert.True(t, cg.closed.Load())
+	assert.Empty(t, k.consumerGroups)
+	assert.Empty(t, k.subscribers)
+}
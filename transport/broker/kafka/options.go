@@ -2,6 +2,7 @@ package kafka
 
 import (
 	"context"
+	"time"
 
 	"github.com/kingstonduy/go-core/transport/broker"
 
@@ -48,6 +49,34 @@ func InitialOffset(offset int64) broker.SubscribeOption {
 	return broker.SetSubscribeOption(initialOffsetKey{}, offset)
 }
 
+type seekKey struct{}
+
+// Seek resets the offsets of the group to the position of the reset when the subscription starts,
+// unlike InitialOffset which only applies to the new groups.
+// The offsets are reset on the partitions claimed by the first session of the subscription,
+// on every start: remove the option once the messages are replayed.
+// To reset the partitions of a group with several instances, stop them and use OffsetAdmin.ResetOffsets.
+func Seek(reset OffsetReset) broker.SubscribeOption {
+	return broker.SetSubscribeOption(seekKey{}, reset)
+}
+
+type partitionsAssignedKey struct{}
+
+// OnPartitionsAssigned calls fn with the partitions of the topic claimed by every new session of the subscription,
+// before their messages are handled. The context is done when the session ends.
+func OnPartitionsAssigned(fn PartitionsFunc) broker.SubscribeOption {
+	return broker.SetSubscribeOption(partitionsAssignedKey{}, fn)
+}
+
+type partitionsRevokedKey struct{}
+
+// OnPartitionsRevoked calls fn with the partitions claimed by the session when it ends,
+// once the in-flight handlers of the partitions returned and before the offsets are committed.
+// Every rebalance of the group ends the session: the partitions are revoked, then the new ones are assigned.
+func OnPartitionsRevoked(fn PartitionsFunc) broker.SubscribeOption {
+	return broker.SetSubscribeOption(partitionsRevokedKey{}, fn)
+}
+
 type asyncProduceErrorKey struct{}
 type asyncProduceSuccessKey struct{}
 
@@ -62,3 +91,156 @@ func AsyncProducer(errors chan<- *sarama.ProducerError, successes chan<- *sarama
 	}
 	return opt
 }
+
+type transactionalIDKey struct{}
+
+// Transactional enables the transactional producer with the transactional.id.
+// The id must be unique per running instance and stable through restarts,
+// so that the broker fences the transactions of a zombie instance.
+// The messages are published with the sync producer, AsyncProducer is ignored.
+func Transactional(transactionalID string) broker.BrokerOption {
+	return broker.SetBrokerOption(transactionalIDKey{}, transactionalID)
+}
+
+type exactlyOnceKey struct{}
+
+// ExactlyOnce handles every message in a kafka transaction:
+// the messages published by the handler and the offset of the consumed message are committed atomically.
+// The broker must be Transactional. The subscription reads the committed messages only.
+func ExactlyOnce() broker.SubscribeOption {
+	return broker.SetSubscribeOption(exactlyOnceKey{}, true)
+}
+
+type batchSizeKey struct{}
+
+// BatchSize is the maximum number of messages of a batch, see BatchBroker
+func BatchSize(size int) broker.SubscribeOption {
+	return broker.SetSubscribeOption(batchSizeKey{}, size)
+}
+
+type batchWaitKey struct{}
+
+// BatchWait is the maximum time a message waits in an incomplete batch, see BatchBroker
+func BatchWait(wait time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(batchWaitKey{}, wait)
+}
+
+type batchSplitOnErrorKey struct{}
+
+// BatchSplitOnError retries the halves of a failed batch until the failing messages are isolated,
+// the other messages are acked and the failing ones are passed to the error handler.
+func BatchSplitOnError() broker.SubscribeOption {
+	return broker.SetSubscribeOption(batchSplitOnErrorKey{}, true)
+}
+
+type concurrencyKey struct{}
+
+// Concurrency spreads the messages of each claimed partition over the workers by key, see ConcurrencyKey.
+// The messages with the same key are handled in order, one at a time.
+// An offset is marked once the messages before it are handled, so no message is skipped after a crash.
+// With broker.WithSubscribeAutoAck(false), call Ack before the handler returns.
+func Concurrency(workers int) broker.SubscribeOption {
+	return broker.SetSubscribeOption(concurrencyKey{}, workers)
+}
+
+type keyFuncKey struct{}
+
+// ConcurrencyKey sets the ordering key of the messages, MessageKey by default
+func ConcurrencyKey(fn KeyFunc) broker.SubscribeOption {
+	return broker.SetSubscribeOption(keyFuncKey{}, fn)
+}
+
+type replyTopicsKey struct{}
+
+// ReplyTopics subscribes the reply topics of PublishAndReceive at Connect,
+// the other reply topics are subscribed by their first request: the default reply topic,
+// <request topic>.reply, is not known before the request.
+func ReplyTopics(topics ...string) broker.BrokerOption {
+	return broker.SetBrokerOption(replyTopicsKey{}, topics)
+}
+
+type instanceIDKey struct{}
+
+// InstanceID identifies the instance in the reply consumer groups, and receives the replies on <reply topic>.<instance id>.
+// It must be unique per running instance and stable through restarts, e.g. the name of the pod of a StatefulSet,
+// otherwise every restart leaves a reply topic and a consumer group behind.
+// Without InstanceID, the instance id is random and the replies are received on the shared reply topic, see SharedReplyTopic.
+func InstanceID(id string) broker.BrokerOption {
+	return broker.SetBrokerOption(instanceIDKey{}, id)
+}
+
+type sharedReplyTopicKey struct{}
+
+// SharedReplyTopic receives the replies on the reply topic itself instead of <reply topic>.<instance id> with InstanceID,
+// for the responders which do not publish the replies to the replyTo header of the request.
+// Every instance receives every reply, with a consumer group per instance, and drops the ones it does not wait for.
+func SharedReplyTopic() broker.BrokerOption {
+	return broker.SetBrokerOption(sharedReplyTopicKey{}, true)
+}
+
+type topicsKey struct{}
+
+// Topics ensures the topics at Connect, see TopicAdmin.EnsureTopics
+func Topics(topics ...TopicConfig) broker.BrokerOption {
+	return broker.SetBrokerOption(topicsKey{}, topics)
+}
+
+type autoCreateTopicsKey struct{}
+
+// AutoCreateTopics ensures the topics before they are used: the subscribed topics,
+// with the retry and dead-letter topics of their RetryPolicy, and the reply topics of PublishAndReceive.
+// The topics are created with the partitions, replication factor and configs of defaults.
+func AutoCreateTopics(defaults TopicConfig) broker.BrokerOption {
+	return broker.SetBrokerOption(autoCreateTopicsKey{}, defaults)
+}
+
+type codecKey struct{}
+
+// MessageCodec converts the broker messages from and to the kafka messages, DefaultMarshaler by default
+func MessageCodec(c Codec) broker.BrokerOption {
+	return broker.SetBrokerOption(codecKey{}, c)
+}
+
+type lagIntervalKey struct{}
+
+// LagInterval sets the interval of the lag metric of the subscriptions, DefaultLagInterval by default.
+// The lag is not reported when the interval is 0.
+func LagInterval(interval time.Duration) broker.BrokerOption {
+	return broker.SetBrokerOption(lagIntervalKey{}, interval)
+}
+
+type partitionKey struct{}
+
+// Partition publishes the message to the partition
+func Partition(partition int32) broker.PublishOption {
+	return broker.SetPublishOption(partitionKey{}, partition)
+}
+
+type partitionerKeyKey struct{}
+
+// PartitionKey routes the message by the hash of the key instead of the message key,
+// the message key is published as is
+func PartitionKey(key []byte) broker.PublishOption {
+	return broker.SetPublishOption(partitionerKeyKey{}, key)
+}
+
+type timestampKey struct{}
+
+// Timestamp sets the timestamp of the record, kafka 0.10 or later
+func Timestamp(t time.Time) broker.PublishOption {
+	return broker.SetPublishOption(timestampKey{}, t)
+}
+
+type syncKey struct{}
+
+// Sync waits for the ack of the message even when the async producer is configured
+func Sync() broker.PublishOption {
+	return broker.SetPublishOption(syncKey{}, true)
+}
+
+type resultKey struct{}
+
+// Result fills res with where the message landed, see PublishResult
+func Result(res *PublishResult) broker.PublishOption {
+	return broker.SetPublishOption(resultKey{}, res)
+}
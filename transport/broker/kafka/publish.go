@@ -0,0 +1,209 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+	"github.com/dnwe/otelsarama"
+)
+
+var (
+	ErrInvalidPartition = errors.New("kafka partition out of range")
+)
+
+// PublishResult is where the message landed, see Result and ResultPublisher.
+// The partition and offset are only known when the publish waits for the ack:
+// with the sync producer, the transactional producer or the Sync publish option.
+type PublishResult struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+
+	// whether the publish waited for the ack
+	Acked bool
+}
+
+// ResultPublisher is implemented by the kafka broker
+type ResultPublisher interface {
+	// PublishWithResult publishes the message like Publish and returns where it landed
+	PublishWithResult(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (*PublishResult, error)
+}
+
+// PublishWithResult implements ResultPublisher.
+func (k *kBroker) PublishWithResult(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (*PublishResult, error) {
+	res := &PublishResult{}
+	if err := k.Publish(ctx, topic, msg, append(opts, Result(res))...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// messageRouting is the partition or partition key chosen by the publish options of a message
+type messageRouting struct {
+	partition    int32
+	hasPartition bool
+	key          []byte
+}
+
+// applyPublishOptions sets the kafka publish options on the message,
+// the routing is registered for the partitioner of the producer
+func (k *kBroker) applyPublishOptions(kMsg *sarama.ProducerMessage, options broker.PublishOptions) {
+	if options.Context == nil {
+		return
+	}
+
+	if timestamp, ok := options.Context.Value(timestampKey{}).(time.Time); ok {
+		kMsg.Timestamp = timestamp
+	}
+
+	var routing messageRouting
+	if partition, ok := options.Context.Value(partitionKey{}).(int32); ok {
+		routing.partition = partition
+		routing.hasPartition = true
+	}
+	if key, ok := options.Context.Value(partitionerKeyKey{}).([]byte); ok {
+		routing.key = key
+	}
+
+	if routing.hasPartition || routing.key != nil {
+		k.routings.Store(kMsg, routing)
+	}
+}
+
+// send sends the message with the producer, waiting for the ack when the publish is sync
+func (k *kBroker) send(kMsg *sarama.ProducerMessage, options broker.PublishOptions) error {
+	res, _ := options.Context.Value(resultKey{}).(*PublishResult)
+	if res != nil {
+		res.Topic = kMsg.Topic
+		res.Partition = -1
+		res.Offset = -1
+	}
+
+	sync, _ := options.Context.Value(syncKey{}).(bool)
+
+	// the producer is not closed while the message is sent to its input
+	k.apMutex.RLock()
+	async := k.asyncProducer != nil
+	if async && !sync {
+		k.asyncProducer.Input() <- kMsg
+		k.apMutex.RUnlock()
+		return nil
+	}
+	k.apMutex.RUnlock()
+
+	producer, err := k.getSyncProducer()
+	if err != nil {
+		return err
+	}
+
+	return k.sendSync(producer, kMsg, res)
+}
+
+func (k *kBroker) sendSync(producer sarama.SyncProducer, kMsg *sarama.ProducerMessage, res *PublishResult) error {
+	// the routing is left when the message fails before its partitioning
+	defer k.routings.Delete(kMsg)
+
+	partition, offset, err := producer.SendMessage(kMsg)
+	broker.EmitPublished(k.getMetrics(), kMsg.Topic, err)
+	if err != nil {
+		return err
+	}
+
+	if res != nil {
+		res.Topic = kMsg.Topic
+		res.Partition = partition
+		res.Offset = offset
+		res.Timestamp = kMsg.Timestamp
+		res.Acked = true
+	}
+	return nil
+}
+
+// getSyncProducer returns the sync producer, guarded by scMutex. With the async producer, the sync producer
+// of the Sync publishes is created on first use and shares the client of the async producer
+func (k *kBroker) getSyncProducer() (sarama.SyncProducer, error) {
+	k.scMutex.Lock()
+	defer k.scMutex.Unlock()
+
+	if k.syncProducer != nil {
+		return k.syncProducer, nil
+	}
+
+	if k.client == nil {
+		return nil, errors.New(`no connection resources available`)
+	}
+
+	p, err := sarama.NewSyncProducerFromClient(k.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka sync producer: %w", err)
+	}
+
+	// opentelemetry tracing
+	k.syncProducer = otelsarama.WrapSyncProducer(k.client.Config(), p)
+	return k.syncProducer, nil
+}
+
+// routingPartitioner routes the messages with a partition or a partition key,
+// the other messages are routed by the partitioner of the producer config
+type routingPartitioner struct {
+	sarama.Partitioner
+	routings *sync.Map
+	hash     sarama.Partitioner
+}
+
+func newRoutingPartitioner(routings *sync.Map, constructor sarama.PartitionerConstructor) sarama.PartitionerConstructor {
+	if constructor == nil {
+		constructor = sarama.NewHashPartitioner
+	}
+
+	return func(topic string) sarama.Partitioner {
+		return &routingPartitioner{
+			Partitioner: constructor(topic),
+			routings:    routings,
+			hash:        sarama.NewHashPartitioner(topic),
+		}
+	}
+}
+
+func (p *routingPartitioner) Partition(msg *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	value, ok := p.routings.LoadAndDelete(msg)
+	if !ok {
+		return p.Partitioner.Partition(msg, numPartitions)
+	}
+
+	routing := value.(messageRouting)
+	if routing.hasPartition {
+		if routing.partition < 0 || routing.partition >= numPartitions {
+			return -1, fmt.Errorf("%w: %d of %d partitions", ErrInvalidPartition, routing.partition, numPartitions)
+		}
+		return routing.partition, nil
+	}
+
+	return p.hash.Partition(&sarama.ProducerMessage{Key: sarama.ByteEncoder(routing.key)}, numPartitions)
+}
+
+// RequiresConsistency implements sarama.Partitioner, the routed messages are handled by MessageRequiresConsistency
+func (p *routingPartitioner) RequiresConsistency() bool {
+	return p.Partitioner.RequiresConsistency()
+}
+
+// MessageRequiresConsistency implements sarama.DynamicConsistencyPartitioner.
+// The routed messages require consistency, so they are not moved to another partition when theirs is unavailable,
+// the other messages follow the partitioner of the producer config.
+func (p *routingPartitioner) MessageRequiresConsistency(msg *sarama.ProducerMessage) bool {
+	if _, ok := p.routings.Load(msg); ok {
+		return true
+	}
+
+	if dynamic, ok := p.Partitioner.(sarama.DynamicConsistencyPartitioner); ok {
+		return dynamic.MessageRequiresConsistency(msg)
+	}
+	return p.Partitioner.RequiresConsistency()
+}
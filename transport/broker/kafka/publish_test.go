@@ -0,0 +1,193 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestPublishBroker returns a broker connected to a mock kafka broker
+// leading the 3 partitions of the topic test.publish
+func newTestPublishBroker(t *testing.T, opts ...broker.BrokerOption) broker.Broker {
+	seed := sarama.NewMockBroker(t, 1)
+	t.Cleanup(seed.Close)
+
+	metadata := sarama.NewMockMetadataResponse(t).SetBroker(seed.Addr(), seed.BrokerID())
+	for partition := int32(0); partition < 3; partition++ {
+		metadata.SetLeader("test.publish", partition, seed.BrokerID())
+	}
+
+	seed.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"ProduceRequest":  sarama.NewMockProduceResponse(t),
+	})
+
+	config := sarama.NewConfig()
+	config.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+
+	k := NewKafkaBroker(append([]broker.BrokerOption{
+		broker.WithBrokerAddresses(seed.Addr()),
+		ProducerConfig(config),
+	}, opts...)...)
+
+	if err := k.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { k.Disconnect() }) //nolint
+
+	return k
+}
+
+func TestPublishPartition(t *testing.T) {
+	k := newTestPublishBroker(t)
+
+	for i := 0; i < 3; i++ {
+		res, err := k.(ResultPublisher).PublishWithResult(context.TODO(), "test.publish", &broker.Message{Body: []byte("{}")}, Partition(2))
+		assert.NoError(t, err)
+		assert.Equal(t, "test.publish", res.Topic)
+		assert.Equal(t, int32(2), res.Partition)
+		assert.True(t, res.Acked)
+	}
+
+	_, err := k.(ResultPublisher).PublishWithResult(context.TODO(), "test.publish", &broker.Message{Body: []byte("{}")}, Partition(3))
+	assert.ErrorIs(t, err, ErrInvalidPartition)
+
+	// the routings are not kept after the publish
+	var routings int
+	k.(*kBroker).routings.Range(func(key, value any) bool {
+		routings++
+		return true
+	})
+	assert.Equal(t, 0, routings)
+}
+
+func TestPublishPartitionKey(t *testing.T) {
+	k := newTestPublishBroker(t)
+
+	// the partition key routes the messages to the same partition, unlike the round robin
+	var partitions []int32
+	for i := 0; i < 3; i++ {
+		var res PublishResult
+		err := k.Publish(context.TODO(), "test.publish", &broker.Message{Key: []byte{byte(i)}, Body: []byte("{}")}, PartitionKey([]byte("account-1")), Result(&res))
+		assert.NoError(t, err)
+		partitions = append(partitions, res.Partition)
+	}
+	assert.Equal(t, partitions[0], partitions[1])
+	assert.Equal(t, partitions[0], partitions[2])
+
+	hash, _ := sarama.NewHashPartitioner("test.publish").Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder("account-1")}, 3)
+	assert.Equal(t, hash, partitions[0])
+}
+
+func TestPublishSyncWithAsyncProducer(t *testing.T) {
+	errs := make(chan *sarama.ProducerError, 1)
+	k := newTestPublishBroker(t, AsyncProducer(errs, nil))
+
+	// the async publish does not wait for the ack
+	var res PublishResult
+	assert.NoError(t, k.Publish(context.TODO(), "test.publish", &broker.Message{Body: []byte("{}")}, Result(&res)))
+	assert.False(t, res.Acked)
+	assert.Equal(t, int64(-1), res.Offset)
+
+	assert.NoError(t, k.Publish(context.TODO(), "test.publish", &broker.Message{Body: []byte("{}")}, Sync(), Partition(1), Result(&res)))
+	assert.True(t, res.Acked)
+	assert.Equal(t, int32(1), res.Partition)
+	assert.False(t, res.Timestamp.IsZero())
+}
+
+func TestPublishTimestamp(t *testing.T) {
+	k := &kBroker{}
+
+	timestamp := time.Now().Add(-time.Hour)
+	kMsg := &sarama.ProducerMessage{Topic: "test.publish"}
+	k.applyPublishOptions(kMsg, broker.NewPublishOptions(Timestamp(timestamp)))
+	assert.Equal(t, timestamp, kMsg.Timestamp)
+
+	// no routing without partition nor partition key
+	_, ok := k.routings.Load(kMsg)
+	assert.False(t, ok)
+}
+
+func TestRoutingPartitionerConsistency(t *testing.T) {
+	var routings sync.Map
+	routed := &sarama.ProducerMessage{Topic: "test.publish"}
+	routings.Store(routed, messageRouting{partition: 1, hasPartition: true})
+	other := &sarama.ProducerMessage{Topic: "test.publish"}
+
+	// the round robin does not require consistency, the routed messages do
+	p := newRoutingPartitioner(&routings, sarama.NewRoundRobinPartitioner)("test.publish").(*routingPartitioner)
+	assert.False(t, p.RequiresConsistency())
+	assert.True(t, p.MessageRequiresConsistency(routed))
+	assert.False(t, p.MessageRequiresConsistency(other))
+
+	// the hash partitioner requires consistency for the messages with a key
+	p = newRoutingPartitioner(&routings, sarama.NewHashPartitioner)("test.publish").(*routingPartitioner)
+	assert.True(t, p.RequiresConsistency())
+	assert.False(t, p.MessageRequiresConsistency(other))
+	assert.True(t, p.MessageRequiresConsistency(&sarama.ProducerMessage{Topic: "test.publish", Key: sarama.StringEncoder("key")}))
+
+	var _ sarama.DynamicConsistencyPartitioner = p
+}
+
+func TestPublishAsyncErrorDeletesRouting(t *testing.T) {
+	errs := make(chan *sarama.ProducerError, 1)
+	k := newTestPublishBroker(t, AsyncProducer(errs, nil))
+
+	// the unknown topic fails before the partitioning
+	assert.NoError(t, k.Publish(context.TODO(), "test.unknown", &broker.Message{Body: []byte("{}")}, Partition(1)))
+
+	select {
+	case err := <-errs:
+		assert.Error(t, err.Err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no error")
+	}
+
+	var routings int
+	k.(*kBroker).routings.Range(func(key, value any) bool {
+		routings++
+		return true
+	})
+	assert.Equal(t, 0, routings)
+}
+
+// fakeSyncProducer acks the messages, also once closed
+type fakeSyncProducer struct {
+	sarama.SyncProducer
+}
+
+func (p *fakeSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	return 0, 0, nil
+}
+
+func (p *fakeSyncProducer) Close() error {
+	return nil
+}
+
+func TestPublishWhileDisconnecting(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+	k.syncProducer = &fakeSyncProducer{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the publishes after the disconnect fail without producer
+			for j := 0; j < 100; j++ {
+				k.Publish(context.TODO(), "test.publish", &broker.Message{Body: []byte("{}")}) //nolint
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, k.disconnect())
+	wg.Wait()
+
+	assert.Error(t, k.Publish(context.TODO(), "test.publish", &broker.Message{Body: []byte("{}")}))
+}
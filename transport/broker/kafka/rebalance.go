@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+)
+
+// PartitionsFunc receives the partitions of the subscribed topic, see OnPartitionsAssigned and OnPartitionsRevoked
+type PartitionsFunc func(ctx context.Context, topic string, partitions []int32)
+
+// setRebalanceHooks sets the hooks of the OnPartitionsAssigned and OnPartitionsRevoked options to the handler of the subscription
+func setRebalanceHooks(h *consumerGroupHandler, opt broker.SubscribeOptions) {
+	h.onAssigned, _ = opt.Context.Value(partitionsAssignedKey{}).(PartitionsFunc)
+	h.onRevoked, _ = opt.Context.Value(partitionsRevokedKey{}).(PartitionsFunc)
+}
+
+// assign passes the partitions claimed by the session to the assigned hook
+func (h *consumerGroupHandler) assign(session sarama.ConsumerGroupSession) {
+	if h.onAssigned == nil && h.onRevoked == nil {
+		return
+	}
+
+	h.claimed = append([]int32{}, session.Claims()[h.topic]...)
+	h.log(session.Context(), logger.InfoLevel, "[kafka consumer] assigned partitions of %s to group %s: %v", h.topic, h.subopts.Group, h.claimed)
+
+	if h.onAssigned != nil {
+		h.onAssigned(session.Context(), h.topic, h.claimed)
+	}
+}
+
+// revoke passes the partitions claimed by the ending session to the revoked hook,
+// the session failing to start assigned none
+func (h *consumerGroupHandler) revoke() {
+	if h.claimed == nil {
+		return
+	}
+
+	partitions := h.claimed
+	h.claimed = nil
+
+	ctx := context.Background()
+	h.log(ctx, logger.InfoLevel, "[kafka consumer] revoked partitions of %s from group %s: %v", h.topic, h.subopts.Group, partitions)
+
+	if h.onRevoked != nil {
+		h.onRevoked(ctx, h.topic, partitions)
+	}
+}
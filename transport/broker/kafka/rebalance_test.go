@@ -0,0 +1,101 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClaimsSession claims the partitions of its topics
+type fakeClaimsSession struct {
+	*fakeSession
+	claims map[string][]int32
+}
+
+func (s *fakeClaimsSession) Claims() map[string][]int32 {
+	return s.claims
+}
+
+// failingResolver fails to resolve the offsets
+type failingResolver struct{}
+
+func (failingResolver) Partitions(_ string) ([]int32, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (failingResolver) GetOffset(_ string, _ int32, _ int64) (int64, error) {
+	return 0, errors.New("unavailable")
+}
+
+func TestRebalanceHooks(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	var assigned, revoked []int32
+	opt := broker.NewSubscribeOptions(
+		OnPartitionsAssigned(func(ctx context.Context, topic string, partitions []int32) {
+			assert.Equal(t, "test.rebalance", topic)
+			assigned = partitions
+			record("assigned")
+		}),
+		OnPartitionsRevoked(func(ctx context.Context, topic string, partitions []int32) {
+			assert.Equal(t, "test.rebalance", topic)
+			revoked = partitions
+			record("revoked")
+		}),
+	)
+
+	h := &consumerGroupHandler{
+		topic: "test.rebalance",
+		handler: func(ctx context.Context, e broker.Event) error {
+			time.Sleep(10 * time.Millisecond)
+			record("handled")
+			return nil
+		},
+		subopts: opt,
+		kopts:   broker.NewBrokerOptions(),
+		ready:   make(chan bool),
+		codec:   DefaultMarshaler{},
+	}
+	setRebalanceHooks(h, opt)
+
+	session := &fakeClaimsSession{
+		fakeSession: newFakeSession(),
+		claims:      map[string][]int32{"test.rebalance": {0, 2}, "other": {1}},
+	}
+	claim := newFakeClaim(1)
+	claim.messages <- &sarama.ConsumerMessage{Topic: "test.rebalance", Partition: 2, Offset: 7, Value: []byte("{}")}
+	close(claim.messages)
+
+	// the session runs Setup, the claims, then Cleanup once the claims returned
+	assert.NoError(t, h.Setup(session))
+	assert.NoError(t, h.ConsumeClaim(session, claim))
+	assert.NoError(t, h.Cleanup(session))
+
+	assert.Equal(t, []string{"assigned", "handled", "revoked"}, events)
+	assert.Equal(t, []int32{0, 2}, assigned)
+	assert.Equal(t, []int32{0, 2}, revoked)
+
+	// a session failing to start assigns nothing, so nothing is revoked
+	events = nil
+	h.ready = make(chan bool)
+	h.seek = &OffsetReset{Position: sarama.OffsetOldest}
+	h.resolver = failingResolver{}
+
+	assert.Error(t, h.Setup(session))
+	assert.NoError(t, h.Cleanup(session))
+	assert.Empty(t, events)
+}
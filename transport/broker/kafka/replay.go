@@ -0,0 +1,196 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/transport/broker"
+
+	"github.com/IBM/sarama"
+	"github.com/dnwe/otelsarama"
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	// a partition of a replay ends once no message is received for this duration,
+	// the last offsets of the transactional and compacted topics may have no message
+	ReplayIdleTimeout = 10 * time.Second
+)
+
+// ReplayWindow bounds the messages of a replay
+type ReplayWindow struct {
+	// the replay starts at the first message at or after the time, the oldest message when zero
+	From time.Time
+
+	// the replay stops before the first message at or after the time,
+	// at the newest message when the replay started when zero
+	To time.Time
+
+	// the partitions replayed, all the partitions of the topic when empty
+	Partitions []int32
+}
+
+// Replayer is implemented by the kafka broker
+type Replayer interface {
+	// Replay handles the messages of the topic within the window, outside of any consumer group: no offset is committed.
+	// The messages published after the start of the replay are not handled.
+	// The handler errors are passed to the error handler of the broker and the replay goes on.
+	// It returns when every partition reached the end of the window, or when the context is done.
+	Replay(ctx context.Context, topic string, handler broker.Handler, window ReplayWindow, opts ...broker.SubscribeOption) error
+}
+
+// Replay implements Replayer.
+func (k *kBroker) Replay(ctx context.Context, topic string, handler broker.Handler, window ReplayWindow, opts ...broker.SubscribeOption) error {
+	client, err := k.getClient()
+	if err != nil {
+		return err
+	}
+
+	opt := broker.NewSubscribeOptions(opts...)
+	handler = broker.WrapHandler(handler, k.opts, opt)
+
+	partitions := window.Partitions
+	if len(partitions) == 0 {
+		if partitions, err = client.Partitions(topic); err != nil {
+			return fmt.Errorf("failed to read the partitions of kafka topic %s: %w", topic, err)
+		}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return fmt.Errorf("failed to create kafka consumer: %w", err)
+	}
+	defer consumer.Close() //nolint
+
+	// the window of every partition, from the first offset to the high-water mark
+	type bounds struct {
+		partition int32
+		from, end int64
+	}
+
+	var windows []bounds
+	for _, partition := range partitions {
+		from, err := resolveOffset(client, topic, partition, OffsetReset{Timestamp: window.From, Position: sarama.OffsetOldest})
+		if err != nil {
+			return err
+		}
+
+		end, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return fmt.Errorf("failed to read the offset of %s/%d: %w", topic, partition, err)
+		}
+
+		if from < end {
+			windows = append(windows, bounds{partition: partition, from: from, end: end})
+		}
+	}
+
+	start := time.Now()
+	k.log(ctx, logger.InfoLevel, "Replaying topic %s from %s to %s", topic, window.From, window.To)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		handled  int64
+	)
+
+	for _, w := range windows {
+		pc, err := consumer.ConsumePartition(topic, w.partition, w.from)
+		if err != nil {
+			// stop the partitions already started
+			cancel()
+			wg.Wait()
+			return fmt.Errorf("failed to consume %s/%d: %w", topic, w.partition, err)
+		}
+
+		wg.Add(1)
+		go func(w bounds) {
+			defer wg.Done()
+			defer pc.AsyncClose()
+
+			n, err := k.replayPartition(ctx, topic, w.partition, pc, handler, w.end, window.To)
+
+			mu.Lock()
+			defer mu.Unlock()
+			handled += n
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	k.log(ctx, logger.InfoLevel, "Replayed topic %s: %d messages. Duration: %dms", topic, handled, time.Since(start).Milliseconds())
+	return firstErr
+}
+
+// replayPartition handles the messages of the partition until the offset end or the time to,
+// and returns the number of handled messages
+func (k *kBroker) replayPartition(ctx context.Context, topic string, partition int32, pc sarama.PartitionConsumer, handler broker.Handler, end int64, to time.Time) (int64, error) {
+	idle := time.NewTimer(ReplayIdleTimeout)
+	defer idle.Stop()
+
+	var n int64
+	for {
+		select {
+		case <-ctx.Done():
+			return n, ctx.Err()
+		case <-idle.C:
+			k.log(ctx, logger.WarnLevel, "Replay of %s/%d ended before the offset %d: no message for %s", topic, partition, end, ReplayIdleTimeout)
+			return n, nil
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return n, nil
+			}
+
+			if !to.IsZero() && !msg.Timestamp.Before(to) {
+				return n, nil
+			}
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(ReplayIdleTimeout)
+
+			if m, err := k.codec.Unmarshal(msg); err != nil {
+				k.log(ctx, logger.ErrorLevel, "[kafka replay]: failed to unmarshal consumed message: %v", err)
+			} else {
+				k.replayMessage(handler, msg, m)
+				n++
+			}
+
+			if msg.Offset+1 >= end {
+				return n, nil
+			}
+		}
+	}
+}
+
+// replayMessage calls the handler with the message, the Ack of the event does nothing
+func (k *kBroker) replayMessage(handler broker.Handler, msg *sarama.ConsumerMessage, m *broker.Message) {
+	// opentelemetry tracing
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), otelsarama.NewConsumerMessageCarrier(msg))
+
+	p := &publication{brokerMessage: m, topic: msg.Topic, kafkaMessage: msg, timestamp: msg.Timestamp, ack: func() {}}
+
+	start := time.Now()
+	err := handler(ctx, p)
+	broker.EmitHandled(k.getMetrics(), msg.Topic, err, time.Since(start))
+
+	if err != nil {
+		p.err = err
+		if errHandler := k.opts.ErrorHandler; errHandler != nil {
+			errHandler(ctx, p) //nolint
+		} else {
+			k.log(ctx, logger.ErrorLevel, "[kafka replay] handler error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	RequestReplyTimeout = time.Second * 60
+
+	MetricKeyRequestInflight = []string{"broker", "request", "inflight"}
+	MetricKeyRequestTotal    = []string{"broker", "request", "total"}
+
+	MetricLabelTopic  = broker.MetricLabelTopic
+	MetricLabelStatus = broker.MetricLabelStatus
+
+	RequestStatusSuccess  = broker.RequestStatusSuccess
+	RequestStatusError    = broker.RequestStatusError
+	RequestStatusTimeout  = broker.RequestStatusTimeout
+	RequestStatusCanceled = broker.RequestStatusCanceled
+)
+
+// PublishAndReceive publishes the request and waits for the reply with the same correlation id.
+// The reply topic is subscribed before the request is published, with a consumer group per instance,
+// so the reply reaches the instance waiting for it. With InstanceID, the reply topic is the one of the instance,
+// <reply topic>.<instance id>, see SharedReplyTopic. The replyTo header of the request is the reply topic.
+// The call returns when the reply is received, the timeout expires or the context is done.
+func (k *kBroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (reply *broker.Message, err error) {
+	if msg == nil {
+		return nil, broker.EmptyMessageError{}
+	}
+
+	options := broker.PublishOptions{
+		ReplyToTopic: fmt.Sprintf("%s.reply", topic),
+		Timeout:      RequestReplyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	replyTopic, err := k.subscribeReply(ctx, options.ReplyToTopic, options.ReplyConsumerGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+
+	correlationId, ok := msg.Headers[CorrelationIdHeader]
+	if !ok || len(correlationId) == 0 {
+		correlationId = uuid.New().String()
+		msg.Headers[CorrelationIdHeader] = correlationId
+	}
+	msg.Headers[metadata.HeaderReplyTo] = replyTopic
+
+	// register the pending call before publishing, so that an early reply is not lost
+	replyChan := make(chan *broker.Message, 1)
+	k.resps.Store(correlationId, replyChan)
+	defer k.resps.Delete(correlationId)
+
+	start := time.Now()
+	k.trackInflight(topic, 1)
+	defer func() {
+		k.trackInflight(topic, -1)
+		k.emitRequest(topic, err, time.Since(start))
+	}()
+
+	if err := k.Publish(ctx, topic, msg, opts...); err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if options.Timeout > 0 {
+		timer := time.NewTimer(options.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case reply := <-replyChan:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, broker.RequestTimeoutResponse{
+			Timeout: options.Timeout,
+		}
+	}
+}
+
+// replySubscription is the subscription of a reply topic, ready once subscribed or failed
+type replySubscription struct {
+	ready chan struct{}
+	sub   broker.Subscriber
+	err   error
+}
+
+// subscribeReply subscribes the reply topic once and returns the topic receiving the replies of this instance.
+// The concurrent requests wait for the subscription of their reply topic without blocking the other topics,
+// a failed subscription is retried by the next request.
+func (k *kBroker) subscribeReply(ctx context.Context, topic string, group string) (string, error) {
+	instanceID := k.getInstanceID()
+
+	replyTopic := topic
+	if !k.isSharedReplyTopic() {
+		replyTopic = fmt.Sprintf("%s.%s", topic, instanceID)
+	}
+
+	k.replyMutex.Lock()
+	if k.replySubscribers == nil {
+		k.replySubscribers = make(map[string]*replySubscription)
+	}
+	rs, subscribed := k.replySubscribers[replyTopic]
+	if !subscribed {
+		rs = &replySubscription{ready: make(chan struct{})}
+		k.replySubscribers[replyTopic] = rs
+	}
+	k.replyMutex.Unlock()
+
+	if subscribed {
+		select {
+		case <-rs.ready:
+			return replyTopic, rs.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	if len(group) == 0 {
+		group = topic
+	}
+	rs.sub, rs.err = k.subscribeReplyTopic(replyTopic, fmt.Sprintf("%s.%s", group, instanceID))
+
+	if rs.err != nil {
+		k.replyMutex.Lock()
+		if k.replySubscribers[replyTopic] == rs {
+			delete(k.replySubscribers, replyTopic)
+		}
+		k.replyMutex.Unlock()
+	}
+	close(rs.ready)
+
+	return replyTopic, rs.err
+}
+
+func (k *kBroker) subscribeReplyTopic(replyTopic string, group string) (broker.Subscriber, error) {
+	if err := k.ensureTopics(context.Background(), replyTopic); err != nil {
+		return nil, err
+	}
+	return k.Subscribe(replyTopic, k.handleReply, broker.WithSubscribeGroup(group))
+}
+
+// handleReply passes the reply to the pending call of its correlation id, the other replies are dropped
+func (k *kBroker) handleReply(ctx context.Context, e broker.Event) error {
+	if e.Message() == nil {
+		return nil
+	}
+
+	correlationId, ok := e.Message().Headers[CorrelationIdHeader]
+	if !ok {
+		return nil
+	}
+
+	if replyChan, ok := k.resps.LoadAndDelete(correlationId); ok {
+		replyChan.(chan *broker.Message) <- e.Message()
+	}
+	return nil
+}
+
+func (k *kBroker) trackInflight(topic string, delta int64) {
+	counter, _ := k.inflight.LoadOrStore(topic, new(int64))
+	value := atomic.AddInt64(counter.(*int64), delta)
+
+	k.getMetrics().SetGaugeWithLabels(
+		MetricKeyRequestInflight,
+		float32(value),
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+		},
+	)
+}
+
+func (k *kBroker) emitRequest(topic string, err error, duration time.Duration) {
+	status := broker.RequestStatus(err)
+
+	broker.EmitReplyDuration(k.getMetrics(), topic, status, duration)
+
+	k.getMetrics().IncrCounterWithLabels(
+		MetricKeyRequestTotal,
+		1,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+			{
+				Name:  MetricLabelStatus,
+				Value: status,
+			},
+		},
+	)
+}
+
+func (k *kBroker) getReplyTopics() []string {
+	if topics, ok := k.opts.Context.Value(replyTopicsKey{}).([]string); ok {
+		return topics
+	}
+	return nil
+}
+
+func (k *kBroker) getInstanceID() string {
+	if id, ok := k.opts.Context.Value(instanceIDKey{}).(string); ok && len(id) > 0 {
+		return id
+	}
+	return k.instanceID
+}
+
+// isSharedReplyTopic is true without InstanceID, the random instance id would leave a reply topic behind every restart
+func (k *kBroker) isSharedReplyTopic() bool {
+	if shared, _ := k.opts.Context.Value(sharedReplyTopicKey{}).(bool); shared {
+		return true
+	}
+	id, _ := k.opts.Context.Value(instanceIDKey{}).(string)
+	return len(id) == 0
+}
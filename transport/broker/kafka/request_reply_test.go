@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestRequestReplyBroker returns a broker whose reply topics are subscribed
+// and whose publish is answered by the responder, without kafka
+func newTestRequestReplyBroker(t *testing.T, responder func(k *kBroker, topic string, m *broker.Message), opts ...broker.BrokerOption) *kBroker {
+	var k *kBroker
+
+	opts = append(opts, broker.WithPublishMiddleware(func(next broker.PublishFunc) broker.PublishFunc {
+		return func(ctx context.Context, topic string, m *broker.Message, opts ...broker.PublishOption) error {
+			go responder(k, topic, m)
+			return nil
+		}
+	}))
+
+	k = NewKafkaBroker(append([]broker.BrokerOption{InstanceID("instance-1")}, opts...)...).(*kBroker)
+	k.replySubscribers = map[string]*replySubscription{
+		"test.request.reply":            subscribedReply(),
+		"test.request.reply.instance-1": subscribedReply(),
+	}
+	return k
+}
+
+func subscribedReply() *replySubscription {
+	rs := &replySubscription{ready: make(chan struct{})}
+	close(rs.ready)
+	return rs
+}
+
+func reply(k *kBroker, request *broker.Message, body string) {
+	k.handleReply(context.TODO(), &publication{brokerMessage: &broker.Message{ //nolint
+		Headers: map[string]string{CorrelationIdHeader: request.Headers[CorrelationIdHeader]},
+		Body:    []byte(body),
+	}})
+}
+
+func TestPublishAndReceive(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	m, err := metrics.New(&metrics.Config{FilterDefault: true}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var replyTo string
+	k := newTestRequestReplyBroker(t, func(k *kBroker, topic string, m *broker.Message) {
+		replyTo = m.Headers[metadata.HeaderReplyTo]
+		reply(k, m, "pong")
+	}, broker.WithBrokerMetrics(m))
+
+	res, err := k.PublishAndReceive(context.TODO(), "test.request", &broker.Message{Body: []byte("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "pong", string(res.Body))
+	assert.Equal(t, "test.request.reply.instance-1", replyTo)
+
+	// the pending call is cleaned up
+	var pending int
+	k.resps.Range(func(key, value any) bool {
+		pending++
+		return true
+	})
+	assert.Equal(t, 0, pending)
+
+	var counters, samples []string
+	for _, interval := range sink.Data() {
+		for key := range interval.Counters {
+			counters = append(counters, key)
+		}
+		for key := range interval.Samples {
+			samples = append(samples, key)
+		}
+	}
+	assert.Contains(t, counters, "broker.request.total;topic=test.request;status=success")
+	assert.Contains(t, samples, "broker.client.reply.duration.milliseconds;topic=test.request;status=success")
+}
+
+func TestPublishAndReceiveSharedReplyTopic(t *testing.T) {
+	var replyTo string
+	k := newTestRequestReplyBroker(t, func(k *kBroker, topic string, m *broker.Message) {
+		replyTo = m.Headers[metadata.HeaderReplyTo]
+		reply(k, m, "pong")
+	}, SharedReplyTopic())
+
+	_, err := k.PublishAndReceive(context.TODO(), "test.request", &broker.Message{Body: []byte("ping")})
+	assert.NoError(t, err)
+	assert.Equal(t, "test.request.reply", replyTo)
+}
+
+func TestPublishAndReceiveInvalid(t *testing.T) {
+	k := newTestRequestReplyBroker(t, func(k *kBroker, topic string, m *broker.Message) {})
+
+	_, err := k.PublishAndReceive(context.TODO(), "test.request", nil)
+	assert.ErrorAs(t, err, &broker.EmptyMessageError{})
+}
+
+func TestPublishAndReceiveDefaultInstance(t *testing.T) {
+	k := NewKafkaBroker().(*kBroker)
+	assert.NotEmpty(t, k.getInstanceID())
+	assert.Equal(t, k.getInstanceID(), k.getInstanceID())
+
+	// the replies are received on the shared reply topic, by the group of the instance
+	k.replySubscribers = map[string]*replySubscription{"test.request.reply": subscribedReply()}
+	replyTopic, err := k.subscribeReply(context.TODO(), "test.request.reply", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "test.request.reply", replyTopic)
+}
+
+func TestSubscribeReplyPerTopic(t *testing.T) {
+	k := newTestRequestReplyBroker(t, func(k *kBroker, topic string, m *broker.Message) {})
+
+	// the reply topic being subscribed by another request
+	pending := &replySubscription{ready: make(chan struct{})}
+	k.replySubscribers["test.pending.reply.instance-1"] = pending
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := k.subscribeReply(ctx, "test.pending.reply", "")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the other reply topics are not blocked meanwhile
+	replyTopic, err := k.subscribeReply(context.TODO(), "test.request.reply", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "test.request.reply.instance-1", replyTopic)
+
+	// the requests waiting for the subscription get its result
+	done := make(chan error)
+	go func() {
+		_, err := k.subscribeReply(context.TODO(), "test.pending.reply", "")
+		done <- err
+	}()
+	pending.err = errors.New("unavailable")
+	close(pending.ready)
+	assert.EqualError(t, <-done, "unavailable")
+}
+
+func TestPublishAndReceiveTimeout(t *testing.T) {
+	k := newTestRequestReplyBroker(t, func(k *kBroker, topic string, m *broker.Message) {})
+
+	_, err := k.PublishAndReceive(context.TODO(), "test.request", &broker.Message{}, broker.WithPublishTimeout(10*time.Millisecond))
+	assert.IsType(t, broker.RequestTimeoutResponse{}, err)
+}
+
+func TestPublishAndReceiveContextCanceled(t *testing.T) {
+	k := newTestRequestReplyBroker(t, func(k *kBroker, topic string, m *broker.Message) {})
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := k.PublishAndReceive(ctx, "test.request", &broker.Message{})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// a late reply is dropped
+	assert.NoError(t, k.handleReply(context.TODO(), &publication{brokerMessage: &broker.Message{
+		Headers: map[string]string{CorrelationIdHeader: "unknown"},
+	}}))
+}
@@ -0,0 +1,305 @@
+// Package schemaregistry provides the kafka codecs writing the Confluent schema registry wire format
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SchemaType string
+
+const (
+	SchemaTypeAvro     SchemaType = "AVRO"
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+	SchemaTypeJSON     SchemaType = "JSON"
+
+	contentType = "application/vnd.schemaregistry.v1+json"
+)
+
+var (
+	DefaultTimeout = 10 * time.Second
+
+	ErrNotFound = errors.New("schema registry: not found")
+)
+
+// Reference is a schema imported by another schema
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// Schema is a schema of the registry
+type Schema struct {
+	ID         int         `json:"id,omitempty"`
+	Subject    string      `json:"subject,omitempty"`
+	Version    int         `json:"version,omitempty"`
+	Type       SchemaType  `json:"schemaType,omitempty"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references,omitempty"`
+}
+
+func (s Schema) schemaType() SchemaType {
+	// the registry omits the type of the avro schemas
+	if len(s.Type) == 0 {
+		return SchemaTypeAvro
+	}
+	return s.Type
+}
+
+// Error is an error response of the registry
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("schema registry: %s (status: %d, code: %d)", e.Message, e.StatusCode, e.Code)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Client is a client of the schema registry
+type Client interface {
+	// Register registers the schema under the subject and returns its id,
+	// the id of an already registered schema is returned as is
+	Register(ctx context.Context, subject string, schema Schema) (int, error)
+	// Lookup returns the id of the schema registered under the subject
+	Lookup(ctx context.Context, subject string, schema Schema) (int, error)
+	// GetByID returns the schema of the id
+	GetByID(ctx context.Context, id int) (Schema, error)
+	// GetLatest returns the latest version of the subject
+	GetLatest(ctx context.Context, subject string) (Schema, error)
+	// IsCompatible checks the schema against the latest version of the subject,
+	// with the compatibility level of the subject. A schema is compatible with an unknown subject.
+	IsCompatible(ctx context.Context, subject string, schema Schema) (bool, error)
+}
+
+type ClientOptions struct {
+	// Transport of the http requests, http.DefaultTransport by default.
+	// The tests use the in-process registry of NewMockRegistry.
+	Transport http.RoundTripper
+
+	Timeout time.Duration
+
+	Username string
+	Password string
+}
+
+type ClientOption func(*ClientOptions)
+
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(o *ClientOptions) {
+		o.Transport = transport
+	}
+}
+
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(o *ClientOptions) {
+		o.Timeout = timeout
+	}
+}
+
+func WithBasicAuth(username, password string) ClientOption {
+	return func(o *ClientOptions) {
+		o.Username = username
+		o.Password = password
+	}
+}
+
+type client struct {
+	url     string
+	opts    ClientOptions
+	httpCli *http.Client
+
+	// the schemas of an id and the ids of a subject schema never change
+	mu         sync.RWMutex
+	schemas    map[int]Schema
+	subjectIDs map[string]int
+	lookupIDs  map[string]int
+}
+
+// NewClient returns a client of the registry at url, which caches the schemas and ids
+func NewClient(url string, opts ...ClientOption) Client {
+	options := ClientOptions{
+		Transport: http.DefaultTransport,
+		Timeout:   DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &client{
+		url:  strings.TrimSuffix(url, "/"),
+		opts: options,
+		httpCli: &http.Client{
+			Transport: options.Transport,
+			Timeout:   options.Timeout,
+		},
+		schemas:    make(map[int]Schema),
+		subjectIDs: make(map[string]int),
+		lookupIDs:  make(map[string]int),
+	}
+}
+
+func (c *client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	key := cacheKey(subject, schema)
+	if id, ok := c.cachedID(c.subjectIDs, key); ok {
+		return id, nil
+	}
+
+	var res struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject)), request(schema), &res); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.subjectIDs[key] = res.ID
+	c.mu.Unlock()
+
+	return res.ID, nil
+}
+
+func (c *client) Lookup(ctx context.Context, subject string, schema Schema) (int, error) {
+	key := cacheKey(subject, schema)
+	if id, ok := c.cachedID(c.subjectIDs, key); ok {
+		return id, nil
+	}
+	if id, ok := c.cachedID(c.lookupIDs, key); ok {
+		return id, nil
+	}
+
+	var res Schema
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/subjects/%s", url.PathEscape(subject)), request(schema), &res); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.lookupIDs[key] = res.ID
+	c.mu.Unlock()
+
+	return res.ID, nil
+}
+
+func (c *client) GetByID(ctx context.Context, id int) (Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &schema); err != nil {
+		return Schema{}, err
+	}
+	schema.ID = id
+	schema.Type = schema.schemaType()
+
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+
+	return schema, nil
+}
+
+func (c *client) GetLatest(ctx context.Context, subject string) (Schema, error) {
+	var schema Schema
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/subjects/%s/versions/latest", url.PathEscape(subject)), nil, &schema); err != nil {
+		return Schema{}, err
+	}
+	schema.Type = schema.schemaType()
+	return schema, nil
+}
+
+func (c *client) IsCompatible(ctx context.Context, subject string, schema Schema) (bool, error) {
+	var res struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+
+	err := c.do(ctx, http.MethodPost, fmt.Sprintf("/compatibility/subjects/%s/versions/latest", url.PathEscape(subject)), request(schema), &res)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.IsCompatible, nil
+}
+
+func (c *client) cachedID(ids map[string]int, key string) (int, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	id, ok := ids[key]
+	return id, ok
+}
+
+func (c *client) do(ctx context.Context, method string, path string, body interface{}, res interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if len(c.opts.Username) > 0 {
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+
+	resp, err := c.httpCli.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil {
+			e.Message = http.StatusText(resp.StatusCode)
+		}
+		return e
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// request is the body of the register, lookup and compatibility requests
+func request(schema Schema) Schema {
+	req := Schema{
+		Schema:     schema.Schema,
+		References: schema.References,
+	}
+	if schema.schemaType() != SchemaTypeAvro {
+		req.Type = schema.Type
+	}
+	return req
+}
+
+func cacheKey(subject string, schema Schema) string {
+	return fmt.Sprintf("%s|%s|%s", subject, schema.schemaType(), schema.Schema)
+}
@@ -0,0 +1,209 @@
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/kafka"
+
+	"github.com/IBM/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrIncompatibleSchema = errors.New("schema registry: incompatible schema")
+)
+
+// TopicNameStrategy is the default subject of the topic values: <topic>-value
+func TopicNameStrategy(topic string) string {
+	return fmt.Sprintf("%s-value", topic)
+}
+
+type Options struct {
+	// Subject of the schema of the topic, TopicNameStrategy by default
+	SubjectName func(topic string) string
+
+	// Registers the schema on the first publish to a subject, else the schema must be registered.
+	// Default: true
+	AutoRegister bool
+
+	// Checks the schema against the latest version of the subject before registering it.
+	// Default: true
+	ValidateCompatibility bool
+
+	// Codec of the headers and the key, kafka.DefaultMarshaler by default
+	Codec kafka.Codec
+}
+
+type Option func(*Options)
+
+func WithSubjectName(fn func(topic string) string) Option {
+	return func(o *Options) {
+		o.SubjectName = fn
+	}
+}
+
+func WithAutoRegister(autoRegister bool) Option {
+	return func(o *Options) {
+		o.AutoRegister = autoRegister
+	}
+}
+
+func WithValidateCompatibility(validate bool) Option {
+	return func(o *Options) {
+		o.ValidateCompatibility = validate
+	}
+}
+
+func WithCodec(c kafka.Codec) Option {
+	return func(o *Options) {
+		o.Codec = c
+	}
+}
+
+type codec struct {
+	client Client
+	format Format
+	opts   Options
+
+	// schema id by subject
+	ids sync.Map
+}
+
+// NewCodec returns the kafka codec writing the message bodies in the Confluent wire format:
+// the magic byte, the schema id and the payload of the format.
+// The consumed messages are read with the schema of their id.
+func NewCodec(client Client, format Format, opts ...Option) kafka.Codec {
+	options := Options{
+		SubjectName:           TopicNameStrategy,
+		AutoRegister:          true,
+		ValidateCompatibility: true,
+		Codec:                 kafka.DefaultMarshaler{},
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return &codec{
+		client: client,
+		format: format,
+		opts:   options,
+	}
+}
+
+// NewAvroCodec returns the codec of the avro schema, see NewAvroFormat
+func NewAvroCodec(client Client, schema string, opts ...Option) (kafka.Codec, error) {
+	format, err := NewAvroFormat(schema)
+	if err != nil {
+		return nil, err
+	}
+	return NewCodec(client, format, opts...), nil
+}
+
+// NewJSONSchemaCodec returns the codec of the JSON schema, see NewJSONSchemaFormat
+func NewJSONSchemaCodec(client Client, schema string, opts ...Option) (kafka.Codec, error) {
+	format, err := NewJSONSchemaFormat(schema)
+	if err != nil {
+		return nil, err
+	}
+	return NewCodec(client, format, opts...), nil
+}
+
+// NewProtobufCodec returns the codec of the protobuf message, see NewProtobufFormat
+func NewProtobufCodec(client Client, message proto.Message, schema string, opts ...Option) kafka.Codec {
+	return NewCodec(client, NewProtobufFormat(message, schema), opts...)
+}
+
+func (c *codec) Marshal(topic string, msg *broker.Message) (*sarama.ProducerMessage, error) {
+	id, err := c.schemaID(context.Background(), topic)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := c.format.Encode(msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	kMsg, err := c.opts.Codec.Marshal(topic, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []int
+	if indexer, ok := c.format.(messageIndexer); ok {
+		indexes = indexer.messageIndexes()
+	}
+
+	kMsg.Value = sarama.ByteEncoder(encodeWireFormat(id, indexes, payload))
+	return kMsg, nil
+}
+
+func (c *codec) Unmarshal(kafkaMsg *sarama.ConsumerMessage) (*broker.Message, error) {
+	m, err := c.opts.Codec.Unmarshal(kafkaMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	id, payload, err := decodeWireFormat(m.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := c.client.GetByID(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema %d: %w", id, err)
+	}
+
+	if writer.Type == SchemaTypeProtobuf {
+		if _, payload, err = readMessageIndexes(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.Body, err = c.format.Decode(writer, payload); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// schemaID returns the id of the schema under the subject of the topic,
+// the schema is registered and checked once per subject
+func (c *codec) schemaID(ctx context.Context, topic string) (int, error) {
+	subject := c.opts.SubjectName(topic)
+	if id, ok := c.ids.Load(subject); ok {
+		return id.(int), nil
+	}
+
+	schema := c.format.Schema()
+
+	if !c.opts.AutoRegister {
+		id, err := c.client.Lookup(ctx, subject, schema)
+		if err != nil {
+			return 0, fmt.Errorf("failed to look up the schema of subject %s: %w", subject, err)
+		}
+		c.ids.Store(subject, id)
+		return id, nil
+	}
+
+	if c.opts.ValidateCompatibility {
+		compatible, err := c.client.IsCompatible(ctx, subject, schema)
+		if err != nil {
+			return 0, fmt.Errorf("failed to check the schema compatibility of subject %s: %w", subject, err)
+		}
+		if !compatible {
+			return 0, fmt.Errorf("%w: subject %s", ErrIncompatibleSchema, subject)
+		}
+	}
+
+	id, err := c.client.Register(ctx, subject, schema)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register the schema of subject %s: %w", subject, err)
+	}
+	c.ids.Store(subject, id)
+	return id, nil
+}
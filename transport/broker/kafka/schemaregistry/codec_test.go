@@ -0,0 +1,159 @@
+package schemaregistry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/kafka"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	accountAvroSchema = `{
+		"type": "record",
+		"name": "Account",
+		"fields": [
+			{"name": "id", "type": "string"},
+			{"name": "balance", "type": "long"},
+			{"name": "owner", "type": ["null", "string"], "default": null}
+		]
+	}`
+
+	accountJSONSchema = `{
+		"type": "object",
+		"properties": {
+			"id": {"type": "string"},
+			"balance": {"type": "integer"}
+		},
+		"required": ["id", "balance"]
+	}`
+)
+
+func newTestClient(registry *MockRegistry) Client {
+	return NewClient("http://registry", WithTransport(registry))
+}
+
+// roundTrip marshals and unmarshals the message with the codec
+func roundTrip(t *testing.T, c kafka.Codec, topic string, body string) (*sarama.ProducerMessage, *broker.Message) {
+	kMsg, err := c.Marshal(topic, &broker.Message{Body: []byte(body)})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	value, _ := kMsg.Value.Encode()
+	m, err := c.Unmarshal(&sarama.ConsumerMessage{Topic: topic, Value: value})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return kMsg, m
+}
+
+func TestAvroCodec(t *testing.T) {
+	registry := NewMockRegistry()
+	c, err := NewAvroCodec(newTestClient(registry), accountAvroSchema)
+	assert.NoError(t, err)
+
+	kMsg, m := roundTrip(t, c, "account.created", `{"id":"1","balance":100,"owner":"john"}`)
+	assert.JSONEq(t, `{"id":"1","balance":100,"owner":"john"}`, string(m.Body))
+
+	// the confluent wire format: magic byte and schema id
+	value, _ := kMsg.Value.Encode()
+	assert.Equal(t, []byte{0, 0, 0, 0, 1}, value[:5])
+
+	// the schema is registered under the subject of the topic
+	assert.Len(t, registry.subjects["account.created-value"], 1)
+
+	// the body is validated against the schema
+	_, err = c.Marshal("account.created", &broker.Message{Body: []byte(`{"id":"1"}`)})
+	assert.Error(t, err)
+}
+
+func TestJSONSchemaCodec(t *testing.T) {
+	c, err := NewJSONSchemaCodec(newTestClient(NewMockRegistry()), accountJSONSchema)
+	assert.NoError(t, err)
+
+	_, m := roundTrip(t, c, "account.created", `{"id":"1","balance":100}`)
+	assert.JSONEq(t, `{"id":"1","balance":100}`, string(m.Body))
+
+	_, err = c.Marshal("account.created", &broker.Message{Body: []byte(`{"id":"1","balance":"100"}`)})
+	assert.Error(t, err)
+}
+
+func TestProtobufCodec(t *testing.T) {
+	c := NewProtobufCodec(newTestClient(NewMockRegistry()), &wrapperspb.StringValue{}, `syntax = "proto3"; message StringValue { string value = 1; }`)
+
+	kMsg, m := roundTrip(t, c, "account.name", `"john"`)
+	assert.Equal(t, `"john"`, string(m.Body))
+
+	// StringValue is the 8th message of wrappers.proto
+	value, _ := kMsg.Value.Encode()
+	indexes, _, err := readMessageIndexes(value[5:])
+	assert.NoError(t, err)
+	assert.Equal(t, []int{7}, indexes)
+}
+
+func TestIncompatibleSchema(t *testing.T) {
+	registry := NewMockRegistry()
+	registry.Compatible = func(subject string, latest Schema, schema Schema) bool {
+		return false
+	}
+
+	c, err := NewAvroCodec(newTestClient(registry), accountAvroSchema)
+	assert.NoError(t, err)
+
+	// the first schema of a subject is always compatible
+	_, err = c.Marshal("account.created", &broker.Message{Body: []byte(`{"id":"1","balance":100,"owner":null}`)})
+	assert.NoError(t, err)
+
+	c, err = NewAvroCodec(newTestClient(registry), `{"type":"record","name":"Account","fields":[{"name":"id","type":"long"}]}`)
+	assert.NoError(t, err)
+
+	_, err = c.Marshal("account.created", &broker.Message{Body: []byte(`{"id":1}`)})
+	assert.ErrorIs(t, err, ErrIncompatibleSchema)
+}
+
+func TestLookupWithoutAutoRegister(t *testing.T) {
+	c, err := NewAvroCodec(newTestClient(NewMockRegistry()), accountAvroSchema, WithAutoRegister(false))
+	assert.NoError(t, err)
+
+	_, err = c.Marshal("account.created", &broker.Message{Body: []byte(`{"id":"1","balance":100,"owner":null}`)})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestClientCache(t *testing.T) {
+	registry := NewMockRegistry()
+	client := newTestClient(registry)
+
+	schema := Schema{Type: SchemaTypeJSON, Schema: accountJSONSchema}
+	id, err := client.Register(context.TODO(), "account-value", schema)
+	assert.NoError(t, err)
+
+	requests := registry.Requests()
+	for i := 0; i < 3; i++ {
+		_, err := client.Register(context.TODO(), "account-value", schema)
+		assert.NoError(t, err)
+
+		res, err := client.GetByID(context.TODO(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, SchemaTypeJSON, res.Type)
+	}
+
+	// the first GetByID only
+	assert.Equal(t, requests+1, registry.Requests())
+
+	latest, err := client.GetLatest(context.TODO(), "account-value")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, latest.Version)
+}
+
+func TestInvalidWireFormat(t *testing.T) {
+	c, err := NewAvroCodec(newTestClient(NewMockRegistry()), accountAvroSchema)
+	assert.NoError(t, err)
+
+	_, err = c.Unmarshal(&sarama.ConsumerMessage{Value: []byte(`{"id":"1"}`)})
+	assert.ErrorIs(t, err, ErrInvalidWireFormat)
+}
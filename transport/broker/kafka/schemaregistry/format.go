@@ -0,0 +1,199 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Format converts the JSON bodies of the broker messages from and to the payloads of a schema type
+type Format interface {
+	// Schema returns the schema registered for the topics
+	Schema() Schema
+	// Encode validates the body against the schema and returns the payload
+	Encode(body []byte) ([]byte, error)
+	// Decode returns the body of the payload written with the writer schema
+	Decode(writer Schema, payload []byte) ([]byte, error)
+}
+
+// messageIndexer is implemented by the protobuf format, whose payloads
+// are prefixed with the indexes of the message in the schema
+type messageIndexer interface {
+	messageIndexes() []int
+}
+
+type avroFormat struct {
+	schema Schema
+	codec  *goavro.Codec
+
+	// codecs of the writer schemas by id
+	writers sync.Map
+}
+
+// NewAvroFormat returns the avro format of the schema.
+// The bodies are the standard JSON of the avro values, a union is its value or null.
+func NewAvroFormat(schema string, references ...Reference) (Format, error) {
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema: %w", err)
+	}
+
+	return &avroFormat{
+		schema: Schema{
+			Type:       SchemaTypeAvro,
+			Schema:     schema,
+			References: references,
+		},
+		codec: codec,
+	}, nil
+}
+
+func (f *avroFormat) Schema() Schema {
+	return f.schema
+}
+
+func (f *avroFormat) Encode(body []byte) ([]byte, error) {
+	native, _, err := f.codec.NativeFromTextual(body)
+	if err != nil {
+		return nil, fmt.Errorf("body does not match the avro schema: %w", err)
+	}
+	return f.codec.BinaryFromNative(nil, native)
+}
+
+func (f *avroFormat) Decode(writer Schema, payload []byte) ([]byte, error) {
+	codec, err := f.writerCodec(writer)
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("payload does not match the avro schema %d: %w", writer.ID, err)
+	}
+	return codec.TextualFromNative(nil, native)
+}
+
+func (f *avroFormat) writerCodec(writer Schema) (*goavro.Codec, error) {
+	if writer.ID == 0 || writer.Schema == f.schema.Schema {
+		return f.codec, nil
+	}
+
+	if codec, ok := f.writers.Load(writer.ID); ok {
+		return codec.(*goavro.Codec), nil
+	}
+
+	codec, err := goavro.NewCodecForStandardJSONFull(writer.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid avro schema %d: %w", writer.ID, err)
+	}
+	f.writers.Store(writer.ID, codec)
+	return codec, nil
+}
+
+type protobufFormat struct {
+	schema  Schema
+	message protoreflect.MessageType
+	indexes []int
+}
+
+// NewProtobufFormat returns the protobuf format of the message, schema is the .proto source of its file.
+// The bodies are the protojson of the message.
+func NewProtobufFormat(message proto.Message, schema string, references ...Reference) Format {
+	descriptor := message.ProtoReflect().Descriptor()
+
+	// the indexes of the message and its parent messages in the file
+	var indexes []int
+	for d := protoreflect.Descriptor(descriptor); d != nil; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		indexes = append([]int{d.Index()}, indexes...)
+	}
+
+	return &protobufFormat{
+		schema: Schema{
+			Type:       SchemaTypeProtobuf,
+			Schema:     schema,
+			References: references,
+		},
+		message: message.ProtoReflect().Type(),
+		indexes: indexes,
+	}
+}
+
+func (f *protobufFormat) Schema() Schema {
+	return f.schema
+}
+
+func (f *protobufFormat) Encode(body []byte) ([]byte, error) {
+	m := f.message.New().Interface()
+	if err := protojson.Unmarshal(body, m); err != nil {
+		return nil, fmt.Errorf("body does not match the protobuf message %s: %w", f.message.Descriptor().FullName(), err)
+	}
+	return proto.Marshal(m)
+}
+
+// Decode reads the payload with the message of the format, the protobuf messages are forward and backward compatible
+func (f *protobufFormat) Decode(writer Schema, payload []byte) ([]byte, error) {
+	m := f.message.New().Interface()
+	if err := proto.Unmarshal(payload, m); err != nil {
+		return nil, fmt.Errorf("payload does not match the protobuf message %s: %w", f.message.Descriptor().FullName(), err)
+	}
+	return protojson.Marshal(m)
+}
+
+func (f *protobufFormat) messageIndexes() []int {
+	return f.indexes
+}
+
+type jsonFormat struct {
+	schema    Schema
+	validator *jsonschema.Schema
+}
+
+// NewJSONSchemaFormat returns the JSON schema format of the schema, the bodies are validated and kept as is
+func NewJSONSchemaFormat(schema string, references ...Reference) (Format, error) {
+	validator, err := jsonschema.CompileString("schema.json", schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+
+	return &jsonFormat{
+		schema: Schema{
+			Type:       SchemaTypeJSON,
+			Schema:     schema,
+			References: references,
+		},
+		validator: validator,
+	}, nil
+}
+
+func (f *jsonFormat) Schema() Schema {
+	return f.schema
+}
+
+func (f *jsonFormat) Encode(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("body is not JSON: %w", err)
+	}
+
+	if err := f.validator.Validate(v); err != nil {
+		return nil, fmt.Errorf("body does not match the JSON schema: %w", err)
+	}
+	return body, nil
+}
+
+func (f *jsonFormat) Decode(writer Schema, payload []byte) ([]byte, error) {
+	return payload, nil
+}
@@ -0,0 +1,154 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MockRegistry is an in-process schema registry, used as the transport of the client in the tests:
+//
+//	client := schemaregistry.NewClient("http://registry", schemaregistry.WithTransport(schemaregistry.NewMockRegistry()))
+type MockRegistry struct {
+	// Compatible checks the schema against the latest version of the subject,
+	// every schema is compatible by default
+	Compatible func(subject string, latest Schema, schema Schema) bool
+
+	mu       sync.Mutex
+	schemas  []Schema            // by id - 1
+	subjects map[string][]Schema // versions by subject
+	requests int
+}
+
+func NewMockRegistry() *MockRegistry {
+	return &MockRegistry{
+		subjects: make(map[string][]Schema),
+	}
+}
+
+// Requests returns the number of requests served by the registry
+func (r *MockRegistry) Requests() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *MockRegistry) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// ServeHTTP implements http.Handler, it serves the subset of the registry API used by the client.
+func (r *MockRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests++
+
+	var body Schema
+	if req.Body != nil && req.Method == http.MethodPost {
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, 42201, err.Error())
+			return
+		}
+	}
+
+	path := strings.Split(strings.Trim(req.URL.EscapedPath(), "/"), "/")
+	for i := range path {
+		path[i], _ = url.PathUnescape(path[i])
+	}
+
+	switch {
+	// GET /schemas/ids/{id}
+	case req.Method == http.MethodGet && len(path) == 3 && path[0] == "schemas" && path[1] == "ids":
+		id, _ := strconv.Atoi(path[2])
+		if id <= 0 || id > len(r.schemas) {
+			writeError(w, http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		schema := r.schemas[id-1]
+		writeJSON(w, Schema{Type: schema.Type, Schema: schema.Schema, References: schema.References})
+
+	// POST /subjects/{subject}/versions
+	case req.Method == http.MethodPost && len(path) == 3 && path[0] == "subjects" && path[2] == "versions":
+		writeJSON(w, map[string]int{"id": r.register(path[1], body)})
+
+	// POST /subjects/{subject}
+	case req.Method == http.MethodPost && len(path) == 2 && path[0] == "subjects":
+		for _, version := range r.subjects[path[1]] {
+			if version.schemaType() == body.schemaType() && version.Schema == body.Schema {
+				writeJSON(w, version)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, 40403, "Schema not found")
+
+	// GET /subjects/{subject}/versions/latest
+	case req.Method == http.MethodGet && len(path) == 4 && path[0] == "subjects" && path[3] == "latest":
+		versions := r.subjects[path[1]]
+		if len(versions) == 0 {
+			writeError(w, http.StatusNotFound, 40401, "Subject not found")
+			return
+		}
+		writeJSON(w, versions[len(versions)-1])
+
+	// POST /compatibility/subjects/{subject}/versions/latest
+	case req.Method == http.MethodPost && len(path) == 5 && path[0] == "compatibility":
+		versions := r.subjects[path[2]]
+		if len(versions) == 0 {
+			writeError(w, http.StatusNotFound, 40401, "Subject not found")
+			return
+		}
+		compatible := r.Compatible == nil || r.Compatible(path[2], versions[len(versions)-1], body)
+		writeJSON(w, map[string]bool{"is_compatible": compatible})
+
+	default:
+		writeError(w, http.StatusNotFound, 404, "Not found")
+	}
+}
+
+// register returns the id of the schema, the same schema has the same id in every subject
+func (r *MockRegistry) register(subject string, schema Schema) int {
+	schema.Type = schema.schemaType()
+
+	id := 0
+	for i, s := range r.schemas {
+		if s.Type == schema.Type && s.Schema == schema.Schema {
+			id = i + 1
+			break
+		}
+	}
+	if id == 0 {
+		r.schemas = append(r.schemas, schema)
+		id = len(r.schemas)
+	}
+
+	for _, version := range r.subjects[subject] {
+		if version.ID == id {
+			return id
+		}
+	}
+
+	schema.ID = id
+	schema.Subject = subject
+	schema.Version = len(r.subjects[subject]) + 1
+	r.subjects[subject] = append(r.subjects[subject], schema)
+
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	json.NewEncoder(w).Encode(v) //nolint
+}
+
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&Error{Code: code, Message: message}) //nolint
+}
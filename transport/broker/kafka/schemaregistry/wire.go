@@ -0,0 +1,74 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	magicByte byte = 0
+)
+
+var (
+	ErrInvalidWireFormat = errors.New("schema registry: invalid wire format")
+)
+
+// encodeWireFormat writes the magic byte, the schema id and the payload.
+// The protobuf payloads are prefixed with the indexes of their message in the schema.
+func encodeWireFormat(id int, indexes []int, payload []byte) []byte {
+	data := make([]byte, 5, 5+len(payload)+2)
+	data[0] = magicByte
+	binary.BigEndian.PutUint32(data[1:5], uint32(id))
+
+	if indexes != nil {
+		data = appendMessageIndexes(data, indexes)
+	}
+
+	return append(data, payload...)
+}
+
+// decodeWireFormat returns the schema id and the payload
+func decodeWireFormat(data []byte) (int, []byte, error) {
+	if len(data) < 5 || data[0] != magicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// appendMessageIndexes writes the message indexes as zigzag varints, preceded by their count.
+// The first message of the schema, the most common case, is written as a single 0.
+func appendMessageIndexes(data []byte, indexes []int) []byte {
+	if len(indexes) == 1 && indexes[0] == 0 {
+		return binary.AppendVarint(data, 0)
+	}
+
+	data = binary.AppendVarint(data, int64(len(indexes)))
+	for _, index := range indexes {
+		data = binary.AppendVarint(data, int64(index))
+	}
+	return data
+}
+
+// readMessageIndexes returns the message indexes and the protobuf payload after them
+func readMessageIndexes(data []byte) ([]int, []byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, nil, ErrInvalidWireFormat
+	}
+	data = data[n:]
+
+	if count == 0 {
+		return []int{0}, data, nil
+	}
+
+	indexes := make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		index, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, nil, ErrInvalidWireFormat
+		}
+		indexes = append(indexes, int(index))
+		data = data[n:]
+	}
+	return indexes, data, nil
+}
@@ -0,0 +1,135 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+var (
+	ErrNotTransactional = errors.New("kafka broker is not transactional")
+)
+
+// Transactor is implemented by the kafka broker, see Transactional
+type Transactor interface {
+	// WithinTransaction publishes the messages of fn in one kafka transaction,
+	// committed when fn succeeds and aborted when it fails.
+	// The transactions of the broker run one at a time.
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txnKey struct{}
+
+type kafkaTxn struct {
+	producer sarama.SyncProducer
+}
+
+func extractTxn(ctx context.Context) *kafkaTxn {
+	if txn, ok := ctx.Value(txnKey{}).(*kafkaTxn); ok {
+		return txn
+	}
+	return nil
+}
+
+// WithinTransaction implements Transactor.
+func (k *kBroker) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	// join the transaction of the context
+	if extractTxn(ctx) != nil {
+		return fn(ctx)
+	}
+
+	if !k.isTransactional() {
+		return ErrNotTransactional
+	}
+
+	k.txnMutex.Lock()
+	defer k.txnMutex.Unlock()
+
+	producer, err := k.getSyncProducer()
+	if err != nil {
+		return err
+	}
+
+	if err := producer.BeginTxn(); err != nil {
+		return fmt.Errorf("failed to begin kafka transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			producer.AbortTxn() //nolint
+			panic(p)
+		} else if err != nil {
+			if abortErr := producer.AbortTxn(); abortErr != nil {
+				err = fmt.Errorf("%w, failed to abort kafka transaction: %v", err, abortErr)
+			}
+		} else if commitErr := producer.CommitTxn(); commitErr != nil {
+			// the transaction can be aborted unless the producer is fenced or in a fatal state
+			if producer.TxnStatus()&sarama.ProducerTxnFlagAbortableError != 0 {
+				producer.AbortTxn() //nolint
+			}
+			err = fmt.Errorf("failed to commit kafka transaction: %w", commitErr)
+		}
+	}()
+
+	err = fn(context.WithValue(ctx, txnKey{}, &kafkaTxn{producer: producer}))
+	return err
+}
+
+// addMessageToTxn commits the offset of the consumed message with the transaction of the context
+func addMessageToTxn(ctx context.Context, msg *sarama.ConsumerMessage, group string) error {
+	txn := extractTxn(ctx)
+	if txn == nil {
+		return ErrNotTransactional
+	}
+
+	if err := txn.producer.AddMessageToTxn(msg, group, nil); err != nil {
+		return fmt.Errorf("failed to add consumed offset to kafka transaction: %w", err)
+	}
+	return nil
+}
+
+func (k *kBroker) isTransactional() bool {
+	return len(k.getTransactionalID()) > 0
+}
+
+func (k *kBroker) getTransactionalID() string {
+	if id, ok := k.opts.Context.Value(transactionalIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// transactionalProducerConfig returns a copy of the config with the settings required by the transactions
+func transactionalProducerConfig(c *sarama.Config, transactionalID string) *sarama.Config {
+	config := *c
+	config.Producer.Transaction.ID = transactionalID
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Net.MaxOpenRequests = 1
+
+	if config.Producer.Retry.Max == 0 {
+		config.Producer.Retry.Max = 1
+	}
+
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		config.Version = sarama.V0_11_0_0
+	}
+
+	return &config
+}
+
+// exactlyOnceConsumerConfig returns a copy of the config reading the committed messages only,
+// the offsets are committed by the transactions
+func exactlyOnceConsumerConfig(c *sarama.Config) *sarama.Config {
+	config := *c
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	config.Consumer.Offsets.AutoCommit.Enable = false
+
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		config.Version = sarama.V0_11_0_0
+	}
+
+	return &config
+}
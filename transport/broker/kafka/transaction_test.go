@@ -0,0 +1,203 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionalProducerConfig(t *testing.T) {
+	c := sarama.NewConfig()
+	c.Version = sarama.V0_10_2_0
+	c.Producer.Return.Successes = true
+
+	config := transactionalProducerConfig(c, "payment-service-0")
+
+	assert.Equal(t, "payment-service-0", config.Producer.Transaction.ID)
+	assert.True(t, config.Producer.Idempotent)
+	assert.True(t, config.Version.IsAtLeast(sarama.V0_11_0_0))
+	assert.NoError(t, config.Validate())
+
+	// the given config is not modified
+	assert.Empty(t, c.Producer.Transaction.ID)
+	assert.False(t, c.Producer.Idempotent)
+}
+
+func TestExactlyOnceConsumerConfig(t *testing.T) {
+	c := sarama.NewConfig()
+	config := exactlyOnceConsumerConfig(c)
+
+	assert.Equal(t, sarama.ReadCommitted, config.Consumer.IsolationLevel)
+	assert.False(t, config.Consumer.Offsets.AutoCommit.Enable)
+	assert.True(t, c.Consumer.Offsets.AutoCommit.Enable)
+	assert.NoError(t, config.Validate())
+}
+
+func TestNotTransactional(t *testing.T) {
+	br := NewKafkaBroker()
+
+	err := br.(Transactor).WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNotTransactional)
+
+	_, err = br.Subscribe("test.exactly.once", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, ExactlyOnce())
+	assert.ErrorIs(t, err, ErrNotTransactional)
+}
+
+// fakeTxnProducer records the transaction calls, AddMessageToTxn fails with addErr
+type fakeTxnProducer struct {
+	sarama.SyncProducer
+	mu      sync.Mutex
+	calls   []string
+	open    int
+	maxOpen int
+	addErr  error
+}
+
+func (p *fakeTxnProducer) record(call string, delta int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call)
+	p.open += delta
+	if p.open > p.maxOpen {
+		p.maxOpen = p.open
+	}
+}
+
+func (p *fakeTxnProducer) BeginTxn() error {
+	p.record("begin", 1)
+	return nil
+}
+
+func (p *fakeTxnProducer) CommitTxn() error {
+	p.record("commit", -1)
+	return nil
+}
+
+func (p *fakeTxnProducer) AbortTxn() error {
+	p.record("abort", -1)
+	return nil
+}
+
+func (p *fakeTxnProducer) Close() error {
+	return nil
+}
+
+func (p *fakeTxnProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupId string, metadata *string) error {
+	p.record("add", 0)
+	return p.addErr
+}
+
+func newTestTransactor(producer sarama.SyncProducer) *kBroker {
+	k := NewKafkaBroker(Transactional("test-txn")).(*kBroker)
+	k.syncProducer = producer
+	return k
+}
+
+func TestWithinTransactionCommit(t *testing.T) {
+	producer := &fakeTxnProducer{}
+	k := newTestTransactor(producer)
+
+	err := k.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		// the nested transactions join the transaction of the context
+		return k.WithinTransaction(ctx, func(ctx context.Context) error {
+			return addMessageToTxn(ctx, &sarama.ConsumerMessage{Topic: "test.txn"}, "test-group")
+		})
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"begin", "add", "commit"}, producer.calls)
+}
+
+func TestWithinTransactionAbort(t *testing.T) {
+	errHandler := errors.New("handler failed")
+	errAdd := errors.New("add failed")
+
+	tests := []struct {
+		name    string
+		addErr  error
+		handler func(ctx context.Context) error
+		calls   []string
+		err     error
+	}{
+		{
+			name:    "handler error",
+			handler: func(ctx context.Context) error { return errHandler },
+			calls:   []string{"begin", "abort"},
+			err:     errHandler,
+		},
+		{
+			name:   "add message error",
+			addErr: errAdd,
+			handler: func(ctx context.Context) error {
+				return addMessageToTxn(ctx, &sarama.ConsumerMessage{Topic: "test.txn"}, "test-group")
+			},
+			calls: []string{"begin", "add", "abort"},
+			err:   errAdd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &fakeTxnProducer{addErr: tt.addErr}
+			k := newTestTransactor(producer)
+
+			err := k.WithinTransaction(context.TODO(), tt.handler)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.calls, producer.calls)
+		})
+	}
+}
+
+func TestWithinTransactionSerialized(t *testing.T) {
+	producer := &fakeTxnProducer{}
+	k := newTestTransactor(producer)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, k.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+				time.Sleep(time.Millisecond)
+				return nil
+			}))
+		}()
+	}
+	wg.Wait()
+
+	// the transactions of the broker do not overlap
+	assert.Equal(t, 1, producer.maxOpen)
+	assert.Len(t, producer.calls, 16)
+}
+
+func TestWithinTransactionWhileDisconnecting(t *testing.T) {
+	k := newTestTransactor(&fakeTxnProducer{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the transactions after the disconnect fail without producer
+			for j := 0; j < 100; j++ {
+				k.WithinTransaction(context.TODO(), func(ctx context.Context) error { return nil }) //nolint
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, k.disconnect())
+	wg.Wait()
+
+	assert.Error(t, k.WithinTransaction(context.TODO(), func(ctx context.Context) error { return nil }))
+}
@@ -0,0 +1,448 @@
+// Package memory provides an in-process broker used for tests and local development
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+const (
+	CorrelationIdHeader = "correlationId"
+)
+
+var (
+	RequestReplyTimeout = time.Second * 60
+
+	ErrNotConnected = errors.New("memory broker is not connected")
+)
+
+// Inspector exposes the messages recorded by the memory broker,
+// so that tests can assert on what has been published.
+type Inspector interface {
+	// Published returns a copy of the messages published to the topic, in publish order
+	Published(topic string) []*broker.Message
+	// Topics returns the topics that received at least one message
+	Topics() []string
+	// Unacked returns the number of delivered messages that were not acked yet
+	Unacked(topic string) int
+	// Reset drops all the recorded messages
+	Reset()
+}
+
+type memoryBroker struct {
+	opts broker.BrokerOptions
+
+	mtx         sync.RWMutex
+	connected   bool
+	subscribers map[string][]*subscriber
+	cursors     map[string]int
+	published   map[string][]*broker.Message
+	unacked     map[string]int
+
+	// request-reply patterns
+	resps           sync.Map
+	respSubscribers sync.Map
+}
+
+// NewBroker returns an in-process broker.
+// Messages are delivered synchronously in the publisher goroutine, so
+// once Publish returns every subscriber has handled the message.
+func NewBroker(opts ...broker.BrokerOption) broker.Broker {
+	options := broker.NewBrokerOptions(opts...)
+
+	return &memoryBroker{
+		opts:        options,
+		subscribers: make(map[string][]*subscriber),
+		cursors:     make(map[string]int),
+		published:   make(map[string][]*broker.Message),
+		unacked:     make(map[string]int),
+	}
+}
+
+type subscriber struct {
+	id      string
+	mb      *memoryBroker
+	topic   string
+	handler broker.Handler
+	opts    broker.SubscribeOptions
+}
+
+type publication struct {
+	mb        *memoryBroker
+	topic     string
+	message   *broker.Message
+	err       error
+	timestamp time.Time
+	acked     bool
+	mtx       sync.Mutex
+}
+
+func (p *publication) Topic() string {
+	return p.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.message
+}
+
+func (p *publication) Ack() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	if p.acked {
+		return nil
+	}
+	p.acked = true
+
+	p.mb.mtx.Lock()
+	p.mb.unacked[p.topic]--
+	p.mb.mtx.Unlock()
+
+	return nil
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+func (p *publication) Timestamp() time.Time {
+	return p.timestamp
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+func (s *subscriber) Unsubscribe() error {
+	m := s.mb
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	subs := m.subscribers[s.topic]
+	for i, sub := range subs {
+		if sub.id == s.id {
+			m.subscribers[s.topic] = append(subs[:i], subs[i+1:]...)
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (m *memoryBroker) Init(opts ...broker.BrokerOption) error {
+	for _, o := range opts {
+		o(&m.opts)
+	}
+	return nil
+}
+
+func (m *memoryBroker) Options() broker.BrokerOptions {
+	return m.opts
+}
+
+func (m *memoryBroker) Address() string {
+	return "memory"
+}
+
+func (m *memoryBroker) Connect() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.connected = true
+	return nil
+}
+
+func (m *memoryBroker) Disconnect() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.connected = false
+	m.subscribers = make(map[string][]*subscriber)
+	m.cursors = make(map[string]int)
+
+	// request-reply pattern
+	m.resps = sync.Map{}
+	m.respSubscribers = sync.Map{}
+
+	return nil
+}
+
+func (m *memoryBroker) Publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	publish := broker.ChainPublishMiddleware(m.publish, m.opts.PublishMiddlewares...)
+	return publish(ctx, topic, msg, opts...)
+}
+
+func (m *memoryBroker) publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	_ = broker.NewPublishOptions(opts...)
+
+	if msg == nil {
+		return broker.EmptyMessageError{}
+	}
+
+	if len(msg.Headers) == 0 {
+		msg.Headers = make(map[string]string)
+	}
+
+	if correlationId, ok := msg.Headers[CorrelationIdHeader]; !ok || len(correlationId) == 0 {
+		msg.Headers[CorrelationIdHeader] = uuid.New().String()
+	}
+
+	m.mtx.Lock()
+	if !m.connected {
+		m.mtx.Unlock()
+		return ErrNotConnected
+	}
+
+	m.published[topic] = append(m.published[topic], copyMessage(msg))
+	targets := m.route(topic)
+	m.unacked[topic] += len(targets)
+	m.mtx.Unlock()
+
+	if hook, ok := m.opts.Context.Value(publishHookKey{}).(PublishHookFunc); ok {
+		hook(ctx, topic, copyMessage(msg))
+	}
+
+	for _, sub := range targets {
+		m.deliver(ctx, sub, msg)
+	}
+
+	return nil
+}
+
+// route picks one subscriber per consumer group, round robin inside the group.
+// Must be called with the lock held.
+func (m *memoryBroker) route(topic string) []*subscriber {
+	groups := make(map[string][]*subscriber)
+	var names []string
+	for _, sub := range m.subscribers[topic] {
+		if _, ok := groups[sub.opts.Group]; !ok {
+			names = append(names, sub.opts.Group)
+		}
+		groups[sub.opts.Group] = append(groups[sub.opts.Group], sub)
+	}
+
+	targets := make([]*subscriber, 0, len(names))
+	for _, name := range names {
+		members := groups[name]
+		cursorKey := topic + "/" + name
+		cursor := m.cursors[cursorKey]
+		targets = append(targets, members[cursor%len(members)])
+		m.cursors[cursorKey] = cursor + 1
+	}
+
+	return targets
+}
+
+func (m *memoryBroker) deliver(ctx context.Context, sub *subscriber, msg *broker.Message) {
+	p := &publication{
+		mb:        m,
+		topic:     sub.topic,
+		message:   copyMessage(msg),
+		timestamp: time.Now(),
+	}
+
+	err := sub.handler(ctx, p)
+	if err == nil && sub.opts.AutoAck {
+		p.Ack() //nolint
+	} else if err != nil {
+		p.err = err
+		errHandler := m.opts.ErrorHandler
+		if errHandler != nil {
+			errHandler(ctx, p) //nolint
+		} else {
+			m.log(ctx, logger.ErrorLevel, "[memory] subscriber error: %v", err)
+		}
+	}
+}
+
+func (m *memoryBroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (*broker.Message, error) {
+	options := broker.PublishOptions{
+		ReplyToTopic: fmt.Sprintf("%s.reply", topic),
+		Timeout:      RequestReplyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if msg == nil {
+		return nil, broker.EmptyMessageError{}
+	}
+
+	if len(msg.Headers) == 0 {
+		msg.Headers = make(map[string]string)
+	}
+
+	correlationId, ok := msg.Headers[CorrelationIdHeader]
+	if !ok || len(correlationId) == 0 {
+		correlationId = uuid.New().String()
+		msg.Headers[CorrelationIdHeader] = correlationId
+	}
+	msg.Headers[metadata.HeaderReplyTo] = options.ReplyToTopic
+
+	// subscribe before publishing, so a synchronous reply is never lost
+	if err := m.subscribeReplyTopic(options.ReplyToTopic, options.ReplyConsumerGroup); err != nil {
+		return nil, err
+	}
+
+	msgChan := make(chan *broker.Message, 1)
+	m.resps.Store(correlationId, msgChan)
+	defer m.resps.Delete(correlationId)
+
+	if err := m.Publish(ctx, topic, msg, opts...); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(options.Timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-msgChan:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, broker.RequestTimeoutResponse{
+			Timeout: options.Timeout,
+		}
+	}
+}
+
+func (m *memoryBroker) subscribeReplyTopic(replyTopic string, replyConsumerGroup string) error {
+	if _, ok := m.respSubscribers.LoadOrStore(replyTopic, true); ok {
+		return nil
+	}
+
+	var subOpts = make([]broker.SubscribeOption, 0)
+	if len(replyConsumerGroup) != 0 {
+		subOpts = append(subOpts, broker.WithSubscribeGroup(replyConsumerGroup))
+	}
+
+	_, err := m.Subscribe(replyTopic, func(ctx context.Context, e broker.Event) error {
+		if e.Message() == nil {
+			return nil
+		}
+
+		cId, ok := e.Message().Headers[CorrelationIdHeader]
+		if !ok {
+			return nil
+		}
+
+		if msgChan, ok := m.resps.LoadAndDelete(cId); ok {
+			msgChan.(chan *broker.Message) <- e.Message()
+		}
+		return nil
+	}, subOpts...)
+
+	if err != nil {
+		m.respSubscribers.Delete(replyTopic)
+	}
+
+	return err
+}
+
+func (m *memoryBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	opt := broker.NewSubscribeOptions(opts...)
+
+	// retry topics & dead-letter queue
+	if opt.Retry != nil {
+		return broker.SubscribeWithRetry(m, topic, handler, opts...)
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if !m.connected {
+		return nil, ErrNotConnected
+	}
+
+	sub := &subscriber{
+		id:      uuid.New().String(),
+		mb:      m,
+		topic:   topic,
+		handler: broker.WrapHandler(handler, m.opts, opt),
+		opts:    opt,
+	}
+	m.subscribers[topic] = append(m.subscribers[topic], sub)
+
+	return sub, nil
+}
+
+func (m *memoryBroker) String() string {
+	return "memory"
+}
+
+func (m *memoryBroker) Published(topic string) []*broker.Message {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	msgs := make([]*broker.Message, 0, len(m.published[topic]))
+	for _, msg := range m.published[topic] {
+		msgs = append(msgs, copyMessage(msg))
+	}
+	return msgs
+}
+
+func (m *memoryBroker) Topics() []string {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	topics := make([]string, 0, len(m.published))
+	for topic := range m.published {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (m *memoryBroker) Unacked(topic string) int {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	return m.unacked[topic]
+}
+
+func (m *memoryBroker) Reset() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.published = make(map[string][]*broker.Message)
+	m.unacked = make(map[string]int)
+}
+
+func (m *memoryBroker) log(ctx context.Context, level logger.Level, message string, args ...interface{}) {
+	m.getLogger().Logf(ctx, level, message, args...)
+}
+
+func (m *memoryBroker) getLogger() logger.Logger {
+	if m.opts.Logger != nil {
+		return m.opts.Logger
+	}
+	return logger.DefaultLogger
+}
+
+func copyMessage(msg *broker.Message) *broker.Message {
+	headers := make(map[string]string, len(msg.Headers))
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+
+	return &broker.Message{
+		Headers: headers,
+		Body:    append([]byte(nil), msg.Body...),
+		Key:     append([]byte(nil), msg.Key...),
+	}
+}
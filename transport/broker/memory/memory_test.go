@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMemoryBroker(t *testing.T, opts ...broker.BrokerOption) broker.Broker {
+	br := NewBroker(opts...)
+	if err := br.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return br
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	var received []string
+	_, err := br.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		received = append(received, string(e.Message().Body))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"1", "2", "3"} {
+		if err := br.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Equal(t, []string{"1", "2", "3"}, received)
+	assert.Equal(t, 0, br.(Inspector).Unacked("test.topic"))
+}
+
+func TestConsumerGroups(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	counts := map[string]int{}
+	subscribe := func(name string, group string) {
+		_, err := br.Subscribe("test.group", func(ctx context.Context, e broker.Event) error {
+			counts[name]++
+			return nil
+		}, broker.WithSubscribeGroup(group))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	subscribe("a1", "a")
+	subscribe("a2", "a")
+	subscribe("b1", "b")
+
+	for i := 0; i < 4; i++ {
+		if err := br.Publish(context.TODO(), "test.group", &broker.Message{Body: []byte("body")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Equal(t, 2, counts["a1"])
+	assert.Equal(t, 2, counts["a2"])
+	assert.Equal(t, 4, counts["b1"])
+}
+
+func TestManualAckAndErrorHandler(t *testing.T) {
+	var handledErr error
+	br := getMemoryBroker(t, broker.WithBrokerErrorHandler(func(ctx context.Context, e broker.Event) error {
+		handledErr = e.Error()
+		return nil
+	}))
+
+	errFailed := errors.New("failed")
+	_, err := br.Subscribe("test.ack", func(ctx context.Context, e broker.Event) error {
+		if string(e.Message().Body) == "fail" {
+			return errFailed
+		}
+		return e.Ack()
+	}, broker.WithSubscribeAutoAck(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	br.Publish(context.TODO(), "test.ack", &broker.Message{Body: []byte("ok")})   //nolint
+	br.Publish(context.TODO(), "test.ack", &broker.Message{Body: []byte("fail")}) //nolint
+
+	assert.Equal(t, 1, br.(Inspector).Unacked("test.ack"))
+	assert.ErrorIs(t, handledErr, errFailed)
+}
+
+func TestUnsubscribe(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	count := 0
+	sub, err := br.Subscribe("test.unsubscribe", func(ctx context.Context, e broker.Event) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	br.Publish(context.TODO(), "test.unsubscribe", &broker.Message{Body: []byte("1")}) //nolint
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	br.Publish(context.TODO(), "test.unsubscribe", &broker.Message{Body: []byte("2")}) //nolint
+
+	assert.Equal(t, 1, count)
+	assert.Len(t, br.(Inspector).Published("test.unsubscribe"), 2)
+}
+
+func TestPublishAndReceive(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	_, err := br.Subscribe("test.request", func(ctx context.Context, e broker.Event) error {
+		msg := e.Message()
+		return br.Publish(ctx, msg.Headers[metadata.HeaderReplyTo], &broker.Message{
+			Headers: msg.Headers,
+			Body:    append([]byte("reply:"), msg.Body...),
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := br.PublishAndReceive(context.TODO(), "test.request", &broker.Message{
+		Body: []byte("ping"),
+	}, broker.WithPublishTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "reply:ping", string(reply.Body))
+}
+
+func TestPublishAndReceiveTimeout(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	_, err := br.PublishAndReceive(context.TODO(), "test.noreply", &broker.Message{
+		Body: []byte("ping"),
+	}, broker.WithPublishTimeout(10*time.Millisecond))
+
+	assert.ErrorAs(t, err, &broker.RequestTimeoutResponse{})
+}
+
+func TestPublishHook(t *testing.T) {
+	var topics []string
+	br := getMemoryBroker(t, PublishHook(func(ctx context.Context, topic string, msg *broker.Message) {
+		topics = append(topics, topic)
+	}))
+
+	br.Publish(context.TODO(), "test.hook.1", &broker.Message{Body: []byte("1")}) //nolint
+	br.Publish(context.TODO(), "test.hook.2", &broker.Message{Body: []byte("2")}) //nolint
+
+	assert.Equal(t, []string{"test.hook.1", "test.hook.2"}, topics)
+	assert.Equal(t, []string{"test.hook.1", "test.hook.2"}, br.(Inspector).Topics())
+
+	br.(Inspector).Reset()
+	assert.Empty(t, br.(Inspector).Topics())
+}
+
+func TestNotConnected(t *testing.T) {
+	br := NewBroker()
+
+	err := br.Publish(context.TODO(), "test.topic", &broker.Message{})
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+// PublishHookFunc is called with a copy of every published message
+type PublishHookFunc func(ctx context.Context, topic string, msg *broker.Message)
+
+type publishHookKey struct{}
+
+// PublishHook registers a function called for every message published to the broker,
+// before the message is delivered to the subscribers.
+func PublishHook(fn PublishHookFunc) broker.BrokerOption {
+	return broker.SetBrokerOption(publishHookKey{}, fn)
+}
@@ -0,0 +1,114 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kingstonduy/go-core/metrics"
+)
+
+// The metrics emitted by the broker implementations, see BrokerOptions.Metrics.
+// Unlike the metrics middlewares, they also cover the acks of the async producers,
+// the batch handlers and the retry and reply subscriptions.
+var (
+	// messages acked by the broker server, labels topic, status_code and error_code
+	MetricKeyClientPublishTotal = []string{"broker", "client", "publish", "total"}
+	// messages handled by the subscriptions, labels topic, status_code and error_code
+	MetricKeyClientConsumeTotal = []string{"broker", "client", "consume", "total"}
+	// duration of the handlers, label topic
+	MetricKeyClientHandleDuration = []string{"broker", "client", "handle", "duration", "milliseconds"}
+	// errors of the consumers, labels topic and group
+	MetricKeyClientConsumerErrorTotal = []string{"broker", "client", "consumer", "error", "total"}
+	// rebalances of the consumer groups, labels topic and group
+	MetricKeyClientRebalanceTotal = []string{"broker", "client", "rebalance", "total"}
+	// time waited for the replies of PublishAndReceive, labels topic and status
+	MetricKeyClientReplyDuration = []string{"broker", "client", "reply", "duration", "milliseconds"}
+	// messages not consumed yet: the kafka lag per partition, labels topic, partition and group,
+	// or the rabbitmq messages ready in the queue, labels topic and queue
+	MetricKeyClientLag = []string{"broker", "client", "lag"}
+
+	MetricLabelGroup     = "group"
+	MetricLabelPartition = "partition"
+	MetricLabelQueue     = "queue"
+	MetricLabelStatus    = "status"
+
+	RequestStatusSuccess  = "success"
+	RequestStatusError    = "error"
+	RequestStatusTimeout  = "timeout"
+	RequestStatusCanceled = "canceled"
+)
+
+// RequestStatus returns the status of a request of PublishAndReceive from its error
+func RequestStatus(err error) string {
+	switch err.(type) {
+	case nil:
+		return RequestStatusSuccess
+	case RequestTimeoutResponse:
+		return RequestStatusTimeout
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return RequestStatusCanceled
+	}
+	return RequestStatusError
+}
+
+// EmitPublished counts the message published to the topic, for the broker implementations
+func EmitPublished(m *metrics.Metrics, topic string, err error) {
+	emitTotal(m, MetricKeyClientPublishTotal, topic, err)
+}
+
+// EmitHandled counts the message handled by the handler of the topic and measures the handler duration,
+// for the broker implementations
+func EmitHandled(m *metrics.Metrics, topic string, err error, duration time.Duration) {
+	emitTotal(m, MetricKeyClientConsumeTotal, topic, err)
+
+	m.AddSampleWithLabels(
+		MetricKeyClientHandleDuration,
+		float32(duration.Milliseconds()),
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+		},
+	)
+}
+
+// EmitConsumerError counts the error of the consumer of the topic, for the broker implementations
+func EmitConsumerError(m *metrics.Metrics, topic string, group string) {
+	m.IncrCounterWithLabels(
+		MetricKeyClientConsumerErrorTotal,
+		1,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+			{
+				Name:  MetricLabelGroup,
+				Value: group,
+			},
+		},
+	)
+}
+
+// EmitReplyDuration measures the time waited for the reply of a request published to the topic,
+// the status is the status of the request: success, error, timeout or canceled
+func EmitReplyDuration(m *metrics.Metrics, topic string, status string, duration time.Duration) {
+	m.AddSampleWithLabels(
+		MetricKeyClientReplyDuration,
+		float32(duration.Milliseconds()),
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+			{
+				Name:  MetricLabelStatus,
+				Value: status,
+			},
+		},
+	)
+}
@@ -0,0 +1,126 @@
+package broker
+
+import (
+	"context"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/trace"
+)
+
+// PublishFunc publishes a message to a topic.
+type PublishFunc func(ctx context.Context, topic string, m *Message, opts ...PublishOption) error
+
+// PublishMiddleware wraps the Publish calls of a broker.
+type PublishMiddleware func(next PublishFunc) PublishFunc
+
+// SubscribeMiddleware wraps the handlers of every subscription of a broker.
+type SubscribeMiddleware func(next Handler) Handler
+
+// WithPublishMiddleware appends middlewares to the broker publish chain.
+// The first middleware is the outermost one.
+func WithPublishMiddleware(mws ...PublishMiddleware) BrokerOption {
+	return func(opts *BrokerOptions) {
+		opts.PublishMiddlewares = append(opts.PublishMiddlewares, mws...)
+	}
+}
+
+// WithSubscribeMiddleware appends middlewares to the handler chain of every subscription.
+// The first middleware is the outermost one.
+func WithSubscribeMiddleware(mws ...SubscribeMiddleware) BrokerOption {
+	return func(opts *BrokerOptions) {
+		opts.SubscribeMiddlewares = append(opts.SubscribeMiddlewares, mws...)
+	}
+}
+
+// ChainPublishMiddleware builds the publish chain ending with the final PublishFunc
+func ChainPublishMiddleware(final PublishFunc, mws ...PublishMiddleware) PublishFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		final = mws[i](final)
+	}
+	return final
+}
+
+// ChainSubscribeMiddleware builds the handler chain ending with the given handler
+func ChainSubscribeMiddleware(h Handler, mws ...SubscribeMiddleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type subscribeMiddlewareAppliedKey struct{}
+
+// WrapHandler is used by the broker implementations to apply the subscribe middlewares
+// of the broker options to a subscription handler.
+// The handler is returned untouched when the middlewares were already applied (e.g. by SubscribeWithRetry).
+func WrapHandler(h Handler, bOpts BrokerOptions, sOpts SubscribeOptions) Handler {
+	if sOpts.Context != nil {
+		if applied, ok := sOpts.Context.Value(subscribeMiddlewareAppliedKey{}).(bool); ok && applied {
+			return h
+		}
+	}
+	return ChainSubscribeMiddleware(h, bOpts.SubscribeMiddlewares...)
+}
+
+func withSubscribeMiddlewareApplied() SubscribeOption {
+	return SetSubscribeOption(subscribeMiddlewareAppliedKey{}, true)
+}
+
+// Options of the built-in logging, metrics and tracing middlewares
+type MiddlewareOptions struct {
+	logger  logger.Logger
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+}
+
+type MiddlewareOption func(*MiddlewareOptions)
+
+func WithMiddlewareLogger(log logger.Logger) MiddlewareOption {
+	return func(o *MiddlewareOptions) {
+		o.logger = log
+	}
+}
+
+func WithMiddlewareMetrics(m *metrics.Metrics) MiddlewareOption {
+	return func(o *MiddlewareOptions) {
+		o.metrics = m
+	}
+}
+
+func WithMiddlewareTracer(tracer trace.Tracer) MiddlewareOption {
+	return func(o *MiddlewareOptions) {
+		o.tracer = tracer
+	}
+}
+
+func NewMiddlewareOptions(opts ...MiddlewareOption) MiddlewareOptions {
+	options := MiddlewareOptions{}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+func (o MiddlewareOptions) getLogger() logger.Logger {
+	if o.logger != nil {
+		return o.logger
+	}
+	return logger.DefaultLogger
+}
+
+func (o MiddlewareOptions) getMetrics() *metrics.Metrics {
+	if o.metrics != nil {
+		return o.metrics
+	}
+	return metrics.Default()
+}
+
+func (o MiddlewareOptions) getTracer() trace.Tracer {
+	if o.tracer != nil {
+		return o.tracer
+	}
+	return trace.DefaultTracer
+}
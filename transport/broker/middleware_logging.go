@@ -0,0 +1,79 @@
+package broker
+
+import (
+	"context"
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+)
+
+var (
+	StepNamePublished = "published-message"
+	StepNameReceived  = "message-received"
+	StepNameHandled   = "message-handled"
+)
+
+// NewLoggingPublishMiddleware logs every published message
+func NewLoggingPublishMiddleware(opts ...MiddlewareOption) PublishMiddleware {
+	options := NewMiddlewareOptions(opts...)
+
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, m *Message, opts ...PublishOption) error {
+			start := time.Now()
+			err := next(ctx, topic, m, opts...)
+
+			log := options.getLogger().Fields(map[string]interface{}{
+				logger.FIELD_OPERATOR_NAME: topic,
+				logger.FIELD_STEP_NAME:     StepNamePublished,
+				logger.FIELD_DURATION:      time.Since(start).Milliseconds(),
+			})
+
+			// the nil messages are rejected by the brokers, they are logged without body
+			var msg string
+			if m != nil {
+				msg = MakeStringLogsKafka(ctx, *m)
+			}
+
+			if err != nil {
+				log.Errorf(ctx, "Failed to publish message - Error: %v - %s", err, msg)
+				return err
+			}
+
+			log.Info(ctx, msg)
+			return nil
+		}
+	}
+}
+
+// NewLoggingSubscribeMiddleware logs every received message and the handler result
+func NewLoggingSubscribeMiddleware(opts ...MiddlewareOption) SubscribeMiddleware {
+	options := NewMiddlewareOptions(opts...)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e Event) error {
+			if e.Message() != nil {
+				options.getLogger().Fields(map[string]interface{}{
+					logger.FIELD_OPERATOR_NAME: e.Topic(),
+					logger.FIELD_STEP_NAME:     StepNameReceived,
+				}).Info(ctx, MakeStringLogsKafka(ctx, *e.Message()))
+			}
+
+			start := time.Now()
+			err := next(ctx, e)
+
+			log := options.getLogger().Fields(map[string]interface{}{
+				logger.FIELD_OPERATOR_NAME: e.Topic(),
+				logger.FIELD_STEP_NAME:     StepNameHandled,
+				logger.FIELD_DURATION:      time.Since(start).Milliseconds(),
+			})
+
+			if err != nil {
+				log.Errorf(ctx, "Handled message - Topic: %s - Error: %v", e.Topic(), err)
+			} else {
+				log.Infof(ctx, "Handled message - Topic: %s", e.Topic())
+			}
+
+			return err
+		}
+	}
+}
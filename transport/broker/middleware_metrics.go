@@ -0,0 +1,104 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kingstonduy/go-core/errorx"
+	"github.com/kingstonduy/go-core/metrics"
+)
+
+var (
+	MetricKeyPublishTotal    = []string{"broker", "publish", "total"}
+	MetricKeyPublishDuration = []string{"broker", "publish", "duration", "milliseconds"}
+	MetricKeyConsumeTotal    = []string{"broker", "consume", "total"}
+	MetricKeyConsumeDuration = []string{"broker", "consume", "duration", "milliseconds"}
+
+	MetricLabelTopic      = "topic"
+	MetricLabelStatusCode = "status_code"
+	MetricLabelErrorCode  = "error_code"
+)
+
+// NewMetricsPublishMiddleware counts the published messages and measures the publish latency
+func NewMetricsPublishMiddleware(opts ...MiddlewareOption) PublishMiddleware {
+	options := NewMiddlewareOptions(opts...)
+
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, m *Message, opts ...PublishOption) error {
+			start := time.Now()
+			err := next(ctx, topic, m, opts...)
+
+			emitMetrics(options.getMetrics(), MetricKeyPublishTotal, MetricKeyPublishDuration, topic, err, time.Since(start))
+			return err
+		}
+	}
+}
+
+// NewMetricsSubscribeMiddleware counts the handled messages and measures the handler duration
+func NewMetricsSubscribeMiddleware(opts ...MiddlewareOption) SubscribeMiddleware {
+	options := NewMiddlewareOptions(opts...)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e Event) error {
+			start := time.Now()
+			err := next(ctx, e)
+
+			emitMetrics(options.getMetrics(), MetricKeyConsumeTotal, MetricKeyConsumeDuration, e.Topic(), err, time.Since(start))
+			return err
+		}
+	}
+}
+
+func emitMetrics(m *metrics.Metrics, totalKey []string, durationKey []string, topic string, err error, duration time.Duration) {
+	emitTotal(m, totalKey, topic, err)
+
+	m.AddSampleWithLabels(
+		durationKey,
+		float32(duration.Milliseconds()),
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+		},
+	)
+}
+
+// emitTotal counts the message with the status and error codes of the error, like the pipeline metrics
+func emitTotal(m *metrics.Metrics, totalKey []string, topic string, err error) {
+	var statusCode int
+	var errorCode string
+
+	if err != nil {
+		var brokerError *errorx.Error
+		if !errors.As(err, &brokerError) {
+			brokerError = errorx.Failed(err.Error())
+		}
+		statusCode = brokerError.Status
+		errorCode = brokerError.Code
+	} else {
+		statusCode = errorx.DefaultSuccessStatusCode
+		errorCode = errorx.DefaultSuccessResponseCode
+	}
+
+	m.IncrCounterWithLabels(
+		totalKey,
+		1,
+		[]metrics.Label{
+			{
+				Name:  MetricLabelTopic,
+				Value: topic,
+			},
+			{
+				Name:  MetricLabelStatusCode,
+				Value: fmt.Sprintf("%v", statusCode),
+			},
+			{
+				Name:  MetricLabelErrorCode,
+				Value: fmt.Sprintf("%v", errorCode),
+			},
+		},
+	)
+}
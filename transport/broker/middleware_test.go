@@ -0,0 +1,160 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+)
+
+func recordPublish(name string, calls *[]string) broker.PublishMiddleware {
+	return func(next broker.PublishFunc) broker.PublishFunc {
+		return func(ctx context.Context, topic string, m *broker.Message, opts ...broker.PublishOption) error {
+			*calls = append(*calls, name)
+			m.Headers[name] = "true"
+			return next(ctx, topic, m, opts...)
+		}
+	}
+}
+
+func recordSubscribe(name string, calls *[]string) broker.SubscribeMiddleware {
+	return func(next broker.Handler) broker.Handler {
+		return func(ctx context.Context, e broker.Event) error {
+			*calls = append(*calls, name)
+			return next(ctx, e)
+		}
+	}
+}
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var calls []string
+	br := getMemoryBroker(t,
+		broker.WithPublishMiddleware(recordPublish("p1", &calls), recordPublish("p2", &calls)),
+		broker.WithSubscribeMiddleware(recordSubscribe("s1", &calls), recordSubscribe("s2", &calls)),
+	)
+
+	var headers map[string]string
+	_, err := br.Subscribe("test.middleware", func(ctx context.Context, e broker.Event) error {
+		calls = append(calls, "handler")
+		headers = e.Message().Headers
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = br.Publish(context.TODO(), "test.middleware", &broker.Message{
+		Headers: map[string]string{},
+		Body:    []byte("body"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"p1", "p2", "s1", "s2", "handler"}, calls)
+	assert.Equal(t, "true", headers["p1"])
+	assert.Equal(t, "true", headers["p2"])
+}
+
+func TestMiddlewareObservesRetries(t *testing.T) {
+	var calls []string
+	br := getMemoryBroker(t, broker.WithSubscribeMiddleware(recordSubscribe("s1", &calls)))
+
+	_, err := br.Subscribe("test.middleware.retry", func(ctx context.Context, e broker.Event) error {
+		return errors.New("failed")
+	}, broker.WithSubscribeRetry(broker.RetryPolicy{Delays: []time.Duration{time.Millisecond}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := br.Publish(context.TODO(), "test.middleware.retry", &broker.Message{Body: []byte("body")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// one call per attempt, the middlewares are not applied twice
+	assert.Equal(t, []string{"s1", "s1"}, calls)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	m, err := metrics.New(&metrics.Config{FilterDefault: true}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	br := getMemoryBroker(t,
+		broker.WithPublishMiddleware(broker.NewMetricsPublishMiddleware(broker.WithMiddlewareMetrics(m))),
+		broker.WithSubscribeMiddleware(broker.NewMetricsSubscribeMiddleware(broker.WithMiddlewareMetrics(m))),
+	)
+
+	_, err = br.Subscribe("test.metrics", func(ctx context.Context, e broker.Event) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := br.Publish(context.TODO(), "test.metrics", &broker.Message{Body: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+
+	var counters []string
+	for _, interval := range sink.Data() {
+		for key := range interval.Counters {
+			counters = append(counters, key)
+		}
+	}
+
+	assertContainsPrefix(t, counters, "broker.publish.total;topic=test.metrics")
+	assertContainsPrefix(t, counters, "broker.consume.total;topic=test.metrics")
+}
+
+func TestRequestStatus(t *testing.T) {
+	assert.Equal(t, broker.RequestStatusSuccess, broker.RequestStatus(nil))
+	assert.Equal(t, broker.RequestStatusTimeout, broker.RequestStatus(broker.RequestTimeoutResponse{}))
+	assert.Equal(t, broker.RequestStatusCanceled, broker.RequestStatus(fmt.Errorf("publish: %w", context.DeadlineExceeded)))
+	assert.Equal(t, broker.RequestStatusError, broker.RequestStatus(errors.New("failed")))
+}
+
+func TestLoggingAndTracingMiddleware(t *testing.T) {
+	br := getMemoryBroker(t,
+		broker.WithPublishMiddleware(broker.NewTracingPublishMiddleware(), broker.NewLoggingPublishMiddleware()),
+		broker.WithSubscribeMiddleware(broker.NewTracingSubscribeMiddleware(), broker.NewLoggingSubscribeMiddleware()),
+	)
+
+	errFailed := errors.New("failed")
+	var handled bool
+	_, err := br.Subscribe("test.logging", func(ctx context.Context, e broker.Event) error {
+		handled = true
+		return errFailed
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := br.Publish(context.TODO(), "test.logging", &broker.Message{Body: []byte(`{"key":"value"}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.True(t, handled)
+
+	// the nil message is rejected by the broker, not by the logging
+	assert.NotPanics(t, func() {
+		assert.Error(t, br.Publish(context.TODO(), "test.logging", nil))
+	})
+}
+
+func assertContainsPrefix(t *testing.T, values []string, prefix string) {
+	for _, v := range values {
+		if strings.HasPrefix(v, prefix) {
+			return
+		}
+	}
+	t.Errorf("no value with prefix %s in %v", prefix, values)
+}
@@ -0,0 +1,46 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/kingstonduy/go-core/trace"
+)
+
+// NewTracingPublishMiddleware starts a span for every published message
+func NewTracingPublishMiddleware(opts ...MiddlewareOption) PublishMiddleware {
+	options := NewMiddlewareOptions(opts...)
+
+	return func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, topic string, m *Message, opts ...PublishOption) (err error) {
+			ctx, finish := options.getTracer().StartTracing(ctx, fmt.Sprintf("Broker.Publish - %s", topic), trace.WithTraceRequest(m))
+			defer func() {
+				finish(ctx,
+					trace.WithTraceErrorResponse(err),
+				)
+			}()
+
+			err = next(ctx, topic, m, opts...)
+			return err
+		}
+	}
+}
+
+// NewTracingSubscribeMiddleware starts a span for every handled message
+func NewTracingSubscribeMiddleware(opts ...MiddlewareOption) SubscribeMiddleware {
+	options := NewMiddlewareOptions(opts...)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, e Event) (err error) {
+			ctx, finish := options.getTracer().StartTracing(ctx, fmt.Sprintf("Broker.Handle - %s", e.Topic()), trace.WithTraceRequest(e.Message()))
+			defer func() {
+				finish(ctx,
+					trace.WithTraceErrorResponse(err),
+				)
+			}()
+
+			err = next(ctx, e)
+			return err
+		}
+	}
+}
@@ -0,0 +1,753 @@
+// Package nats provides a NATS JetStream broker:
+// a topic is a subject captured by a stream, a consumer group is a durable pull consumer.
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+var (
+	DefaultAddress = natsgo.DefaultURL
+
+	// like the rabbitmq broker, the connection is retried every second forever
+	DefaultReconnectWait = time.Second
+
+	// the consumers of the subscriptions without group are deleted by the server once inactive
+	DefaultInactiveThreshold = time.Minute
+
+	// header of the message key, nats messages have no key
+	HeaderKey = "Broker-Key"
+
+	ErrNotConnected = errors.New("nats broker is not connected")
+)
+
+type nbroker struct {
+	opts broker.BrokerOptions
+
+	mtx       sync.RWMutex
+	conn      *natsgo.Conn
+	js        jetstream.JetStream
+	connected bool
+	// closed while connected, the subscriptions wait on it to re-create their consumer
+	waitConnection chan struct{}
+
+	// topic -> stream
+	streams sync.Map
+
+	// the subscriptions drained by Drain
+	subMtx      sync.Mutex
+	subscribers map[*subscriber]struct{}
+
+	// request-reply: the inbox subscription and the pending calls by correlation id
+	instanceID string
+	replySub   *natsgo.Subscription
+	resps      sync.Map
+}
+
+// NewBroker returns a broker on the JetStream of the nats servers of the broker addresses
+func NewBroker(opts ...broker.BrokerOption) broker.Broker {
+	options := broker.NewBrokerOptions(opts...)
+
+	waitConnection := make(chan struct{})
+	// the subscriptions must not block before the first connect
+	close(waitConnection)
+
+	return &nbroker{
+		opts:           options,
+		waitConnection: waitConnection,
+		instanceID:     uuid.New().String(),
+	}
+}
+
+type subscriber struct {
+	r       *nbroker
+	topic   string
+	stream  string
+	config  jetstream.ConsumerConfig
+	opts    broker.SubscribeOptions
+	handler broker.Handler
+
+	// the consumer is deleted on unsubscribe: the subscriptions without group
+	ephemeral bool
+	closeOnce sync.Once
+
+	mtx       sync.Mutex
+	consumer  jetstream.Consumer
+	iter      jetstream.MessagesContext
+	stopped   bool
+	unsub     chan struct{} // closed by stop
+	unsubOnce sync.Once
+
+	// closed once the consume loop returned
+	done chan struct{}
+}
+
+type publication struct {
+	msg jetstream.Msg
+	m   *broker.Message
+	t   string
+	err error
+}
+
+func (p *publication) Topic() string {
+	return p.t
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+// Ack acknowledges the message, the messages not acked are redelivered after AckWait
+func (p *publication) Ack() error {
+	return p.msg.Ack()
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+// Timestamp returns the time the message was stored by the stream
+func (p *publication) Timestamp() time.Time {
+	meta, err := p.msg.Metadata()
+	if err != nil {
+		return time.Time{}
+	}
+	return meta.Timestamp
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+// Unsubscribe drains the subscription within broker.DefaultDrainTimeout, see Drain
+func (s *subscriber) Unsubscribe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return s.Drain(ctx)
+}
+
+// Drain implements broker.Drainer, the messages already pulled are handled before the subscription is closed
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.stop()
+
+	err := s.wait(ctx)
+	if cErr := s.close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// stop stops pulling, the messages already pulled are still handled
+func (s *subscriber) stop() {
+	s.unsubOnce.Do(func() {
+		close(s.unsub)
+	})
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.stopped = true
+	if s.iter != nil {
+		s.iter.Drain()
+	}
+}
+
+func (s *subscriber) isStopped() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return s.stopped
+}
+
+// wait waits for the consume loop to return
+func (s *subscriber) wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain subscription to %s: %w", s.topic, ctx.Err())
+	}
+}
+
+// close deletes the consumer of the subscription without group
+func (s *subscriber) close() error {
+	s.r.removeSubscriber(s)
+
+	if !s.ephemeral {
+		return nil
+	}
+
+	var err error
+	s.closeOnce.Do(func() {
+		js, jsErr := s.r.getJetStream()
+		if jsErr != nil {
+			// deleted by the server once inactive
+			return
+		}
+
+		err = js.DeleteConsumer(context.Background(), s.stream, s.config.Name)
+		if errors.Is(err, jetstream.ErrConsumerNotFound) {
+			err = nil
+		}
+	})
+	return err
+}
+
+// run consumes the messages until the subscription is stopped.
+// Like the rabbitmq broker, when the consumption fails the subscription waits for the connection
+// and re-creates its consumer.
+func (s *subscriber) run() {
+	defer close(s.done)
+
+	var (
+		consumer = s.consumer
+		err      error
+	)
+
+	for {
+		if consumer != nil {
+			err = s.consume(consumer)
+			if err == nil || s.isStopped() {
+				return
+			}
+
+			s.r.log(context.Background(), logger.ErrorLevel, "[nats] failed to consume %s, resubscribing: %s", s.topic, err)
+			broker.EmitConsumerError(s.r.getMetrics(), s.topic, s.opts.Group)
+		}
+
+		consumer = nil
+
+		s.r.mtx.RLock()
+		waitConnection := s.r.waitConnection
+		s.r.mtx.RUnlock()
+
+		select {
+		case <-s.unsub:
+			return
+		case <-time.After(DefaultReconnectWait):
+		}
+
+		// block until the broker is connected
+		select {
+		case <-s.unsub:
+			return
+		case <-waitConnection:
+		}
+
+		js, err := s.r.getJetStream()
+		if err != nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		consumer, err = js.CreateOrUpdateConsumer(ctx, s.stream, s.config)
+		cancel()
+		if err != nil {
+			s.r.log(context.Background(), logger.ErrorLevel, "[nats] failed to create consumer of %s: %s", s.topic, err)
+			consumer = nil
+		}
+	}
+}
+
+// consume handles the messages of the consumer, it returns nil once the subscription is stopped
+func (s *subscriber) consume(consumer jetstream.Consumer) error {
+	iter, err := consumer.Messages()
+	if err != nil {
+		return err
+	}
+
+	s.mtx.Lock()
+	if s.stopped {
+		s.mtx.Unlock()
+		iter.Stop()
+		return nil
+	}
+	s.consumer = consumer
+	s.iter = iter
+	s.mtx.Unlock()
+
+	for {
+		msg, err := iter.Next()
+		if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+			if s.isStopped() {
+				return nil
+			}
+			return err
+		}
+		if err != nil {
+			iter.Stop()
+			return err
+		}
+
+		s.handle(msg)
+	}
+}
+
+func (s *subscriber) handle(msg jetstream.Msg) {
+	ctx := context.Background()
+
+	p := &publication{msg: msg, m: toMessage(msg.Headers(), msg.Data()), t: s.topic}
+
+	start := time.Now()
+	err := s.handler(ctx, p)
+	broker.EmitHandled(s.r.getMetrics(), s.topic, err, time.Since(start))
+
+	if err == nil && s.opts.AutoAck {
+		if err := p.Ack(); err != nil {
+			s.r.log(ctx, logger.ErrorLevel, "[nats] failed to ack message of %s: %s", s.topic, err)
+		}
+	} else if err != nil {
+		p.err = err
+		if errHandler := s.r.opts.ErrorHandler; errHandler != nil {
+			errHandler(ctx, p) //nolint
+		} else {
+			s.r.log(ctx, logger.ErrorLevel, "[nats] subscriber error: %v", err)
+		}
+	}
+}
+
+func (r *nbroker) Init(opts ...broker.BrokerOption) error {
+	for _, o := range opts {
+		o(&r.opts)
+	}
+	return nil
+}
+
+func (r *nbroker) Options() broker.BrokerOptions {
+	return r.opts
+}
+
+func (r *nbroker) Address() string {
+	if len(r.opts.Addrs) > 0 && len(r.opts.Addrs[0]) > 0 {
+		return r.opts.Addrs[0]
+	}
+	return DefaultAddress
+}
+
+func (r *nbroker) String() string {
+	return "nats"
+}
+
+// Connect connects to the servers of the broker addresses and creates the streams of the Streams option.
+// Once connected, the connection is retried every DefaultReconnectWait forever.
+func (r *nbroker) Connect() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.connected {
+		return nil
+	}
+
+	options := natsgo.GetDefaultOptions()
+	options.Servers = r.getServers()
+	options.MaxReconnect = -1
+	options.ReconnectWait = DefaultReconnectWait
+	options.DisconnectedErrCB = r.onDisconnected
+	options.ReconnectedCB = r.onReconnected
+	if r.opts.TLSConfig != nil {
+		options.Secure = true
+		options.TLSConfig = r.opts.TLSConfig
+	} else if r.opts.Secure {
+		options.Secure = true
+	}
+
+	if opts, ok := r.opts.Context.Value(connectOptionsKey{}).([]natsgo.Option); ok {
+		for _, o := range opts {
+			if err := o(&options); err != nil {
+				return err
+			}
+		}
+	}
+
+	conn, err := options.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if cfgs, ok := r.opts.Context.Value(streamsKey{}).([]jetstream.StreamConfig); ok {
+		for _, cfg := range cfgs {
+			if _, err := js.CreateOrUpdateStream(context.Background(), cfg); err != nil {
+				conn.Close()
+				return fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+			}
+		}
+	}
+
+	// request-reply: the replies of this instance are published to its inbox
+	replySub, err := conn.Subscribe(r.inbox("*"), r.handleReply)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to subscribe reply inbox: %w", err)
+	}
+
+	r.conn = conn
+	r.js = js
+	r.replySub = replySub
+	r.streams = sync.Map{}
+	r.resps = sync.Map{}
+	r.connected = true
+
+	select {
+	case <-r.waitConnection:
+	default:
+		close(r.waitConnection)
+	}
+
+	return nil
+}
+
+func (r *nbroker) onDisconnected(conn *natsgo.Conn, err error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.connected {
+		return
+	}
+
+	r.log(context.Background(), logger.ErrorLevel, "[nats] disconnected: %v", err)
+
+	// block all resubscribe attempts, they are useless until reconnected
+	r.connected = false
+	r.waitConnection = make(chan struct{})
+}
+
+func (r *nbroker) onReconnected(conn *natsgo.Conn) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.connected || r.conn != conn {
+		return
+	}
+
+	r.log(context.Background(), logger.InfoLevel, "[nats] reconnected to %s", conn.ConnectedUrlRedacted())
+
+	// unblock the resubscribe attempts
+	r.connected = true
+	close(r.waitConnection)
+}
+
+// Disconnect drains the broker within broker.DefaultDrainTimeout, see Drain
+func (r *nbroker) Disconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return r.Drain(ctx)
+}
+
+// Drain implements broker.Drainer: the subscriptions stop pulling,
+// the messages already pulled are handled, then the connection is closed
+func (r *nbroker) Drain(ctx context.Context) error {
+	r.subMtx.Lock()
+	subscribers := make([]*subscriber, 0, len(r.subscribers))
+	for s := range r.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	r.subMtx.Unlock()
+
+	for _, s := range subscribers {
+		s.stop()
+	}
+
+	var err error
+	for _, s := range subscribers {
+		if err = s.wait(ctx); err != nil {
+			break
+		}
+	}
+
+	for _, s := range subscribers {
+		if cErr := s.close(); cErr != nil {
+			r.log(ctx, logger.ErrorLevel, "[nats] failed to close subscription to %s: %s", s.topic, cErr)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn = nil
+	r.js = nil
+	r.replySub = nil
+	r.connected = false
+
+	return err
+}
+
+func (r *nbroker) Publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	publish := broker.ChainPublishMiddleware(r.publish, r.opts.PublishMiddlewares...)
+	return publish(ctx, topic, msg, opts...)
+}
+
+// publish stores the message in the stream of the topic, the replies to an inbox are published with core nats
+func (r *nbroker) publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (err error) {
+	if msg == nil {
+		return broker.EmptyMessageError{}
+	}
+
+	r.mtx.RLock()
+	conn, js := r.conn, r.js
+	r.mtx.RUnlock()
+
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	defer func() {
+		broker.EmitPublished(r.getMetrics(), topic, err)
+	}()
+
+	m := natsgo.NewMsg(topic)
+	m.Data = msg.Body
+	for k, v := range msg.Headers {
+		m.Header.Set(k, v)
+	}
+	if len(msg.Key) > 0 {
+		m.Header.Set(HeaderKey, string(msg.Key))
+	}
+
+	if strings.HasPrefix(topic, natsgo.InboxPrefix) {
+		return conn.PublishMsg(m)
+	}
+
+	if _, err := r.ensureStream(ctx, js, topic); err != nil {
+		return err
+	}
+
+	if _, err := js.PublishMsg(ctx, m); err != nil {
+		return fmt.Errorf("failed to publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// ensureStream returns the stream capturing the topic, it is created when AutoCreateStream is enabled
+func (r *nbroker) ensureStream(ctx context.Context, js jetstream.JetStream, topic string) (string, error) {
+	if stream, ok := r.streams.Load(topic); ok {
+		return stream.(string), nil
+	}
+
+	stream, err := js.StreamNameBySubject(ctx, topic)
+	if errors.Is(err, jetstream.ErrStreamNotFound) && r.getAutoCreateStream() {
+		stream = streamName(topic)
+		_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+			Name:     stream,
+			Subjects: []string{topic},
+		})
+		if errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find stream of %s: %w", topic, err)
+	}
+
+	r.streams.Store(topic, stream)
+	return stream, nil
+}
+
+// Subscribe pulls the messages of the topic with a durable consumer named after the group.
+// The subscriptions without broker.WithSubscribeGroup have their own consumer, deleted when unsubscribed.
+// The messages not acked are redelivered after AckWait, see broker.WithSubscribeRetry
+// for the retry topics and the dead-letter topic.
+func (r *nbroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	js, err := r.getJetStream()
+	if err != nil {
+		return nil, err
+	}
+
+	opt := broker.NewSubscribeOptions(opts...)
+
+	// retry topics & dead-letter queue
+	if opt.Retry != nil {
+		return broker.SubscribeWithRetry(r, topic, handler, opts...)
+	}
+
+	ctx := context.Background()
+	stream, err := r.ensureStream(ctx, js, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &subscriber{
+		r:         r,
+		topic:     topic,
+		stream:    stream,
+		config:    newConsumerConfig(topic, opt, hasGroup(opts...)),
+		opts:      opt,
+		handler:   broker.WrapHandler(handler, r.opts, opt),
+		ephemeral: !hasGroup(opts...),
+		unsub:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	s.consumer, err = js.CreateOrUpdateConsumer(ctx, stream, s.config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer of %s: %w", topic, err)
+	}
+
+	r.subMtx.Lock()
+	if r.subscribers == nil {
+		r.subscribers = make(map[*subscriber]struct{})
+	}
+	r.subscribers[s] = struct{}{}
+	r.subMtx.Unlock()
+
+	go s.run()
+
+	return s, nil
+}
+
+func newConsumerConfig(topic string, opt broker.SubscribeOptions, durable bool) jetstream.ConsumerConfig {
+	cfg := jetstream.ConsumerConfig{
+		FilterSubject: topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+	}
+
+	if durable {
+		cfg.Durable = consumerName(opt.Group)
+		cfg.Name = cfg.Durable
+	} else {
+		cfg.Name = uuid.New().String()
+		cfg.InactiveThreshold = DefaultInactiveThreshold
+	}
+
+	if opt.Context != nil {
+		if p, ok := opt.Context.Value(deliverPolicyKey{}).(jetstream.DeliverPolicy); ok {
+			cfg.DeliverPolicy = p
+		}
+		if d, ok := opt.Context.Value(ackWaitKey{}).(time.Duration); ok {
+			cfg.AckWait = d
+		}
+		if n, ok := opt.Context.Value(maxDeliverKey{}).(int); ok {
+			cfg.MaxDeliver = n
+		}
+		if n, ok := opt.Context.Value(maxAckPendingKey{}).(int); ok {
+			cfg.MaxAckPending = n
+		}
+	}
+
+	return cfg
+}
+
+func (r *nbroker) removeSubscriber(s *subscriber) {
+	r.subMtx.Lock()
+	defer r.subMtx.Unlock()
+
+	delete(r.subscribers, s)
+}
+
+func (r *nbroker) getJetStream() (jetstream.JetStream, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	if r.js == nil {
+		return nil, ErrNotConnected
+	}
+	return r.js, nil
+}
+
+func (r *nbroker) getServers() []string {
+	var servers []string
+	for _, addr := range r.opts.Addrs {
+		for _, server := range strings.Split(addr, ",") {
+			if server = strings.TrimSpace(server); len(server) > 0 {
+				servers = append(servers, server)
+			}
+		}
+	}
+
+	if len(servers) == 0 {
+		return []string{DefaultAddress}
+	}
+	return servers
+}
+
+func (r *nbroker) getAutoCreateStream() bool {
+	if b, ok := r.opts.Context.Value(autoCreateStreamKey{}).(bool); ok {
+		return b
+	}
+	return true
+}
+
+func (r *nbroker) getMetrics() *metrics.Metrics {
+	if r.opts.Metrics != nil {
+		return r.opts.Metrics
+	}
+	return metrics.Default()
+}
+
+func (r *nbroker) log(ctx context.Context, level logger.Level, message string, args ...interface{}) {
+	r.getLogger().Logf(ctx, level, message, args...)
+}
+
+func (r *nbroker) getLogger() logger.Logger {
+	if r.opts.Logger != nil {
+		return r.opts.Logger
+	}
+	return logger.DefaultLogger
+}
+
+// hasGroup tells whether the options set the consumer group, the default group of the subscribe options is random
+func hasGroup(opts ...broker.SubscribeOption) bool {
+	var options broker.SubscribeOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	return len(options.Group) > 0
+}
+
+// toMessage returns the broker message of the nats message, with the first value of each header
+func toMessage(header natsgo.Header, data []byte) *broker.Message {
+	m := &broker.Message{
+		Headers: make(map[string]string),
+		Body:    data,
+	}
+	for k, v := range header {
+		if len(v) == 0 {
+			continue
+		}
+		if k == HeaderKey {
+			m.Key = []byte(v[0])
+			continue
+		}
+		m.Headers[k] = v[0]
+	}
+	return m
+}
+
+var nameReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "/", "_", "\\", "_")
+
+// streamName returns the name of the stream created for the topic
+func streamName(topic string) string {
+	return nameReplacer.Replace(topic)
+}
+
+// consumerName returns the name of the durable consumer of the group
+func consumerName(group string) string {
+	return nameReplacer.Replace(group)
+}
@@ -0,0 +1,214 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runServer runs an embedded nats server with JetStream, port -1 picks a random port
+func runServer(t *testing.T, port int, storeDir string) *server.Server {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      port,
+		JetStream: true,
+		StoreDir:  storeDir,
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+
+	return s
+}
+
+func getBroker(t *testing.T, s *server.Server, opts ...broker.BrokerOption) *nbroker {
+	t.Helper()
+
+	r := NewBroker(append([]broker.BrokerOption{broker.WithBrokerAddresses(s.ClientURL())}, opts...)...).(*nbroker)
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() { r.Disconnect() }) //nolint
+
+	return r
+}
+
+func receive(t *testing.T, ch <-chan *broker.Message) *broker.Message {
+	t.Helper()
+
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func TestPublishAndSubscribe(t *testing.T) {
+	r := getBroker(t, runServer(t, -1, t.TempDir()))
+
+	// every group receives the message, the consumers of a group share the messages
+	var handled atomic.Int32
+	received := make(chan *broker.Message, 10)
+	for _, group := range []string{"group.a", "group.a", "group.b"} {
+		_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+			handled.Add(1)
+			received <- e.Message()
+			return nil
+		}, broker.WithSubscribeGroup(group))
+		require.NoError(t, err)
+	}
+
+	err := r.Publish(context.TODO(), "test.topic", &broker.Message{
+		Headers: map[string]string{"foo": "bar"},
+		Key:     []byte("key"),
+		Body:    []byte(`{"hello":"world"}`),
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		m := receive(t, received)
+		assert.Equal(t, "bar", m.Headers["foo"])
+		assert.Equal(t, []byte("key"), m.Key)
+		assert.Equal(t, []byte(`{"hello":"world"}`), m.Body)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(2), handled.Load())
+}
+
+func TestRedeliverNotAcked(t *testing.T) {
+	r := getBroker(t, runServer(t, -1, t.TempDir()))
+
+	var attempts atomic.Int32
+	handled := make(chan *broker.Message, 1)
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("failed")
+		}
+		handled <- e.Message()
+		return nil
+	}, broker.WithSubscribeGroup("group"), AckWait(100*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("{}")}))
+
+	receive(t, handled)
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestDurableConsumer(t *testing.T) {
+	r := getBroker(t, runServer(t, -1, t.TempDir()))
+	ctx := context.TODO()
+
+	received := make(chan *broker.Message, 10)
+	handler := func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	}
+
+	durable, err := r.Subscribe("test.topic", handler, broker.WithSubscribeGroup("group"))
+	require.NoError(t, err)
+	ephemeral, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error { return nil })
+	require.NoError(t, err)
+
+	require.NoError(t, durable.Unsubscribe())
+	require.NoError(t, ephemeral.Unsubscribe())
+
+	// the durable consumer is kept, the other one is deleted
+	stream, err := r.js.Stream(ctx, "test_topic")
+	require.NoError(t, err)
+
+	var consumers []string
+	for name := range stream.ConsumerNames(ctx).Name() {
+		consumers = append(consumers, name)
+	}
+	assert.Equal(t, []string{"group"}, consumers)
+
+	// the messages published while unsubscribed are delivered to the group
+	require.NoError(t, r.Publish(ctx, "test.topic", &broker.Message{Body: []byte("missed")}))
+
+	_, err = r.Subscribe("test.topic", handler, broker.WithSubscribeGroup("group"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("missed"), receive(t, received).Body)
+}
+
+func TestPublishAndReceive(t *testing.T) {
+	r := getBroker(t, runServer(t, -1, t.TempDir()))
+
+	_, err := r.Subscribe("test.request", func(ctx context.Context, e broker.Event) error {
+		m := e.Message()
+		return r.Publish(ctx, m.Headers[metadata.HeaderReplyTo], &broker.Message{
+			Headers: m.Headers,
+			Body:    append([]byte("reply:"), m.Body...),
+		})
+	}, broker.WithSubscribeGroup("service"))
+	require.NoError(t, err)
+
+	reply, err := r.PublishAndReceive(context.TODO(), "test.request", &broker.Message{Body: []byte("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("reply:ping"), reply.Body)
+
+	_, err = r.PublishAndReceive(context.TODO(), "test.nobody", &broker.Message{Body: []byte("ping")},
+		broker.WithPublishTimeout(50*time.Millisecond))
+	assert.ErrorAs(t, err, &broker.RequestTimeoutResponse{})
+}
+
+func TestReconnect(t *testing.T) {
+	storeDir := t.TempDir()
+	s := runServer(t, -1, storeDir)
+	port := s.Addr().(*net.TCPAddr).Port
+
+	r := getBroker(t, s)
+
+	received := make(chan *broker.Message, 10)
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	}, broker.WithSubscribeGroup("group"), DeliverPolicy(jetstream.DeliverAllPolicy))
+	require.NoError(t, err)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("before")}))
+	assert.Equal(t, []byte("before"), receive(t, received).Body)
+
+	// restart the server on the same port and store
+	s.Shutdown()
+	s.WaitForShutdown()
+	runServer(t, port, storeDir)
+
+	require.Eventually(t, func() bool {
+		r.mtx.RLock()
+		defer r.mtx.RUnlock()
+		return r.connected
+	}, 10*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("after")}))
+	assert.Equal(t, []byte("after"), receive(t, received).Body)
+}
+
+func TestNotConnected(t *testing.T) {
+	r := NewBroker()
+
+	assert.ErrorIs(t, r.Publish(context.TODO(), "test.topic", &broker.Message{}), ErrNotConnected)
+
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error { return nil })
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
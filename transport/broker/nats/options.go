@@ -0,0 +1,65 @@
+package nats
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// ================= BROKER OPTIONS =================
+
+type connectOptionsKey struct{}
+
+// ConnectOptions adds options to the nats connection, after the reconnect options of the broker
+func ConnectOptions(opts ...natsgo.Option) broker.BrokerOption {
+	return broker.SetBrokerOption(connectOptionsKey{}, opts)
+}
+
+type streamsKey struct{}
+
+// Streams creates or updates the streams on connect.
+// The topics without stream get a stream of their own on first use, see AutoCreateStream.
+func Streams(cfgs ...jetstream.StreamConfig) broker.BrokerOption {
+	return broker.SetBrokerOption(streamsKey{}, cfgs)
+}
+
+type autoCreateStreamKey struct{}
+
+// AutoCreateStream creates a stream for the topics captured by no stream, true by default.
+// The stream is named after the topic, with the '.' replaced by '_'.
+func AutoCreateStream(b bool) broker.BrokerOption {
+	return broker.SetBrokerOption(autoCreateStreamKey{}, b)
+}
+
+// ================= SUBSCRIBE OPTIONS =================
+
+type deliverPolicyKey struct{}
+
+// DeliverPolicy sets where a new consumer starts, jetstream.DeliverNewPolicy by default.
+// It cannot be changed once the durable consumer is created.
+func DeliverPolicy(p jetstream.DeliverPolicy) broker.SubscribeOption {
+	return broker.SetSubscribeOption(deliverPolicyKey{}, p)
+}
+
+type ackWaitKey struct{}
+
+// AckWait sets how long the server waits for the ack before it redelivers the message, 30s by default
+func AckWait(d time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(ackWaitKey{}, d)
+}
+
+type maxDeliverKey struct{}
+
+// MaxDeliver sets the maximum number of deliveries of a message, unlimited by default
+func MaxDeliver(n int) broker.SubscribeOption {
+	return broker.SetSubscribeOption(maxDeliverKey{}, n)
+}
+
+type maxAckPendingKey struct{}
+
+// MaxAckPending sets the maximum number of messages delivered and not acked yet
+func MaxAckPending(n int) broker.SubscribeOption {
+	return broker.SetSubscribeOption(maxAckPendingKey{}, n)
+}
@@ -0,0 +1,104 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+const (
+	CorrelationIdHeader = "correlationId"
+)
+
+var (
+	RequestReplyTimeout = time.Second * 60
+)
+
+// PublishAndReceive publishes the request to the stream of the topic and waits for the reply with the same correlation id.
+// The replyTo header of the request is a nats inbox of this instance, subscribed on connect:
+// the reply published to it with Publish goes through core nats, not through a stream.
+// broker.WithPublishReplyToTopic is ignored.
+// The call returns when the reply is received, the timeout expires or the context is done.
+func (r *nbroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (reply *broker.Message, err error) {
+	options := broker.PublishOptions{
+		Timeout: RequestReplyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if msg == nil {
+		return nil, broker.EmptyMessageError{}
+	}
+
+	if _, err := r.getJetStream(); err != nil {
+		return nil, err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+
+	correlationId, ok := msg.Headers[CorrelationIdHeader]
+	if !ok || len(correlationId) == 0 {
+		correlationId = uuid.New().String()
+		msg.Headers[CorrelationIdHeader] = correlationId
+	}
+	msg.Headers[metadata.HeaderReplyTo] = r.inbox(correlationId)
+
+	// register the pending call before publishing, so that an early reply is not lost
+	replyChan := make(chan *broker.Message, 1)
+	r.resps.Store(correlationId, replyChan)
+	defer r.resps.Delete(correlationId)
+
+	start := time.Now()
+	defer func() {
+		broker.EmitReplyDuration(r.getMetrics(), topic, broker.RequestStatus(err), time.Since(start))
+	}()
+
+	if err := r.Publish(ctx, topic, msg, opts...); err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if options.Timeout > 0 {
+		timer := time.NewTimer(options.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case reply := <-replyChan:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, broker.RequestTimeoutResponse{
+			Timeout: options.Timeout,
+		}
+	}
+}
+
+// inbox returns the inbox subject of the token for this instance
+func (r *nbroker) inbox(token string) string {
+	return fmt.Sprintf("%s%s.%s", natsgo.InboxPrefix, r.instanceID, token)
+}
+
+// handleReply passes the reply to the pending call of the correlation id of its subject, the other replies are dropped
+func (r *nbroker) handleReply(msg *natsgo.Msg) {
+	correlationId := strings.TrimPrefix(msg.Subject, r.inbox(""))
+
+	replyChan, ok := r.resps.LoadAndDelete(correlationId)
+	if !ok {
+		return
+	}
+
+	replyChan.(chan *broker.Message) <- toMessage(msg.Header, msg.Data)
+}
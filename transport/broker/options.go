@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
 )
 
 type BrokerOption func(*BrokerOptions)
@@ -17,6 +18,9 @@ type BrokerOptions struct {
 	// underlying logger
 	Logger logger.Logger
 
+	// metrics emitted by the broker implementation, metrics.Default() when nil
+	Metrics *metrics.Metrics
+
 	// Handler executed when error happens in broker mesage
 	// processing
 	ErrorHandler Handler
@@ -26,6 +30,12 @@ type BrokerOptions struct {
 	TLSConfig *tls.Config
 
 	Secure bool
+
+	// Middlewares wrapping the Publish calls
+	PublishMiddlewares []PublishMiddleware
+
+	// Middlewares wrapping the handler of every subscription
+	SubscribeMiddlewares []SubscribeMiddleware
 }
 
 func NewBrokerOptions(opts ...BrokerOption) BrokerOptions {
@@ -59,6 +69,12 @@ func WithLogger(log logger.Logger) BrokerOption {
 	}
 }
 
+func WithBrokerMetrics(m *metrics.Metrics) BrokerOption {
+	return func(opts *BrokerOptions) {
+		opts.Metrics = m
+	}
+}
+
 func WithBrokerErrorHandler(handler Handler) BrokerOption {
 	return func(opts *BrokerOptions) {
 		opts.ErrorHandler = handler
@@ -84,6 +100,11 @@ type PublishOptions struct {
 	Timeout            time.Duration
 	ReplyToTopic       string
 	ReplyConsumerGroup string
+
+	// time of the delivery of the message, now when zero.
+	// It is handled by the scheduler middleware or the rabbitmq delayed exchange,
+	// the brokers without them publish the message right away.
+	DeliverAt time.Time
 }
 
 func NewPublishOptions(opts ...PublishOption) PublishOptions {
@@ -122,6 +143,20 @@ func WithReplyConsumerGroup(cg string) PublishOption {
 	}
 }
 
+// WithDeliverAt delays the delivery of the message until the time, see scheduler.Scheduler
+func WithDeliverAt(t time.Time) PublishOption {
+	return func(opts *PublishOptions) {
+		opts.DeliverAt = t
+	}
+}
+
+// WithDelay delays the delivery of the message by the duration, see scheduler.Scheduler
+func WithDelay(d time.Duration) PublishOption {
+	return func(opts *PublishOptions) {
+		opts.DeliverAt = time.Now().Add(d)
+	}
+}
+
 type SubscribeOption func(*SubscribeOptions)
 
 type SubscribeOptions struct {
@@ -137,6 +172,14 @@ type SubscribeOptions struct {
 	// AutoAck defaults to true. When a handler returns
 	// with a nil error the message is acked.
 	AutoAck bool
+
+	// Retry routes the failed messages through retry topics
+	// and a dead-letter topic. Nil disables it.
+	Retry *RetryPolicy
+
+	// ErrorPolicy is applied when the handler returns an error,
+	// the message is skipped by default.
+	ErrorPolicy ErrorPolicy
 }
 
 func WithSubscribeContext(ctx context.Context) SubscribeOption {
@@ -66,6 +66,15 @@ func (r *rabbitMQChannel) Close() error {
 	return r.channel.Close()
 }
 
+// Cancel stops the deliveries of the consumer,
+// the deliveries already received are delivered before the deliveries channel is closed
+func (r *rabbitMQChannel) Cancel() error {
+	if r.channel == nil {
+		return errors.New("channel is nil")
+	}
+	return r.channel.Cancel(r.uuid, false)
+}
+
 func (r *rabbitMQChannel) Publish(exchange, key string, message amqp.Publishing) error {
 	if r.channel == nil {
 		return errors.New("channel is nil")
@@ -96,29 +105,39 @@ func (r *rabbitMQChannel) Publish(exchange, key string, message amqp.Publishing)
 }
 
 func (r *rabbitMQChannel) DeclareExchange(ex Exchange) error {
+	kind, args := exchangeKind(ex)
 	return r.channel.ExchangeDeclare(
-		ex.Name,         // name
-		string(ex.Type), // kind
-		ex.Durable,      // durable
-		false,           // autoDelete
-		false,           // internal
-		false,           // noWait
-		nil,             // args
+		ex.Name,    // name
+		kind,       // kind
+		ex.Durable, // durable
+		false,      // autoDelete
+		false,      // internal
+		false,      // noWait
+		args,       // args
 	)
 }
 
 func (r *rabbitMQChannel) DeclareDurableExchange(ex Exchange) error {
+	kind, args := exchangeKind(ex)
 	return r.channel.ExchangeDeclare(
-		ex.Name,         // name
-		string(ex.Type), // kind
-		true,            // durable
-		false,           // autoDelete
-		false,           // internal
-		false,           // noWait
-		nil,             // args
+		ex.Name, // name
+		kind,    // kind
+		true,    // durable
+		false,   // autoDelete
+		false,   // internal
+		false,   // noWait
+		args,    // args
 	)
 }
 
+// exchangeKind returns the kind and the arguments of the exchange declaration
+func exchangeKind(ex Exchange) (string, amqp.Table) {
+	if ex.Delayed {
+		return DelayedExchangeType, amqp.Table{"x-delayed-type": string(ex.Type)}
+	}
+	return string(ex.Type), nil
+}
+
 func (r *rabbitMQChannel) DeclareQueue(queue string, args amqp.Table) error {
 	_, err := r.channel.QueueDeclare(
 		queue, // name
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metadata"
 	"github.com/streadway/amqp"
 )
 
@@ -22,6 +23,13 @@ const (
 	ExchangeTypeFanout MQExchangeType = "fanout"
 	ExchangeTypeTopic  MQExchangeType = "topic"
 	ExchangeTypeDirect MQExchangeType = "direct"
+
+	// kind of the exchanges of the delayed message plugin, see DelayedExchange
+	DelayedExchangeType = "x-delayed-message"
+	// header of the delay of a message in milliseconds, read by the delayed exchange
+	DelayHeader = "x-delay"
+	// header of the content type of the message, mapped to the content_type property
+	ContentTypeHeader = metadata.HeaderContentType
 )
 
 var (
@@ -36,6 +44,9 @@ var (
 	DefaultConfirmPublish  = false
 	DefaultWithoutExchange = false
 
+	// interval of the queue depth metric
+	DefaultQueueDepthInterval = 30 * time.Second
+
 	// The amqp library does not seem to set these when using amqp.DialConfig
 	// (even though it says so in the comments) so we set them manually to make
 	// sure to not brake any existing functionality.
@@ -78,6 +89,8 @@ type Exchange struct {
 	Type MQExchangeType
 	// Whether its persistent
 	Durable bool
+	// Whether it is an x-delayed-message exchange of the delayed message plugin, routing as Type
+	Delayed bool
 }
 
 func newRabbitMQConn(ex Exchange, urls []string, prefetchCount int, prefetchGlobal bool, confirmPublish bool, withoutExchange bool, logger logger.Logger) *rabbitMQConn {
@@ -295,6 +308,22 @@ func (r *rabbitMQConn) Consume(queue, key string, headers amqp.Table, qArgs amqp
 	return consumerChannel, deliveries, nil
 }
 
+// QueueDepth returns the number of messages ready in the queue.
+// The queue is inspected on its own channel, the server closes the channel when the queue does not exist.
+func (r *rabbitMQConn) QueueDepth(queue string) (int, error) {
+	ch, err := r.Connection.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close() //nolint
+
+	q, err := ch.QueueInspect(queue)
+	if err != nil {
+		return 0, err
+	}
+	return q.Messages, nil
+}
+
 func (r *rabbitMQConn) Publish(exchange, key string, msg amqp.Publishing) error {
 	if r.withoutExchange {
 		return r.Channel.Publish("", key, msg)
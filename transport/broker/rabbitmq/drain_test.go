@@ -0,0 +1,65 @@
+package rabbitmq
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSubscriber runs a subscriber loop calling the handler once it is stopped,
+// like the prefetched deliveries handled after the cancel of the consumer
+func newTestSubscriber(r *rbroker, handler func()) *subscriber {
+	s := &subscriber{
+		topic: "test.drain",
+		unsub: make(chan bool),
+		done:  make(chan struct{}),
+		r:     r,
+	}
+	r.addSubscriber(s)
+
+	go func() {
+		defer close(s.done)
+		<-s.unsub
+		handler()
+	}()
+
+	return s
+}
+
+func TestDrainSubscriber(t *testing.T) {
+	r := NewBroker().(*rbroker)
+
+	var handled atomic.Bool
+	s := newTestSubscriber(r, func() {
+		time.Sleep(50 * time.Millisecond)
+		handled.Store(true)
+	})
+	other := newTestSubscriber(r, func() {})
+
+	assert.NoError(t, s.Unsubscribe())
+	assert.True(t, handled.Load())
+
+	// drained once
+	assert.NoError(t, s.Drain(context.TODO()))
+
+	assert.NotContains(t, r.subscribers, s)
+	assert.Contains(t, r.subscribers, other)
+}
+
+func TestDrainDeadline(t *testing.T) {
+	r := NewBroker().(*rbroker)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	newTestSubscriber(r, func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, r.Drain(ctx), context.DeadlineExceeded)
+	assert.Empty(t, r.subscribers)
+}
@@ -0,0 +1,84 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+// reportQueueDepth emits the messages ready in the queue of the subscription every QueueDepthInterval,
+// until the subscriber exited
+func (s *subscriber) reportQueueDepth() {
+	interval := s.r.getQueueDepthInterval()
+	if interval <= 0 || len(s.opts.Queue) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		depth, err := s.r.queueDepth(s.opts.Queue)
+		if err != nil {
+			s.r.getLogger().Logf(context.Background(), logger.WarnLevel, "failed to report the depth of queue %s: %s", s.opts.Queue, err)
+			continue
+		}
+
+		s.r.getMetrics().SetGaugeWithLabels(
+			broker.MetricKeyClientLag,
+			float32(depth),
+			[]metrics.Label{
+				{
+					Name:  broker.MetricLabelTopic,
+					Value: s.topic,
+				},
+				{
+					Name:  broker.MetricLabelQueue,
+					Value: s.opts.Queue,
+				},
+			},
+		)
+	}
+}
+
+func (r *rbroker) queueDepth(queue string) (int, error) {
+	// it may crash (panic) without connection, see resubscribe
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.conn == nil || !r.conn.connected {
+		return 0, errors.New("not connected")
+	}
+	return r.conn.QueueDepth(queue)
+}
+
+func (r *rbroker) getMetrics() *metrics.Metrics {
+	if r.opts.Metrics != nil {
+		return r.opts.Metrics
+	}
+	return metrics.Default()
+}
+
+func (r *rbroker) getLogger() logger.Logger {
+	if r.opts.Logger != nil {
+		return r.opts.Logger
+	}
+	return logger.DefaultLogger
+}
+
+func (r *rbroker) getQueueDepthInterval() time.Duration {
+	if interval, ok := r.opts.Context.Value(queueDepthIntervalKey{}).(time.Duration); ok {
+		return interval
+	}
+	return DefaultQueueDepthInterval
+}
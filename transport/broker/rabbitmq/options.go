@@ -31,6 +31,7 @@ type userID struct{}
 type appID struct{}
 type externalAuth struct{}
 type durableExchange struct{}
+type delayedExchangeKey struct{}
 
 /*
 	DefaultWithoutExchange = false
@@ -48,6 +49,14 @@ func DurableExchange() broker.BrokerOption {
 	return broker.SetBrokerOption(durableExchange{}, true)
 }
 
+// DelayedExchange declares the exchange as an x-delayed-message exchange, routing as ExchangeType.
+// The messages published with broker.WithDeliverAt or broker.WithDelay carry the x-delay header
+// and are routed by the exchange once due. It requires the rabbitmq_delayed_message_exchange plugin,
+// and an existing exchange must be deleted to be declared again as delayed.
+func DelayedExchange() broker.BrokerOption {
+	return broker.SetBrokerOption(delayedExchangeKey{}, true)
+}
+
 // ExchangeName is an option to set the ExchangeName.
 func ExchangeName(e string) broker.BrokerOption {
 	return broker.SetBrokerOption(exchangeKey{}, e)
@@ -87,6 +96,14 @@ func ConfirmPublish() broker.BrokerOption {
 	return broker.SetBrokerOption(confirmPublishKey{}, true)
 }
 
+type queueDepthIntervalKey struct{}
+
+// QueueDepthInterval sets the interval of the queue depth metric of the subscriptions.
+// DefaultQueueDepthInterval = 30s, the depth is not reported when the interval is 0.
+func QueueDepthInterval(interval time.Duration) broker.BrokerOption {
+	return broker.SetBrokerOption(queueDepthIntervalKey{}, interval)
+}
+
 // ================= SUBSCRIBE OPTIONS =================
 // DurableQueue creates a durable queue when subscribing.
 func DurableQueue() broker.SubscribeOption {
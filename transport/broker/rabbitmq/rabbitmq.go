@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/kingstonduy/go-core/metadata"
 	"github.com/kingstonduy/go-core/transport/broker"
 	"github.com/streadway/amqp"
 )
@@ -19,11 +21,23 @@ type rbroker struct {
 	opts  broker.BrokerOptions
 	mtx   sync.Mutex
 	wg    sync.WaitGroup
+
+	// request-reply: the channel consuming the direct reply-to pseudo queue
+	// and the pending calls by correlation id
+	replyMtx sync.Mutex
+	replyCh  *rabbitMQChannel
+	resps    sync.Map
+
+	// the subscriptions drained by Drain
+	subMtx      sync.Mutex
+	subscribers map[*subscriber]struct{}
 }
 
 type subscriber struct {
 	mtx          sync.Mutex
-	unsub        chan bool
+	unsub        chan bool // closed by Drain
+	unsubOnce    sync.Once
+	done         chan struct{} // closed once the subscriber exited
 	opts         broker.SubscribeOptions
 	topic        string
 	ch           *rabbitMQChannel
@@ -32,7 +46,6 @@ type subscriber struct {
 	r            *rbroker
 	fn           func(ctx context.Context, msg amqp.Delivery)
 	headers      map[string]interface{}
-	wg           sync.WaitGroup
 }
 
 type publication struct {
@@ -71,27 +84,72 @@ func (s *subscriber) Topic() string {
 	return s.topic
 }
 
+// Unsubscribe drains the subscription within broker.DefaultDrainTimeout, see Drain
 func (s *subscriber) Unsubscribe() error {
-	s.unsub <- true
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return s.Drain(ctx)
+}
+
+// Drain implements broker.Drainer. The consumer is cancelled so the server stops delivering,
+// the prefetched deliveries are handled, and acked without auto ack, then the channel is closed.
+// The unacked deliveries are requeued when the channel is closed.
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.stop()
 
-	// Need to wait on subscriber to exit if autoack is disabled
-	// since closing the channel will prevent the ack/nack from
-	// being sent upon handler completion.
-	if !s.opts.AutoAck {
-		s.wg.Wait()
+	err := s.wait(ctx)
+	if cErr := s.close(); cErr != nil && err == nil {
+		err = cErr
 	}
+	return err
+}
 
+// stop cancels the consumer, the channel is closed when the cancel fails
+func (s *subscriber) stop() {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
+
+	s.unsubOnce.Do(func() {
+		close(s.unsub)
+	})
+
 	if s.ch != nil {
-		return s.ch.Close()
+		if err := s.ch.Cancel(); err != nil {
+			s.ch.Close() //nolint
+		}
+	}
+}
+
+// wait waits for the subscriber to exit
+func (s *subscriber) wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain subscription to %s: %w", s.topic, ctx.Err())
+	}
+}
+
+func (s *subscriber) close() error {
+	s.r.removeSubscriber(s)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.ch == nil {
+		return nil
+	}
+
+	// already closed when the cancel failed
+	if err := s.ch.Close(); err != nil && !errors.Is(err, amqp.ErrClosed) {
+		return err
 	}
 	return nil
 }
 
 func (s *subscriber) resubscribe() {
-	s.wg.Add(1)
-	defer s.wg.Done()
+	defer close(s.done)
 
 	minResubscribeDelay := 100 * time.Millisecond
 	maxResubscribeDelay := 30 * time.Second
@@ -136,9 +194,18 @@ func (s *subscriber) resubscribe() {
 		case nil:
 			reSubscribeDelay = minResubscribeDelay
 			s.mtx.Lock()
+			select {
+			case <-s.unsub:
+				// drained while consuming
+				s.mtx.Unlock()
+				ch.Close() //nolint
+				return
+			default:
+			}
 			s.ch = ch
 			s.mtx.Unlock()
 		default:
+			broker.EmitConsumerError(s.r.getMetrics(), s.topic, s.opts.Queue)
 			if reSubscribeDelay > maxResubscribeDelay {
 				reSubscribeDelay = maxResubscribeDelay
 			}
@@ -147,24 +214,35 @@ func (s *subscriber) resubscribe() {
 			continue
 		}
 
-	SubLoop:
-		for {
-			select {
-			case <-s.unsub:
-				return
-			case d, ok := <-sub:
-				if !ok {
-					break SubLoop
-				}
-				s.r.wg.Add(1)
-				s.fn(context.Background(), d)
-				s.r.wg.Done()
-			}
+		// the deliveries are closed when the consumer is cancelled by Drain,
+		// after the prefetched ones, or when the channel is closed
+		for d := range sub {
+			s.r.wg.Add(1)
+			s.fn(context.Background(), d)
+			s.r.wg.Done()
 		}
 	}
 }
 
 func (r *rbroker) Publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	publish := broker.ChainPublishMiddleware(r.publish, r.opts.PublishMiddlewares...)
+	return publish(ctx, topic, msg, opts...)
+}
+
+func (r *rbroker) publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	if r.conn == nil {
+		return errors.New("connection is nil")
+	}
+
+	m := r.buildPublishing(topic, msg, opts...)
+
+	err := r.conn.Publish(r.getPublishExchange(topic), topic, m)
+	broker.EmitPublished(r.getMetrics(), topic, err)
+	return err
+}
+
+// buildPublishing converts the message and the publish options to an amqp publishing
+func (r *rbroker) buildPublishing(topic string, msg *broker.Message, opts ...broker.PublishOption) amqp.Publishing {
 	m := amqp.Publishing{
 		Body:    msg.Body,
 		Headers: amqp.Table{},
@@ -230,20 +308,29 @@ func (r *rbroker) Publish(ctx context.Context, topic string, msg *broker.Message
 		m.Headers[k] = v
 	}
 
-	if r.getWithoutExchange() {
-		// RABBIT: note
-		m.Headers["Micro-Topic"] = topic
+	// a reply carries the correlation id of its request as property
+	if len(m.CorrelationId) == 0 {
+		m.CorrelationId = msg.Headers[CorrelationIdHeader]
 	}
 
-	if r.conn == nil {
-		return errors.New("connection is nil")
+	// the content type of the message, e.g. of a cloud event, is the content_type property
+	if len(m.ContentType) == 0 {
+		m.ContentType = msg.Headers[ContentTypeHeader]
 	}
 
-	return r.conn.Publish(r.conn.exchange.Name, topic, m)
-}
+	// the delayed exchange routes the message after x-delay milliseconds
+	if !options.DeliverAt.IsZero() && r.getExchange().Delayed && !r.getWithoutExchange() {
+		if delay := time.Until(options.DeliverAt).Milliseconds(); delay > 0 {
+			m.Headers[DelayHeader] = delay
+		}
+	}
 
-func (r *rbroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (*broker.Message, error) {
-	return nil, fmt.Errorf("this feature is not supported for rabbitmq")
+	if r.getWithoutExchange() {
+		// RABBIT: note
+		m.Headers["Micro-Topic"] = topic
+	}
+
+	return m
 }
 
 func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
@@ -255,6 +342,11 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 
 	opt := broker.NewSubscribeOptions(opts...)
 
+	// retry topics & dead-letter queue, replace the requeue on error
+	if opt.Retry != nil {
+		return broker.SubscribeWithRetry(r, topic, handler, opts...)
+	}
+
 	// Make sure context is setup
 	if opt.Context == nil {
 		opt.Context = context.Background()
@@ -286,6 +378,8 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		ackSuccess = true
 	}
 
+	handler = broker.WrapHandler(handler, r.opts, opt)
+
 	fn := func(c context.Context, msg amqp.Delivery) {
 		header := make(map[string]string)
 		for k, v := range msg.Headers {
@@ -298,12 +392,25 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 			header["Micro-Topic"] = msg.RoutingKey
 		}
 
+		// expose the request-reply properties, so the handler can reply
+		if len(msg.CorrelationId) > 0 && len(header[CorrelationIdHeader]) == 0 {
+			header[CorrelationIdHeader] = msg.CorrelationId
+		}
+		if len(msg.ReplyTo) > 0 && len(header[metadata.HeaderReplyTo]) == 0 {
+			header[metadata.HeaderReplyTo] = msg.ReplyTo
+		}
+		if len(msg.ContentType) > 0 && len(header[ContentTypeHeader]) == 0 {
+			header[ContentTypeHeader] = msg.ContentType
+		}
+
 		m := &broker.Message{
 			Headers: header,
 			Body:    msg.Body,
 		}
 		p := &publication{d: msg, m: m, t: msg.RoutingKey, timestamp: msg.Timestamp}
+		start := time.Now()
 		p.err = handler(c, p)
+		broker.EmitHandled(r.getMetrics(), topic, p.err, time.Since(start))
 		if p.err == nil && ackSuccess && !opt.AutoAck {
 			msg.Ack(false) //nolint
 		} else if p.err != nil && !opt.AutoAck {
@@ -315,14 +422,17 @@ func (r *rbroker) Subscribe(topic string, handler broker.Handler, opts ...broker
 		topic:        topic,
 		opts:         opt,
 		unsub:        make(chan bool),
+		done:         make(chan struct{}),
 		r:            r,
 		durableQueue: durableQueue,
 		fn:           fn,
 		headers:      headers,
 		queueArgs:    qArgs,
-		wg:           sync.WaitGroup{}}
+	}
 
+	r.addSubscriber(sret)
 	go sret.resubscribe()
+	go sret.reportQueueDepth()
 
 	return sret, nil
 }
@@ -379,12 +489,72 @@ func (r *rbroker) Connect() error {
 	return r.conn.Connect(r.opts.Secure, &conf)
 }
 
+// Disconnect drains the broker within broker.DefaultDrainTimeout, see Drain
 func (r *rbroker) Disconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return r.Drain(ctx)
+}
+
+// Drain implements broker.Drainer, the subscriptions are drained before the connection is closed.
+// The handlers still running at the deadline are not waited.
+func (r *rbroker) Drain(ctx context.Context) error {
+	r.subMtx.Lock()
+	subscribers := make([]*subscriber, 0, len(r.subscribers))
+	for s := range r.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	r.subMtx.Unlock()
+
+	for _, s := range subscribers {
+		s.stop()
+	}
+
+	var err error
+	for _, s := range subscribers {
+		if err = s.wait(ctx); err != nil {
+			break
+		}
+	}
+
+	for _, s := range subscribers {
+		s.close() //nolint
+	}
+
+	if dErr := r.disconnect(err == nil); dErr != nil && err == nil {
+		err = dErr
+	}
+	return err
+}
+
+func (r *rbroker) addSubscriber(s *subscriber) {
+	r.subMtx.Lock()
+	defer r.subMtx.Unlock()
+
+	if r.subscribers == nil {
+		r.subscribers = make(map[*subscriber]struct{})
+	}
+	r.subscribers[s] = struct{}{}
+}
+
+func (r *rbroker) removeSubscriber(s *subscriber) {
+	r.subMtx.Lock()
+	defer r.subMtx.Unlock()
+
+	delete(r.subscribers, s)
+}
+
+// disconnect closes the connection, and waits for the running handlers when wait is true
+func (r *rbroker) disconnect(wait bool) error {
 	if r.conn == nil {
 		return errors.New("connection is nil")
 	}
 	ret := r.conn.Close()
-	r.wg.Wait() // wait all goroutines
+	if wait {
+		r.wg.Wait() // wait all goroutines
+	}
+	r.resetReplyChannel(nil)
 	return ret
 }
 
@@ -414,6 +584,10 @@ func (r *rbroker) getExchange() Exchange {
 		ex.Durable = d
 	}
 
+	if d, ok := r.opts.Context.Value(delayedExchangeKey{}).(bool); ok {
+		ex.Delayed = d
+	}
+
 	return ex
 }
 
@@ -438,6 +612,15 @@ func (r *rbroker) getConfirmPublish() bool {
 	return DefaultConfirmPublish
 }
 
+// getPublishExchange returns the exchange of the topic, the replies to the direct reply-to
+// pseudo queue are published to the default exchange
+func (r *rbroker) getPublishExchange(topic string) string {
+	if r.getWithoutExchange() || strings.HasPrefix(topic, DirectReplyTo) {
+		return ""
+	}
+	return r.conn.exchange.Name
+}
+
 func (r *rbroker) getWithoutExchange() bool {
 	if e, ok := r.opts.Context.Value(withoutExchangeKey{}).(bool); ok {
 		return e
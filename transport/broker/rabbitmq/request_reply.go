@@ -0,0 +1,194 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DirectReplyTo is the pseudo queue of the rabbitmq direct reply-to
+	DirectReplyTo = "amq.rabbitmq.reply-to"
+
+	CorrelationIdHeader = "correlationId"
+)
+
+var (
+	RequestReplyTimeout = time.Second * 60
+)
+
+// PublishAndReceive publishes the request and waits for the reply with the same correlation id.
+// The replies are received with the rabbitmq direct reply-to: the request is published on the channel
+// consuming the amq.rabbitmq.reply-to pseudo queue, and its replyTo property and header are set to it.
+// The responder publishes the reply to the replyTo header of the request, with its correlationId header.
+// The call returns when the reply is received, the timeout expires or the context is done.
+func (r *rbroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (reply *broker.Message, err error) {
+	options := broker.PublishOptions{
+		Timeout: RequestReplyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if msg == nil {
+		return nil, broker.EmptyMessageError{}
+	}
+
+	ch, err := r.getReplyChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+
+	correlationId := msg.Headers[CorrelationIdHeader]
+	if options.Context != nil {
+		if value, ok := options.Context.Value(correlationID{}).(string); ok && len(value) > 0 {
+			correlationId = value
+		}
+	}
+	if len(correlationId) == 0 {
+		correlationId = uuid.New().String()
+	}
+	msg.Headers[CorrelationIdHeader] = correlationId
+	msg.Headers[metadata.HeaderReplyTo] = DirectReplyTo
+
+	opts = append(opts, CorrelationID(correlationId), ReplyTo(DirectReplyTo))
+
+	// register the pending call before publishing, so that an early reply is not lost
+	replyChan := make(chan *broker.Message, 1)
+	r.resps.Store(correlationId, replyChan)
+	defer r.resps.Delete(correlationId)
+
+	start := time.Now()
+	defer func() {
+		broker.EmitReplyDuration(r.getMetrics(), topic, broker.RequestStatus(err), time.Since(start))
+	}()
+
+	// the request must be published on the channel consuming the replies
+	publish := broker.ChainPublishMiddleware(func(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+		err := ch.Publish(r.getPublishExchange(topic), topic, r.buildPublishing(topic, msg, opts...))
+		broker.EmitPublished(r.getMetrics(), topic, err)
+		return err
+	}, r.opts.PublishMiddlewares...)
+
+	if err := publish(ctx, topic, msg, opts...); err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if options.Timeout > 0 {
+		timer := time.NewTimer(options.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case reply := <-replyChan:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, broker.RequestTimeoutResponse{
+			Timeout: options.Timeout,
+		}
+	}
+}
+
+// getReplyChannel returns the channel consuming the direct reply-to pseudo queue,
+// it is opened on the first request and after the channel is closed
+func (r *rbroker) getReplyChannel() (*rabbitMQChannel, error) {
+	r.replyMtx.Lock()
+	defer r.replyMtx.Unlock()
+
+	if r.replyCh != nil {
+		return r.replyCh, nil
+	}
+
+	if r.conn == nil {
+		return nil, errors.New("not connected")
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.conn.connected {
+		return nil, errors.New("not connected")
+	}
+
+	ch, err := newRabbitChannel(r.conn.Connection, r.getPrefetchCount(), r.getPrefetchGlobal(), r.getConfirmPublish())
+	if err != nil {
+		return nil, err
+	}
+
+	// the direct reply-to is consumed in no-ack mode
+	deliveries, err := ch.ConsumeQueue(DirectReplyTo, true)
+	if err != nil {
+		ch.Close() //nolint
+		return nil, fmt.Errorf("failed to consume %s: %w", DirectReplyTo, err)
+	}
+
+	r.replyCh = ch
+	go r.consumeReplies(ch, deliveries)
+
+	return ch, nil
+}
+
+// consumeReplies passes the replies to the pending calls until the channel is closed
+func (r *rbroker) consumeReplies(ch *rabbitMQChannel, deliveries <-chan amqp.Delivery) {
+	for d := range deliveries {
+		r.handleReply(d)
+	}
+
+	r.resetReplyChannel(ch)
+	if r.opts.Logger != nil {
+		r.opts.Logger.Info(context.Background(), "[rabbitmq] reply channel was closed")
+	}
+}
+
+// handleReply passes the reply to the pending call of its correlation id, the other replies are dropped
+func (r *rbroker) handleReply(d amqp.Delivery) {
+	header := make(map[string]string)
+	for k, v := range d.Headers {
+		header[k] = fmt.Sprintf("%v", v)
+	}
+
+	correlationId := d.CorrelationId
+	if len(correlationId) == 0 {
+		correlationId = header[CorrelationIdHeader]
+	}
+	header[CorrelationIdHeader] = correlationId
+
+	if replyChan, ok := r.resps.LoadAndDelete(correlationId); ok {
+		replyChan.(chan *broker.Message) <- &broker.Message{
+			Headers: header,
+			Body:    d.Body,
+		}
+	}
+}
+
+// resetReplyChannel forgets the reply channel, so the next request opens a new one.
+// A nil channel closes and forgets the current reply channel.
+func (r *rbroker) resetReplyChannel(ch *rabbitMQChannel) {
+	r.replyMtx.Lock()
+	defer r.replyMtx.Unlock()
+
+	if ch == nil && r.replyCh != nil {
+		r.replyCh.Close() //nolint
+		r.replyCh = nil
+		return
+	}
+
+	if r.replyCh == ch {
+		r.replyCh = nil
+	}
+}
@@ -0,0 +1,105 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleReply(t *testing.T) {
+	r := NewBroker().(*rbroker)
+
+	replyChan := make(chan *broker.Message, 1)
+	r.resps.Store("correlation-1", replyChan)
+
+	// an unknown reply is dropped
+	r.handleReply(amqp.Delivery{CorrelationId: "unknown"})
+
+	r.handleReply(amqp.Delivery{
+		CorrelationId: "correlation-1",
+		Headers:       amqp.Table{"key": "value"},
+		Body:          []byte("pong"),
+	})
+
+	reply := <-replyChan
+	assert.Equal(t, "pong", string(reply.Body))
+	assert.Equal(t, "correlation-1", reply.Headers[CorrelationIdHeader])
+	assert.Equal(t, "value", reply.Headers["key"])
+
+	_, ok := r.resps.Load("correlation-1")
+	assert.False(t, ok)
+}
+
+func TestReplyPublishing(t *testing.T) {
+	r := NewBroker().(*rbroker)
+	r.conn = &rabbitMQConn{exchange: DefaultExchange}
+
+	// a reply is published to the default exchange, with the correlation id of its request
+	replyTo := DirectReplyTo + ".g1h2AA5yZXBseUAxAAAAAAAAAAE="
+	m := r.buildPublishing(replyTo, &broker.Message{
+		Headers: map[string]string{CorrelationIdHeader: "correlation-1"},
+	})
+	assert.Equal(t, "correlation-1", m.CorrelationId)
+	assert.Equal(t, "", r.getPublishExchange(replyTo))
+	assert.Equal(t, DefaultExchange.Name, r.getPublishExchange("test.request"))
+
+	// the publish option takes precedence over the header
+	m = r.buildPublishing("test.request", &broker.Message{
+		Headers: map[string]string{CorrelationIdHeader: "correlation-1"},
+	}, CorrelationID("correlation-2"), ReplyTo(DirectReplyTo))
+	assert.Equal(t, "correlation-2", m.CorrelationId)
+	assert.Equal(t, DirectReplyTo, m.ReplyTo)
+}
+
+func TestPublishAndReceiveNotConnected(t *testing.T) {
+	r := NewBroker()
+
+	_, err := r.PublishAndReceive(context.TODO(), "test.request", &broker.Message{})
+	assert.Error(t, err)
+}
+
+func TestDelayedPublishing(t *testing.T) {
+	r := NewBroker(DelayedExchange()).(*rbroker)
+
+	m := r.buildPublishing("test.topic", &broker.Message{}, broker.WithDelay(time.Minute))
+	delay, ok := m.Headers[DelayHeader].(int64)
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute.Milliseconds(), delay, 1000)
+
+	// a message due is routed right away
+	m = r.buildPublishing("test.topic", &broker.Message{}, broker.WithDeliverAt(time.Now().Add(-time.Second)))
+	assert.NotContains(t, m.Headers, DelayHeader)
+
+	kind, args := exchangeKind(r.getExchange())
+	assert.Equal(t, DelayedExchangeType, kind)
+	assert.Equal(t, amqp.Table{"x-delayed-type": string(ExchangeTypeTopic)}, args)
+
+	// without the delayed exchange the header is not set
+	r = NewBroker().(*rbroker)
+	m = r.buildPublishing("test.topic", &broker.Message{}, broker.WithDelay(time.Minute))
+	assert.NotContains(t, m.Headers, DelayHeader)
+}
+
+func TestContentTypePublishing(t *testing.T) {
+	r := NewBroker().(*rbroker)
+
+	// the content-type header is the content_type property, the option takes precedence
+	m := r.buildPublishing("test.topic", &broker.Message{
+		Headers: map[string]string{ContentTypeHeader: "application/cloudevents+json"},
+	})
+	assert.Equal(t, "application/cloudevents+json", m.ContentType)
+
+	m = r.buildPublishing("test.topic", &broker.Message{
+		Headers: map[string]string{ContentTypeHeader: "application/cloudevents+json"},
+	}, ContentType("text/plain"))
+	assert.Equal(t, "text/plain", m.ContentType)
+
+	// the option keeps publishing its Content-Type header
+	m = r.buildPublishing("test.topic", &broker.Message{}, ContentType("text/plain"))
+	assert.Equal(t, "text/plain", m.Headers["Content-Type"])
+	assert.NotContains(t, m.Headers, ContentTypeHeader)
+}
@@ -0,0 +1,79 @@
+package redisstream
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/redis/go-redis/v9"
+)
+
+// ================= BROKER OPTIONS =================
+
+type clientKey struct{}
+
+// Client sets the redis client of the broker, it is not closed by Disconnect
+func Client(c redis.UniversalClient) broker.BrokerOption {
+	return broker.SetBrokerOption(clientKey{}, c)
+}
+
+type redisOptionsKey struct{}
+
+// RedisOptions sets the options of the redis client created by the broker,
+// instead of the broker addresses
+func RedisOptions(options redis.UniversalOptions) broker.BrokerOption {
+	return broker.SetBrokerOption(redisOptionsKey{}, options)
+}
+
+type maxLenKey struct{}
+
+// MaxLen trims the streams to about n entries on publish, the streams are not trimmed by default
+func MaxLen(n int64) broker.BrokerOption {
+	return broker.SetBrokerOption(maxLenKey{}, n)
+}
+
+// ================= SUBSCRIBE OPTIONS =================
+
+type consumerKey struct{}
+
+// Consumer sets the consumer name within the consumer group, the instance id of the broker by default.
+// The pending entries of a consumer are reclaimed by the other consumers of the group after ClaimMinIdle.
+func Consumer(name string) broker.SubscribeOption {
+	return broker.SetSubscribeOption(consumerKey{}, name)
+}
+
+type startIDKey struct{}
+
+// StartID sets the id the consumer group starts from when it is created.
+// DefaultStartID = "$", the entries added after the group creation; "0" consumes the whole stream.
+func StartID(id string) broker.SubscribeOption {
+	return broker.SetSubscribeOption(startIDKey{}, id)
+}
+
+type blockKey struct{}
+
+// Block sets how long XREADGROUP waits for new entries, it bounds the time an unsubscribe waits for the read
+func Block(d time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(blockKey{}, d)
+}
+
+type countKey struct{}
+
+// Count sets the maximum number of entries read at once
+func Count(n int64) broker.SubscribeOption {
+	return broker.SetSubscribeOption(countKey{}, n)
+}
+
+type claimMinIdleKey struct{}
+
+// ClaimMinIdle sets how long an entry is pending before it is reclaimed with XAUTOCLAIM,
+// the entries of a crashed consumer and the failed entries are redelivered after it
+func ClaimMinIdle(d time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(claimMinIdleKey{}, d)
+}
+
+type claimIntervalKey struct{}
+
+// ClaimInterval sets the interval of the XAUTOCLAIM of the pending entries, the entries are not reclaimed when 0
+func ClaimInterval(d time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(claimIntervalKey{}, d)
+}
@@ -0,0 +1,633 @@
+// Package redisstream provides a broker on top of redis streams:
+// a topic is a stream, a consumer group is a stream consumer group.
+package redisstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/redis/go-redis/extra/redisotel/v9"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	DefaultAddress = "127.0.0.1:6379"
+
+	// consumer groups
+	DefaultStartID             = "$"
+	DefaultBlock               = time.Second
+	DefaultCount         int64 = 10
+	DefaultClaimMinIdle        = time.Minute
+	DefaultClaimInterval       = 30 * time.Second
+
+	ErrNotConnected = errors.New("redis stream broker is not connected")
+)
+
+// the fields of the stream entries
+const (
+	fieldHeaders = "headers"
+	fieldKey     = "key"
+	fieldBody    = "body"
+)
+
+type rsBroker struct {
+	opts broker.BrokerOptions
+
+	mtx         sync.Mutex
+	client      redis.UniversalClient
+	ownClient   bool // the client is created by the broker and closed by Disconnect
+	connected   bool
+	subscribers map[*subscriber]struct{}
+
+	// request-reply patterns
+	instanceID       string
+	resps            sync.Map // correlation id -> chan *broker.Message
+	replyMtx         sync.Mutex
+	replySubscribers map[string]broker.Subscriber // reply topic -> subscription
+}
+
+// NewBroker returns a broker publishing with XADD and consuming with XREADGROUP.
+// The client is created from the RedisOptions, or the first broker address as a redis URL or host:port,
+// unless a client is given with Client.
+func NewBroker(opts ...broker.BrokerOption) broker.Broker {
+	options := broker.NewBrokerOptions(opts...)
+
+	return &rsBroker{
+		opts:       options,
+		instanceID: uuid.New().String(),
+	}
+}
+
+type subscriber struct {
+	r       *rsBroker
+	client  redis.UniversalClient
+	topic   string
+	opts    broker.SubscribeOptions
+	handler broker.Handler
+
+	consumer      string
+	block         time.Duration
+	count         int64
+	claimMinIdle  time.Duration
+	claimInterval time.Duration
+
+	// the group is destroyed on unsubscribe: the subscriptions without group and the reply subscriptions
+	ephemeral bool
+	closeOnce sync.Once
+
+	// stops the read loop, done is closed once it returned
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+type publication struct {
+	s   *subscriber
+	id  string
+	m   *broker.Message
+	err error
+}
+
+func (p *publication) Topic() string {
+	return p.s.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+// Ack acknowledges the entry with XACK, the entries not acked are reclaimed after ClaimMinIdle
+func (p *publication) Ack() error {
+	return p.s.client.XAck(context.Background(), p.s.topic, p.s.opts.Group, p.id).Err()
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+// Timestamp returns the time of the entry id
+func (p *publication) Timestamp() time.Time {
+	ms, _, _ := strings.Cut(p.id, "-")
+	millis, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+// Unsubscribe drains the subscription within broker.DefaultDrainTimeout, see Drain
+func (s *subscriber) Unsubscribe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return s.Drain(ctx)
+}
+
+// Drain implements broker.Drainer, the entries already read are handled before the subscription is closed
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.stop()
+
+	err := s.wait(ctx)
+	if cErr := s.close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// wait waits for the read loop to return
+func (s *subscriber) wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain subscription to %s: %w", s.topic, ctx.Err())
+	}
+}
+
+func (s *subscriber) close() error {
+	s.r.removeSubscriber(s)
+
+	if !s.ephemeral {
+		return nil
+	}
+
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.client.XGroupDestroy(context.Background(), s.topic, s.opts.Group).Err()
+	})
+	return err
+}
+
+// run reads the new entries of the group and reclaims the pending entries every claim interval, until ctx is done
+func (s *subscriber) run(ctx context.Context) {
+	defer close(s.done)
+
+	// the entries of the crashed consumers are reclaimed at start
+	var lastClaim time.Time
+
+	for ctx.Err() == nil {
+		if s.claimInterval > 0 && time.Since(lastClaim) >= s.claimInterval {
+			lastClaim = time.Now()
+			s.claim(ctx)
+		}
+
+		streams, err := s.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.opts.Group,
+			Consumer: s.consumer,
+			Streams:  []string{s.topic, ">"},
+			Count:    s.count,
+			Block:    s.block,
+		}).Result()
+		if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+			continue
+		}
+		if err != nil {
+			s.r.log(ctx, logger.ErrorLevel, "[redis stream] failed to read %s for group %s: %s", s.topic, s.opts.Group, err)
+			broker.EmitConsumerError(s.r.getMetrics(), s.topic, s.opts.Group)
+			sleep(ctx, s.block)
+			continue
+		}
+
+		// the entries read are handled even when the subscription is stopped
+		for _, stream := range streams {
+			for _, m := range stream.Messages {
+				s.handle(m)
+			}
+		}
+	}
+}
+
+// claim handles the entries pending for longer than the claim min idle:
+// the entries of the crashed consumers and the failed entries
+func (s *subscriber) claim(ctx context.Context) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := s.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.topic,
+			Group:    s.opts.Group,
+			MinIdle:  s.claimMinIdle,
+			Start:    start,
+			Count:    s.count,
+			Consumer: s.consumer,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.r.log(ctx, logger.ErrorLevel, "[redis stream] failed to claim the pending entries of %s for group %s: %s", s.topic, s.opts.Group, err)
+				broker.EmitConsumerError(s.r.getMetrics(), s.topic, s.opts.Group)
+			}
+			return
+		}
+
+		for _, m := range messages {
+			s.handle(m)
+		}
+
+		if next == "0-0" || len(next) == 0 {
+			return
+		}
+		start = next
+	}
+}
+
+func (s *subscriber) handle(entry redis.XMessage) {
+	ctx := context.Background()
+
+	m, err := decode(entry)
+	if err != nil {
+		// acked, it would be reclaimed forever
+		s.r.log(ctx, logger.ErrorLevel, "[redis stream] failed to decode entry %s of %s, skipped: %s", entry.ID, s.topic, err)
+		s.client.XAck(ctx, s.topic, s.opts.Group, entry.ID) //nolint
+		return
+	}
+
+	p := &publication{s: s, id: entry.ID, m: m}
+
+	start := time.Now()
+	err = s.handler(ctx, p)
+	broker.EmitHandled(s.r.getMetrics(), s.topic, err, time.Since(start))
+
+	if err == nil && s.opts.AutoAck {
+		if err := p.Ack(); err != nil {
+			s.r.log(ctx, logger.ErrorLevel, "[redis stream] failed to ack entry %s of %s: %s", entry.ID, s.topic, err)
+		}
+	} else if err != nil {
+		p.err = err
+		if errHandler := s.r.opts.ErrorHandler; errHandler != nil {
+			errHandler(ctx, p) //nolint
+		} else {
+			s.r.log(ctx, logger.ErrorLevel, "[redis stream] subscriber error: %v", err)
+		}
+	}
+}
+
+func (r *rsBroker) Init(opts ...broker.BrokerOption) error {
+	for _, o := range opts {
+		o(&r.opts)
+	}
+	return nil
+}
+
+func (r *rsBroker) Options() broker.BrokerOptions {
+	return r.opts
+}
+
+func (r *rsBroker) Address() string {
+	if len(r.opts.Addrs) > 0 && len(r.opts.Addrs[0]) > 0 {
+		return r.opts.Addrs[0]
+	}
+	return DefaultAddress
+}
+
+func (r *rsBroker) Connect() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.connected {
+		return nil
+	}
+
+	client, own, err := r.newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		if own {
+			client.Close() //nolint
+		}
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	r.client = client
+	r.ownClient = own
+	r.connected = true
+	r.subscribers = make(map[*subscriber]struct{})
+
+	// request-reply pattern
+	r.replyMtx.Lock()
+	r.resps = sync.Map{}
+	r.replySubscribers = make(map[string]broker.Subscriber)
+	r.replyMtx.Unlock()
+
+	return nil
+}
+
+func (r *rsBroker) newClient() (redis.UniversalClient, bool, error) {
+	if client, ok := r.opts.Context.Value(clientKey{}).(redis.UniversalClient); ok && client != nil {
+		return client, false, nil
+	}
+
+	var client redis.UniversalClient
+	if options, ok := r.opts.Context.Value(redisOptionsKey{}).(redis.UniversalOptions); ok {
+		client = redis.NewUniversalClient(&options)
+	} else {
+		addr := r.Address()
+		options, err := redis.ParseURL(addr)
+		if err != nil {
+			options = &redis.Options{Addr: addr}
+		}
+		client = redis.NewClient(options)
+	}
+
+	// opentelemetry tracing
+	if err := redisotel.InstrumentTracing(client); err != nil {
+		client.Close() //nolint
+		return nil, false, err
+	}
+
+	return client, true, nil
+}
+
+// Disconnect drains the broker within broker.DefaultDrainTimeout, see Drain
+func (r *rsBroker) Disconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return r.Drain(ctx)
+}
+
+// Drain implements broker.Drainer: the subscriptions stop reading,
+// the entries already read are handled, then the client is closed
+func (r *rsBroker) Drain(ctx context.Context) error {
+	r.mtx.Lock()
+	subscribers := make([]*subscriber, 0, len(r.subscribers))
+	for s := range r.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	r.mtx.Unlock()
+
+	for _, s := range subscribers {
+		s.stop()
+	}
+
+	var err error
+	for _, s := range subscribers {
+		if err = s.wait(ctx); err != nil {
+			break
+		}
+	}
+
+	for _, s := range subscribers {
+		if cErr := s.close(); cErr != nil {
+			r.log(ctx, logger.ErrorLevel, "[redis stream] failed to close subscription to %s: %s", s.topic, cErr)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.client != nil && r.ownClient {
+		if cErr := r.client.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	r.client = nil
+	r.connected = false
+
+	// request-reply pattern
+	r.replyMtx.Lock()
+	r.resps = sync.Map{}
+	r.replySubscribers = make(map[string]broker.Subscriber)
+	r.replyMtx.Unlock()
+
+	return err
+}
+
+func (r *rsBroker) Publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	publish := broker.ChainPublishMiddleware(r.publish, r.opts.PublishMiddlewares...)
+	return publish(ctx, topic, msg, opts...)
+}
+
+func (r *rsBroker) publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	if msg == nil {
+		return broker.EmptyMessageError{}
+	}
+
+	client, err := r.getClient()
+	if err != nil {
+		return err
+	}
+
+	values, err := encode(msg)
+	if err != nil {
+		return err
+	}
+
+	args := &redis.XAddArgs{
+		Stream: topic,
+		Values: values,
+	}
+	if maxLen := r.getMaxLen(); maxLen > 0 {
+		args.MaxLen = maxLen
+		args.Approx = true
+	}
+
+	err = client.XAdd(ctx, args).Err()
+	broker.EmitPublished(r.getMetrics(), topic, err)
+	return err
+}
+
+// Subscribe creates the consumer group of the subscription when it does not exist, with the stream.
+// The subscriptions without broker.WithSubscribeGroup have their own group, destroyed when unsubscribed.
+// The failed entries stay pending and are redelivered after ClaimMinIdle, see broker.WithSubscribeRetry
+// for the retry topics and the dead-letter topic.
+func (r *rsBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	client, err := r.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	opt := broker.NewSubscribeOptions(opts...)
+
+	// retry topics & dead-letter queue
+	if opt.Retry != nil {
+		return broker.SubscribeWithRetry(r, topic, handler, opts...)
+	}
+
+	handler = broker.WrapHandler(handler, r.opts, opt)
+
+	return r.subscribe(client, topic, handler, opt, !hasGroup(opts...))
+}
+
+func (r *rsBroker) subscribe(client redis.UniversalClient, topic string, handler broker.Handler, opt broker.SubscribeOptions, ephemeral bool) (*subscriber, error) {
+	s := &subscriber{
+		r:             r,
+		client:        client,
+		topic:         topic,
+		opts:          opt,
+		handler:       handler,
+		consumer:      r.instanceID,
+		block:         DefaultBlock,
+		count:         DefaultCount,
+		claimMinIdle:  DefaultClaimMinIdle,
+		claimInterval: DefaultClaimInterval,
+		ephemeral:     ephemeral,
+		done:          make(chan struct{}),
+	}
+
+	startID := DefaultStartID
+	if opt.Context != nil {
+		if consumer, ok := opt.Context.Value(consumerKey{}).(string); ok && len(consumer) > 0 {
+			s.consumer = consumer
+		}
+		if id, ok := opt.Context.Value(startIDKey{}).(string); ok && len(id) > 0 {
+			startID = id
+		}
+		if block, ok := opt.Context.Value(blockKey{}).(time.Duration); ok && block > 0 {
+			s.block = block
+		}
+		if count, ok := opt.Context.Value(countKey{}).(int64); ok && count > 0 {
+			s.count = count
+		}
+		if minIdle, ok := opt.Context.Value(claimMinIdleKey{}).(time.Duration); ok {
+			s.claimMinIdle = minIdle
+		}
+		if interval, ok := opt.Context.Value(claimIntervalKey{}).(time.Duration); ok {
+			s.claimInterval = interval
+		}
+	}
+
+	err := client.XGroupCreateMkStream(context.Background(), topic, opt.Group, startID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("failed to create consumer group %s of %s: %w", opt.Group, topic, err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+
+	r.mtx.Lock()
+	if r.subscribers == nil {
+		r.subscribers = make(map[*subscriber]struct{})
+	}
+	r.subscribers[s] = struct{}{}
+	r.mtx.Unlock()
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+func (r *rsBroker) removeSubscriber(s *subscriber) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.subscribers, s)
+}
+
+func (r *rsBroker) String() string {
+	return "redis stream"
+}
+
+func (r *rsBroker) getClient() (redis.UniversalClient, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.connected || r.client == nil {
+		return nil, ErrNotConnected
+	}
+	return r.client, nil
+}
+
+func (r *rsBroker) getMaxLen() int64 {
+	if n, ok := r.opts.Context.Value(maxLenKey{}).(int64); ok {
+		return n
+	}
+	return 0
+}
+
+func (r *rsBroker) getMetrics() *metrics.Metrics {
+	if r.opts.Metrics != nil {
+		return r.opts.Metrics
+	}
+	return metrics.Default()
+}
+
+func (r *rsBroker) log(ctx context.Context, level logger.Level, message string, args ...interface{}) {
+	r.getLogger().Logf(ctx, level, message, args...)
+}
+
+func (r *rsBroker) getLogger() logger.Logger {
+	if r.opts.Logger != nil {
+		return r.opts.Logger
+	}
+	return logger.DefaultLogger
+}
+
+// hasGroup tells whether the options set the consumer group, the default group of the subscribe options is random
+func hasGroup(opts ...broker.SubscribeOption) bool {
+	var options broker.SubscribeOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	return len(options.Group) > 0
+}
+
+func encode(msg *broker.Message) (map[string]interface{}, error) {
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	return map[string]interface{}{
+		fieldHeaders: headers,
+		fieldKey:     msg.Key,
+		fieldBody:    msg.Body,
+	}, nil
+}
+
+func decode(entry redis.XMessage) (*broker.Message, error) {
+	// the entries trimmed from the stream are claimed without fields
+	if entry.Values == nil {
+		return nil, errors.New("entry without fields")
+	}
+
+	m := &broker.Message{
+		Headers: make(map[string]string),
+	}
+
+	if headers, ok := entry.Values[fieldHeaders].(string); ok && len(headers) > 0 {
+		if err := json.Unmarshal([]byte(headers), &m.Headers); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
+		}
+		if m.Headers == nil {
+			m.Headers = make(map[string]string)
+		}
+	}
+
+	if key, ok := entry.Values[fieldKey].(string); ok && len(key) > 0 {
+		m.Key = []byte(key)
+	}
+
+	if body, ok := entry.Values[fieldBody].(string); ok {
+		m.Body = []byte(body)
+	}
+
+	return m, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
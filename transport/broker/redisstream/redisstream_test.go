@@ -0,0 +1,215 @@
+package redisstream
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBroker(t *testing.T, mr *miniredis.Miniredis) *rsBroker {
+	t.Helper()
+
+	r := NewBroker(broker.WithBrokerAddresses(mr.Addr())).(*rsBroker)
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() { r.Disconnect() }) //nolint
+
+	return r
+}
+
+func receive(t *testing.T, ch <-chan *broker.Message) *broker.Message {
+	t.Helper()
+
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func TestPublishAndSubscribe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newTestBroker(t, mr)
+
+	// every group receives the message
+	received := make(chan *broker.Message, 2)
+	for _, group := range []string{"group.a", "group.b"} {
+		_, err := r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error {
+			received <- e.Message()
+			return nil
+		}, broker.WithSubscribeGroup(group), Block(10*time.Millisecond))
+		require.NoError(t, err)
+	}
+
+	err := r.Publish(context.TODO(), "test.stream", &broker.Message{
+		Headers: map[string]string{"foo": "bar"},
+		Key:     []byte("key"),
+		Body:    []byte(`{"hello":"world"}`),
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		m := receive(t, received)
+		assert.Equal(t, "bar", m.Headers["foo"])
+		assert.Equal(t, []byte("key"), m.Key)
+		assert.Equal(t, []byte(`{"hello":"world"}`), m.Body)
+	}
+
+	// acked
+	pending, err := r.client.XPending(context.TODO(), "test.stream", "group.a").Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count)
+}
+
+func TestSubscribeSameGroup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newTestBroker(t, mr)
+
+	var count atomic.Int32
+	received := make(chan *broker.Message, 10)
+	for _, consumer := range []string{"consumer.a", "consumer.b"} {
+		_, err := r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error {
+			count.Add(1)
+			received <- e.Message()
+			return nil
+		}, broker.WithSubscribeGroup("group"), Consumer(consumer), Block(10*time.Millisecond))
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, r.Publish(context.TODO(), "test.stream", &broker.Message{Body: []byte("{}")}))
+	}
+
+	for i := 0; i < 4; i++ {
+		receive(t, received)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(4), count.Load())
+}
+
+func TestRedeliverFailed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newTestBroker(t, mr)
+
+	var attempts atomic.Int32
+	handled := make(chan *broker.Message, 1)
+	_, err := r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("failed")
+		}
+		handled <- e.Message()
+		return nil
+	},
+		broker.WithSubscribeGroup("group"),
+		Block(10*time.Millisecond),
+		ClaimMinIdle(20*time.Millisecond),
+		ClaimInterval(20*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.stream", &broker.Message{Body: []byte("{}")}))
+
+	receive(t, handled)
+	assert.Equal(t, int32(2), attempts.Load())
+}
+
+func TestReclaimCrashedConsumer(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newTestBroker(t, mr)
+	ctx := context.TODO()
+
+	// an entry read by a consumer which crashed before the ack
+	require.NoError(t, r.client.XGroupCreateMkStream(ctx, "test.stream", "group", "$").Err())
+	require.NoError(t, r.Publish(ctx, "test.stream", &broker.Message{Body: []byte("crashed")}))
+	_, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    "group",
+		Consumer: "crashed",
+		Streams:  []string{"test.stream", ">"},
+	}).Result()
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+
+	received := make(chan *broker.Message, 1)
+	_, err = r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	},
+		broker.WithSubscribeGroup("group"),
+		Block(10*time.Millisecond),
+		ClaimMinIdle(10*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("crashed"), receive(t, received).Body)
+}
+
+func TestUnsubscribeEphemeralGroup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newTestBroker(t, mr)
+	ctx := context.TODO()
+
+	durable, err := r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, broker.WithSubscribeGroup("group"), Block(10*time.Millisecond))
+	require.NoError(t, err)
+
+	ephemeral, err := r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, Block(10*time.Millisecond))
+	require.NoError(t, err)
+
+	groups, err := r.client.XInfoGroups(ctx, "test.stream").Result()
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	require.NoError(t, ephemeral.Unsubscribe())
+	require.NoError(t, durable.Unsubscribe())
+
+	groups, err = r.client.XInfoGroups(ctx, "test.stream").Result()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "group", groups[0].Name)
+	assert.Empty(t, r.subscribers)
+}
+
+func TestPublishAndReceive(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newTestBroker(t, mr)
+
+	_, err := r.Subscribe("test.request", func(ctx context.Context, e broker.Event) error {
+		m := e.Message()
+		return r.Publish(ctx, m.Headers["replyTo"], &broker.Message{
+			Headers: m.Headers,
+			Body:    append([]byte("reply:"), m.Body...),
+		})
+	}, broker.WithSubscribeGroup("service"), Block(10*time.Millisecond))
+	require.NoError(t, err)
+
+	reply, err := r.PublishAndReceive(context.TODO(), "test.request", &broker.Message{Body: []byte("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("reply:ping"), reply.Body)
+
+	_, err = r.PublishAndReceive(context.TODO(), "test.nobody", &broker.Message{Body: []byte("ping")},
+		broker.WithPublishTimeout(50*time.Millisecond))
+	assert.ErrorAs(t, err, &broker.RequestTimeoutResponse{})
+}
+
+func TestNotConnected(t *testing.T) {
+	r := NewBroker()
+
+	assert.ErrorIs(t, r.Publish(context.TODO(), "test.stream", &broker.Message{}), ErrNotConnected)
+
+	_, err := r.Subscribe("test.stream", func(ctx context.Context, e broker.Event) error { return nil })
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
@@ -0,0 +1,134 @@
+package redisstream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+const (
+	CorrelationIdHeader = "correlationId"
+)
+
+var (
+	RequestReplyTimeout = time.Second * 60
+)
+
+// PublishAndReceive publishes the request and waits for the reply with the same correlation id.
+// The reply stream is subscribed before the request is published, with a consumer group per instance,
+// so the reply reaches the instance waiting for it. The replyTo header of the request is the reply stream.
+// The call returns when the reply is received, the timeout expires or the context is done.
+func (r *rsBroker) PublishAndReceive(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) (reply *broker.Message, err error) {
+	options := broker.PublishOptions{
+		ReplyToTopic: fmt.Sprintf("%s.reply", topic),
+		Timeout:      RequestReplyTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if msg == nil {
+		return nil, broker.EmptyMessageError{}
+	}
+
+	if err := r.subscribeReply(options.ReplyToTopic, options.ReplyConsumerGroup); err != nil {
+		return nil, err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+
+	correlationId, ok := msg.Headers[CorrelationIdHeader]
+	if !ok || len(correlationId) == 0 {
+		correlationId = uuid.New().String()
+		msg.Headers[CorrelationIdHeader] = correlationId
+	}
+	msg.Headers[metadata.HeaderReplyTo] = options.ReplyToTopic
+
+	// register the pending call before publishing, so that an early reply is not lost
+	replyChan := make(chan *broker.Message, 1)
+	r.resps.Store(correlationId, replyChan)
+	defer r.resps.Delete(correlationId)
+
+	start := time.Now()
+	defer func() {
+		broker.EmitReplyDuration(r.getMetrics(), topic, broker.RequestStatus(err), time.Since(start))
+	}()
+
+	if err := r.Publish(ctx, topic, msg, opts...); err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if options.Timeout > 0 {
+		timer := time.NewTimer(options.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case reply := <-replyChan:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timeout:
+		return nil, broker.RequestTimeoutResponse{
+			Timeout: options.Timeout,
+		}
+	}
+}
+
+// subscribeReply subscribes the reply stream once, with a consumer group per instance destroyed on disconnect
+func (r *rsBroker) subscribeReply(topic string, group string) error {
+	r.replyMtx.Lock()
+	defer r.replyMtx.Unlock()
+
+	if _, ok := r.replySubscribers[topic]; ok {
+		return nil
+	}
+
+	client, err := r.getClient()
+	if err != nil {
+		return err
+	}
+
+	if len(group) == 0 {
+		group = topic
+	}
+
+	opt := broker.NewSubscribeOptions(broker.WithSubscribeGroup(fmt.Sprintf("%s.%s", group, r.instanceID)))
+	sub, err := r.subscribe(client, topic, broker.WrapHandler(r.handleReply, r.opts, opt), opt, true)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe reply topic %s: %w", topic, err)
+	}
+
+	if r.replySubscribers == nil {
+		r.replySubscribers = make(map[string]broker.Subscriber)
+	}
+	r.replySubscribers[topic] = sub
+
+	return nil
+}
+
+// handleReply passes the reply to the pending call of its correlation id, the other replies are dropped
+func (r *rsBroker) handleReply(ctx context.Context, e broker.Event) error {
+	if e.Message() == nil {
+		return nil
+	}
+
+	correlationId, ok := e.Message().Headers[CorrelationIdHeader]
+	if !ok {
+		return nil
+	}
+
+	if replyChan, ok := r.resps.LoadAndDelete(correlationId); ok {
+		replyChan.(chan *broker.Message) <- e.Message()
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/kingstonduy/go-core/metadata"
+)
+
+// RetryPolicy routes the messages whose handler returned an error through
+// delayed retry topics and, when every retry failed, to a dead-letter topic.
+//
+// Every hop records the number of failed attempts, the original topic, the last error
+// and the failure timestamps in the message headers (see metadata.HeaderRetry*).
+type RetryPolicy struct {
+	// Delays of the retry topics. One retry topic is used per delay,
+	// Example: []time.Duration{5 * time.Second, time.Minute, 10 * time.Minute}
+	Delays []time.Duration
+
+	// Topic receiving the messages that failed every retry.
+	// Default: <topic>.dlq
+	DeadLetterTopic string
+
+	// Name of the retry topic used for the given hop (starting at 1).
+	// Default: <topic>.retry.<hop>
+	RetryTopic func(topic string, hop int) string
+}
+
+// RetryGroup returns the consumer group subscribing to the retry topic of the given hop (starting at 1).
+// Every hop has its own group, so the offsets of a retry topic do not depend on the other topics.
+func RetryGroup(group string, hop int) string {
+	return fmt.Sprintf("%s.retry-%d", group, hop)
+}
+
+func (p RetryPolicy) retryTopic(topic string, hop int) string {
+	if p.RetryTopic != nil {
+		return p.RetryTopic(topic, hop)
+	}
+	return fmt.Sprintf("%s.retry.%d", topic, hop)
+}
+
+func (p RetryPolicy) deadLetterTopic(topic string) string {
+	if len(p.DeadLetterTopic) != 0 {
+		return p.DeadLetterTopic
+	}
+	return fmt.Sprintf("%s.dlq", topic)
+}
+
+// RetryTopics returns the retry topics and the dead-letter topic used for the topic
+func (p RetryPolicy) RetryTopics(topic string) (retryTopics []string, deadLetterTopic string) {
+	for i := range p.Delays {
+		retryTopics = append(retryTopics, p.retryTopic(topic, i+1))
+	}
+	return retryTopics, p.deadLetterTopic(topic)
+}
+
+// WithSubscribeRetry routes the failed messages through the retry topics of the policy.
+// The broker subscribes to every retry topic with the same handler and options, in the group RetryGroup.
+//
+// With RabbitMQ, a message forwarded to a retry topic is acked instead of being requeued,
+// RequeueOnError only applies when the message cannot be forwarded.
+func WithSubscribeRetry(policy RetryPolicy) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.Retry = &policy
+	}
+}
+
+func withoutSubscribeRetry() SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		opts.Retry = nil
+	}
+}
+
+// SubscribeWithRetry is used by the broker implementations when the subscribe options carry a RetryPolicy.
+// It subscribes the handler to the topic and to every retry topic of the policy.
+func SubscribeWithRetry(b Broker, topic string, h Handler, opts ...SubscribeOption) (Subscriber, error) {
+	options := NewSubscribeOptions(opts...)
+	policy := options.Retry
+	if policy == nil {
+		return b.Subscribe(topic, h, opts...)
+	}
+
+	// the middlewares wrap the handler, so they observe every attempt
+	h = ChainSubscribeMiddleware(h, b.Options().SubscribeMiddlewares...)
+
+	rs := &retrySubscriber{}
+
+	for i := range policy.Delays {
+		hop := i + 1
+		retryTopic := policy.retryTopic(topic, hop)
+
+		subOpts := append(append([]SubscribeOption{}, opts...), WithSubscribeGroup(RetryGroup(options.Group, hop)), withoutSubscribeRetry(), withSubscribeMiddlewareApplied())
+		if len(options.Queue) != 0 {
+			subOpts = append(subOpts, WithSubscribeQueue(fmt.Sprintf("%s.retry.%d", options.Queue, hop)))
+		}
+
+		sub, err := b.Subscribe(retryTopic, retryHandler(b, topic, h, *policy, options, hop), subOpts...)
+		if err != nil {
+			rs.Unsubscribe() //nolint
+			return nil, err
+		}
+		rs.retries = append(rs.retries, sub)
+	}
+
+	subOpts := append(append([]SubscribeOption{}, opts...), WithSubscribeGroup(options.Group), withoutSubscribeRetry(), withSubscribeMiddlewareApplied())
+	sub, err := b.Subscribe(topic, retryHandler(b, topic, h, *policy, options, 0), subOpts...)
+	if err != nil {
+		rs.Unsubscribe() //nolint
+		return nil, err
+	}
+	rs.Subscriber = sub
+
+	return rs, nil
+}
+
+// retryHandler handles the messages of a hop. Hop 0 is the original topic.
+// The handler waits for the delivery time of the message within its context,
+// the brokers cancel it when the subscription stops receiving the message, e.g. the kafka session ends.
+func retryHandler(b Broker, topic string, h Handler, policy RetryPolicy, options SubscribeOptions, hop int) Handler {
+	return func(ctx context.Context, e Event) error {
+		if hop > 0 && e.Message() != nil {
+			if err := waitRetryDeliverAt(ctx, e.Message().Headers[metadata.HeaderRetryDeliverAt]); err != nil {
+				return err
+			}
+		}
+
+		handleErr := h(ctx, e)
+		if handleErr == nil {
+			return nil
+		}
+
+		if e.Message() == nil {
+			return handleErr
+		}
+
+		nextTopic, msg := nextRetryMessage(topic, e.Message(), handleErr, policy, hop)
+		if err := b.Publish(ctx, nextTopic, msg); err != nil {
+			return fmt.Errorf("failed to forward message to %s: %w. Handler error: %v", nextTopic, err, handleErr)
+		}
+
+		// the message is now owned by the next hop
+		if !options.AutoAck {
+			return e.Ack()
+		}
+		return nil
+	}
+}
+
+func nextRetryMessage(topic string, m *Message, handleErr error, policy RetryPolicy, hop int) (string, *Message) {
+	now := time.Now()
+
+	headers := make(map[string]string, len(m.Headers)+6)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+
+	if _, ok := headers[metadata.HeaderRetryOriginalTopic]; !ok {
+		headers[metadata.HeaderRetryOriginalTopic] = topic
+	}
+	if _, ok := headers[metadata.HeaderRetryFirstFailedAt]; !ok {
+		headers[metadata.HeaderRetryFirstFailedAt] = now.Format(time.RFC3339Nano)
+	}
+	headers[metadata.HeaderRetryAttempts] = strconv.Itoa(hop + 1)
+	headers[metadata.HeaderRetryError] = handleErr.Error()
+	headers[metadata.HeaderRetryLastFailedAt] = now.Format(time.RFC3339Nano)
+
+	msg := &Message{
+		Headers: headers,
+		Body:    m.Body,
+		Key:     m.Key,
+	}
+
+	if hop < len(policy.Delays) {
+		headers[metadata.HeaderRetryDeliverAt] = now.Add(policy.Delays[hop]).Format(time.RFC3339Nano)
+		return policy.retryTopic(topic, hop+1), msg
+	}
+
+	delete(headers, metadata.HeaderRetryDeliverAt)
+	return policy.deadLetterTopic(topic), msg
+}
+
+func waitRetryDeliverAt(ctx context.Context, deliverAt string) error {
+	if len(deliverAt) == 0 {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, deliverAt)
+	if err != nil {
+		return nil
+	}
+
+	wait := time.Until(t)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type retrySubscriber struct {
+	Subscriber
+	retries []Subscriber
+}
+
+func (s *retrySubscriber) Unsubscribe() error {
+	var err error
+	if s.Subscriber != nil {
+		err = s.Subscriber.Unsubscribe()
+	}
+
+	for _, sub := range s.retries {
+		if rErr := sub.Unsubscribe(); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+
+	return err
+}
+
+// Drain implements Drainer, the subscription of the topic is drained before the retry subscriptions
+func (s *retrySubscriber) Drain(ctx context.Context) error {
+	var err error
+	if s.Subscriber != nil {
+		err = DrainSubscriber(ctx, s.Subscriber)
+	}
+
+	for _, sub := range s.retries {
+		if rErr := DrainSubscriber(ctx, sub); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+
+	return err
+}
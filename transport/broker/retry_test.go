@@ -0,0 +1,155 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func getMemoryBroker(t *testing.T, opts ...broker.BrokerOption) broker.Broker {
+	br := memory.NewBroker(opts...)
+	if err := br.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return br
+}
+
+func TestRetryThenDeadLetter(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	var topics []string
+	_, err := br.Subscribe("orders", func(ctx context.Context, e broker.Event) error {
+		topics = append(topics, e.Topic())
+		return errors.New("downstream unavailable")
+	}, broker.WithSubscribeGroup("orders"), broker.WithSubscribeRetry(broker.RetryPolicy{
+		Delays: []time.Duration{time.Millisecond, 2 * time.Millisecond},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := br.Publish(context.TODO(), "orders", &broker.Message{Body: []byte("order")}); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []string{"orders", "orders.retry.1", "orders.retry.2"}, topics)
+
+	dlq := br.(memory.Inspector).Published("orders.dlq")
+	if assert.Len(t, dlq, 1) {
+		headers := dlq[0].Headers
+		assert.Equal(t, "3", headers[metadata.HeaderRetryAttempts])
+		assert.Equal(t, "orders", headers[metadata.HeaderRetryOriginalTopic])
+		assert.Equal(t, "downstream unavailable", headers[metadata.HeaderRetryError])
+		assert.NotEmpty(t, headers[metadata.HeaderRetryFirstFailedAt])
+		assert.NotEmpty(t, headers[metadata.HeaderRetryLastFailedAt])
+		assert.Empty(t, headers[metadata.HeaderRetryDeliverAt])
+		assert.Equal(t, "order", string(dlq[0].Body))
+	}
+
+	retried := br.(memory.Inspector).Published("orders.retry.2")
+	if assert.Len(t, retried, 1) {
+		assert.Equal(t, "2", retried[0].Headers[metadata.HeaderRetryAttempts])
+		assert.NotEmpty(t, retried[0].Headers[metadata.HeaderRetryDeliverAt])
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	delay := 20 * time.Millisecond
+	var attempts []time.Time
+	_, err := br.Subscribe("payments", func(ctx context.Context, e broker.Event) error {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			return errors.New("temporary error")
+		}
+		return nil
+	}, broker.WithSubscribeRetry(broker.RetryPolicy{
+		Delays:          []time.Duration{delay},
+		DeadLetterTopic: "payments.failed",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := br.Publish(context.TODO(), "payments", &broker.Message{Body: []byte("payment")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.Len(t, attempts, 2) {
+		assert.GreaterOrEqual(t, attempts[1].Sub(attempts[0]), delay)
+	}
+	assert.Empty(t, br.(memory.Inspector).Published("payments.failed"))
+}
+
+func TestRetryManualAck(t *testing.T) {
+	br := getMemoryBroker(t)
+
+	sub, err := br.Subscribe("manual", func(ctx context.Context, e broker.Event) error {
+		return errors.New("failed")
+	}, broker.WithSubscribeAutoAck(false), broker.WithSubscribeRetry(broker.RetryPolicy{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := br.Publish(context.TODO(), "manual", &broker.Message{Body: []byte("body")}); err != nil {
+		t.Fatal(err)
+	}
+
+	// forwarded messages are acked
+	assert.Equal(t, 0, br.(memory.Inspector).Unacked("manual"))
+	assert.Len(t, br.(memory.Inspector).Published("manual.dlq"), 1)
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetryTopics(t *testing.T) {
+	policy := broker.RetryPolicy{
+		Delays: []time.Duration{time.Second, time.Minute},
+		RetryTopic: func(topic string, hop int) string {
+			return topic + "-retry-" + string(rune('0'+hop))
+		},
+	}
+
+	retryTopics, dlq := policy.RetryTopics("ledger")
+	assert.Equal(t, []string{"ledger-retry-1", "ledger-retry-2"}, retryTopics)
+	assert.Equal(t, "ledger.dlq", dlq)
+}
+
+// groupRecorder records the consumer group of every subscription
+type groupRecorder struct {
+	broker.Broker
+	groups map[string]string
+}
+
+func (b *groupRecorder) Subscribe(topic string, h broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	b.groups[topic] = broker.NewSubscribeOptions(opts...).Group
+	return b.Broker.Subscribe(topic, h, opts...)
+}
+
+func TestRetryGroups(t *testing.T) {
+	br := &groupRecorder{Broker: getMemoryBroker(t), groups: map[string]string{}}
+
+	_, err := broker.SubscribeWithRetry(br, "orders", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, broker.WithSubscribeGroup("billing"), broker.WithSubscribeRetry(broker.RetryPolicy{
+		Delays: []time.Duration{time.Second, time.Minute},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string]string{
+		"orders":         "billing",
+		"orders.retry.1": "billing.retry-1",
+		"orders.retry.2": "billing.retry-2",
+	}, br.groups)
+}
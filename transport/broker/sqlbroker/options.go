@@ -0,0 +1,86 @@
+package sqlbroker
+
+import (
+	"time"
+
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+// Dialect is the SQL dialect of the broker tables
+type Dialect int
+
+const (
+	// DialectPostgres locks the message table in SHARE mode while the new messages are claimed,
+	// so that the messages of the in-flight publishing transactions are not skipped by the cursors
+	DialectPostgres Dialect = iota
+	// DialectSQLite relies on the single writer of the database
+	DialectSQLite
+)
+
+// ================= BROKER OPTIONS =================
+
+type dialectKey struct{}
+
+// WithDialect sets the SQL dialect of the tables, DialectPostgres by default
+func WithDialect(d Dialect) broker.BrokerOption {
+	return broker.SetBrokerOption(dialectKey{}, d)
+}
+
+type messageTableKey struct{}
+
+// MessageTable sets the name of the message table, DefaultMessageTable by default
+func MessageTable(name string) broker.BrokerOption {
+	return broker.SetBrokerOption(messageTableKey{}, name)
+}
+
+type cursorTableKey struct{}
+
+// CursorTable sets the name of the cursor table, DefaultCursorTable by default
+func CursorTable(name string) broker.BrokerOption {
+	return broker.SetBrokerOption(cursorTableKey{}, name)
+}
+
+type deliveryTableKey struct{}
+
+// DeliveryTable sets the name of the delivery table, DefaultDeliveryTable by default
+func DeliveryTable(name string) broker.BrokerOption {
+	return broker.SetBrokerOption(deliveryTableKey{}, name)
+}
+
+type deleteOnAckKey struct{}
+
+// DeleteOnAck deletes the delivery rows on ack instead of marking them done
+func DeleteOnAck(b bool) broker.BrokerOption {
+	return broker.SetBrokerOption(deleteOnAckKey{}, b)
+}
+
+// ================= SUBSCRIBE OPTIONS =================
+
+type pollIntervalKey struct{}
+
+// PollInterval sets the interval between two polls when there is no message to handle
+func PollInterval(d time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(pollIntervalKey{}, d)
+}
+
+type batchSizeKey struct{}
+
+// BatchSize sets the maximum number of messages leased per poll
+func BatchSize(n int) broker.SubscribeOption {
+	return broker.SetSubscribeOption(batchSizeKey{}, n)
+}
+
+type visibilityTimeoutKey struct{}
+
+// VisibilityTimeout sets how long a leased message is hidden from the other consumers of the group.
+// The messages not acked are redelivered once their lease expired: the failed messages and the messages of a crashed consumer.
+func VisibilityTimeout(d time.Duration) broker.SubscribeOption {
+	return broker.SetSubscribeOption(visibilityTimeoutKey{}, d)
+}
+
+type fromOldestKey struct{}
+
+// FromOldest starts a new consumer group from the oldest message of the topic instead of the messages published after it
+func FromOldest() broker.SubscribeOption {
+	return broker.SetSubscribeOption(fromOldestKey{}, true)
+}
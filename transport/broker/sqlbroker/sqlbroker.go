@@ -0,0 +1,765 @@
+// Package sqlbroker provides a broker on top of the tables of a SQL database, for the deployments without a message bus.
+// The messages are rows of the message table, each consumer group has a cursor on the topic
+// and leases the messages passed by its cursor in the delivery table.
+package sqlbroker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metrics"
+	"github.com/kingstonduy/go-core/transport/broker"
+)
+
+var (
+	DefaultMessageTable  = "BROKER_MESSAGE"
+	DefaultCursorTable   = "BROKER_CURSOR"
+	DefaultDeliveryTable = "BROKER_DELIVERY"
+
+	// subscriptions
+	DefaultPollInterval      = time.Second
+	DefaultBatchSize         = 100
+	DefaultVisibilityTimeout = 30 * time.Second
+
+	ErrNotConnected = errors.New("sql broker is not connected")
+)
+
+// Purger deletes the old messages, to bound the size of the tables
+type Purger interface {
+	// Purge deletes the messages published before the time and their deliveries, consumed or not.
+	// It returns the number of deleted messages.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+type sqlBroker struct {
+	db   *database.Gdbc
+	opts broker.BrokerOptions
+
+	mtx         sync.Mutex
+	connected   bool
+	subscribers map[*subscriber]struct{}
+
+	// request-reply patterns
+	instanceID       string
+	resps            sync.Map // correlation id -> chan *broker.Message
+	replyMtx         sync.Mutex
+	replySubscribers map[string]broker.Subscriber // reply topic -> subscription
+}
+
+// NewBroker returns a broker storing the messages in the tables of the database.
+// Publish inserts the message in the transaction of the context, see database.Gdbc.WithinTransaction,
+// so the message is published only if the transaction commits.
+// The database is not closed by Disconnect.
+func NewBroker(db *database.Gdbc, opts ...broker.BrokerOption) broker.Broker {
+	options := broker.NewBrokerOptions(opts...)
+
+	return &sqlBroker{
+		db:         db,
+		opts:       options,
+		instanceID: uuid.New().String(),
+	}
+}
+
+type subscriber struct {
+	r       *sqlBroker
+	topic   string
+	opts    broker.SubscribeOptions
+	handler broker.Handler
+
+	pollInterval      time.Duration
+	batchSize         int
+	visibilityTimeout time.Duration
+
+	// the group is deleted on unsubscribe: the subscriptions without group and the reply subscriptions
+	ephemeral bool
+	closeOnce sync.Once
+
+	// stops the poll loop, done is closed once it returned
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// delivery is a message leased by a subscriber
+type delivery struct {
+	MessageID int64
+	Attempts  int
+	Key       []byte
+	Headers   sql.NullString
+	Body      []byte
+	CreatedAt int64
+}
+
+type publication struct {
+	s   *subscriber
+	d   delivery
+	m   *broker.Message
+	err error
+}
+
+func (p *publication) Topic() string {
+	return p.s.topic
+}
+
+func (p *publication) Message() *broker.Message {
+	return p.m
+}
+
+// Ack marks the delivery done, or deletes it with DeleteOnAck.
+// The deliveries not acked are redelivered once the visibility timeout expired.
+func (p *publication) Ack() error {
+	return p.s.ack(context.Background(), p.d.MessageID)
+}
+
+func (p *publication) Error() error {
+	return p.err
+}
+
+// Timestamp returns the time the message was published
+func (p *publication) Timestamp() time.Time {
+	return time.UnixMilli(p.d.CreatedAt)
+}
+
+func (s *subscriber) Options() broker.SubscribeOptions {
+	return s.opts
+}
+
+func (s *subscriber) Topic() string {
+	return s.topic
+}
+
+// Unsubscribe drains the subscription within broker.DefaultDrainTimeout, see Drain
+func (s *subscriber) Unsubscribe() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return s.Drain(ctx)
+}
+
+// Drain implements broker.Drainer, the messages already leased are handled before the subscription is closed
+func (s *subscriber) Drain(ctx context.Context) error {
+	s.stop()
+
+	err := s.wait(ctx)
+	if cErr := s.close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// wait waits for the poll loop to return
+func (s *subscriber) wait(ctx context.Context) error {
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to drain subscription to %s: %w", s.topic, ctx.Err())
+	}
+}
+
+// close deletes the cursor and the deliveries of the ephemeral group
+func (s *subscriber) close() error {
+	s.r.removeSubscriber(s)
+
+	if !s.ephemeral {
+		return nil
+	}
+
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.r.db.WithinTransaction(context.Background(), func(ctx context.Context) error {
+			_, err := s.r.db.Exec(ctx, s.r.bind(fmt.Sprintf(
+				"DELETE FROM %s WHERE TOPIC = ? AND GROUP_NAME = ?",
+				s.r.getDeliveryTable(),
+			)), s.topic, s.opts.Group)
+			if err != nil {
+				return fmt.Errorf("failed to delete deliveries of group %s: %w", s.opts.Group, err)
+			}
+
+			_, err = s.r.db.Exec(ctx, s.r.bind(fmt.Sprintf(
+				"DELETE FROM %s WHERE TOPIC = ? AND GROUP_NAME = ?",
+				s.r.getCursorTable(),
+			)), s.topic, s.opts.Group)
+			if err != nil {
+				return fmt.Errorf("failed to delete cursor of group %s: %w", s.opts.Group, err)
+			}
+			return nil
+		})
+	})
+	return err
+}
+
+// run polls the topic until ctx is done
+func (s *subscriber) run(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		n, err := s.poll(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.r.log(ctx, logger.ErrorLevel, "[sql broker] failed to poll %s for group %s: %s", s.topic, s.opts.Group, err)
+			broker.EmitConsumerError(s.r.getMetrics(), s.topic, s.opts.Group)
+		}
+
+		// poll again right away while the batches are full
+		if err == nil && n >= s.batchSize {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// poll claims the new messages of the topic for the group, then leases and handles a batch of deliveries.
+// It returns the number of handled deliveries.
+func (s *subscriber) poll(ctx context.Context) (int, error) {
+	if err := s.claim(ctx); err != nil {
+		return 0, err
+	}
+
+	deliveries, err := s.lease(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// the leased deliveries are handled even when the subscription is stopped
+	for _, d := range deliveries {
+		s.handle(d)
+	}
+	return len(deliveries), nil
+}
+
+// claim moves the cursor of the group over the new messages of the topic and creates their deliveries.
+// The consumers of the group race on the cursor position, a single one creates the deliveries.
+func (s *subscriber) claim(ctx context.Context) error {
+	r := s.r
+
+	return r.db.WithinTransaction(ctx, func(ctx context.Context) error {
+		// wait for the publishing transactions, their messages would be passed by the cursor once committed
+		if r.getDialect() == DialectPostgres {
+			if _, err := r.db.Exec(ctx, fmt.Sprintf("LOCK TABLE %s IN SHARE MODE", r.getMessageTable())); err != nil {
+				return fmt.Errorf("failed to lock message table: %w", err)
+			}
+		}
+
+		var position int64
+		err := r.db.QueryRow(ctx, r.bind(fmt.Sprintf(
+			"SELECT POSITION FROM %s WHERE TOPIC = ? AND GROUP_NAME = ?",
+			r.getCursorTable(),
+		)), s.topic, s.opts.Group).Scan(&position)
+		if err != nil {
+			return fmt.Errorf("failed to read cursor: %w", err)
+		}
+
+		var ids []int64
+		err = r.db.Select(ctx, &ids, r.bind(fmt.Sprintf(
+			"SELECT ID FROM %s WHERE TOPIC = ? AND ID > ? ORDER BY ID LIMIT ?",
+			r.getMessageTable(),
+		)), s.topic, position, s.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to select new messages: %w", err)
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		res, err := r.db.Exec(ctx, r.bind(fmt.Sprintf(
+			"UPDATE %s SET POSITION = ? WHERE TOPIC = ? AND GROUP_NAME = ? AND POSITION = ?",
+			r.getCursorTable(),
+		)), ids[len(ids)-1], s.topic, s.opts.Group, position)
+		if err != nil {
+			return fmt.Errorf("failed to move cursor: %w", err)
+		}
+
+		moved, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to move cursor: %w", err)
+		}
+
+		// claimed by another consumer of the group
+		if moved == 0 {
+			return nil
+		}
+
+		for _, id := range ids {
+			_, err := r.db.Exec(ctx, r.bind(fmt.Sprintf(
+				"INSERT INTO %s (TOPIC, GROUP_NAME, MESSAGE_ID, ATTEMPTS, LEASE_UNTIL) VALUES (?, ?, ?, 0, 0)",
+				r.getDeliveryTable(),
+			)), s.topic, s.opts.Group, id)
+			if err != nil {
+				return fmt.Errorf("failed to insert delivery: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// lease hides a batch of available deliveries from the other consumers for the visibility timeout
+// and returns them with their messages
+func (s *subscriber) lease(ctx context.Context) ([]delivery, error) {
+	r := s.r
+	now := time.Now()
+	owner := uuid.New().String()
+
+	_, err := r.db.Exec(ctx, r.bind(fmt.Sprintf(
+		"UPDATE %[1]s SET LEASE_OWNER = ?, LEASE_UNTIL = ?, ATTEMPTS = ATTEMPTS + 1 WHERE TOPIC = ? AND GROUP_NAME = ? AND DONE_AT IS NULL AND LEASE_UNTIL < ? AND MESSAGE_ID IN (SELECT MESSAGE_ID FROM %[1]s WHERE TOPIC = ? AND GROUP_NAME = ? AND DONE_AT IS NULL AND LEASE_UNTIL < ? ORDER BY MESSAGE_ID LIMIT ?)",
+		r.getDeliveryTable(),
+	)),
+		owner, now.Add(s.visibilityTimeout).UnixMilli(), s.topic, s.opts.Group, now.UnixMilli(),
+		s.topic, s.opts.Group, now.UnixMilli(), s.batchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lease deliveries: %w", err)
+	}
+
+	rows, err := r.db.Query(ctx, r.bind(fmt.Sprintf(
+		"SELECT D.MESSAGE_ID, D.ATTEMPTS, M.MESSAGE_KEY, M.HEADERS, M.BODY, M.CREATED_AT FROM %s D JOIN %s M ON M.ID = D.MESSAGE_ID WHERE D.TOPIC = ? AND D.GROUP_NAME = ? AND D.LEASE_OWNER = ? ORDER BY D.MESSAGE_ID",
+		r.getDeliveryTable(), r.getMessageTable(),
+	)), s.topic, s.opts.Group, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select leased deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []delivery
+	for rows.Next() {
+		var d delivery
+		if err := rows.Scan(&d.MessageID, &d.Attempts, &d.Key, &d.Headers, &d.Body, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to select leased deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (s *subscriber) handle(d delivery) {
+	ctx := context.Background()
+
+	m := &broker.Message{
+		Headers: make(map[string]string),
+		Key:     d.Key,
+		Body:    d.Body,
+	}
+	if d.Headers.Valid && len(d.Headers.String) > 0 {
+		if err := json.Unmarshal([]byte(d.Headers.String), &m.Headers); err != nil {
+			// acked, it would be redelivered forever
+			s.r.log(ctx, logger.ErrorLevel, "[sql broker] failed to unmarshal headers of message %d of %s, skipped: %s", d.MessageID, s.topic, err)
+			s.ack(ctx, d.MessageID) //nolint
+			return
+		}
+		if m.Headers == nil {
+			m.Headers = make(map[string]string)
+		}
+	}
+
+	p := &publication{s: s, d: d, m: m}
+
+	start := time.Now()
+	err := s.handler(ctx, p)
+	broker.EmitHandled(s.r.getMetrics(), s.topic, err, time.Since(start))
+
+	if err == nil && s.opts.AutoAck {
+		if err := p.Ack(); err != nil {
+			s.r.log(ctx, logger.ErrorLevel, "[sql broker] failed to ack message %d of %s: %s", d.MessageID, s.topic, err)
+		}
+	} else if err != nil {
+		p.err = err
+		if errHandler := s.r.opts.ErrorHandler; errHandler != nil {
+			errHandler(ctx, p) //nolint
+		} else {
+			s.r.log(ctx, logger.ErrorLevel, "[sql broker] subscriber error: %v", err)
+		}
+	}
+}
+
+func (s *subscriber) ack(ctx context.Context, messageID int64) error {
+	r := s.r
+
+	var err error
+	if r.getDeleteOnAck() {
+		_, err = r.db.Exec(ctx, r.bind(fmt.Sprintf(
+			"DELETE FROM %s WHERE TOPIC = ? AND GROUP_NAME = ? AND MESSAGE_ID = ?",
+			r.getDeliveryTable(),
+		)), s.topic, s.opts.Group, messageID)
+	} else {
+		_, err = r.db.Exec(ctx, r.bind(fmt.Sprintf(
+			"UPDATE %s SET DONE_AT = ?, LEASE_OWNER = NULL WHERE TOPIC = ? AND GROUP_NAME = ? AND MESSAGE_ID = ?",
+			r.getDeliveryTable(),
+		)), time.Now().UnixMilli(), s.topic, s.opts.Group, messageID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ack delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlBroker) Init(opts ...broker.BrokerOption) error {
+	for _, o := range opts {
+		o(&r.opts)
+	}
+	return nil
+}
+
+func (r *sqlBroker) Options() broker.BrokerOptions {
+	return r.opts
+}
+
+func (r *sqlBroker) Address() string {
+	return r.getMessageTable()
+}
+
+// Connect checks that the tables exist
+func (r *sqlBroker) Connect() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.connected {
+		return nil
+	}
+
+	if r.db == nil {
+		return errors.New("sql broker database is nil")
+	}
+
+	for _, table := range []string{r.getMessageTable(), r.getCursorTable(), r.getDeliveryTable()} {
+		rows, err := r.db.Query(context.Background(), fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", table))
+		if err != nil {
+			return fmt.Errorf("failed to query table %s: %w", table, err)
+		}
+		rows.Close()
+	}
+
+	r.connected = true
+	r.subscribers = make(map[*subscriber]struct{})
+
+	// request-reply pattern
+	r.replyMtx.Lock()
+	r.resps = sync.Map{}
+	r.replySubscribers = make(map[string]broker.Subscriber)
+	r.replyMtx.Unlock()
+
+	return nil
+}
+
+// Disconnect drains the broker within broker.DefaultDrainTimeout, see Drain
+func (r *sqlBroker) Disconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), broker.DefaultDrainTimeout)
+	defer cancel()
+
+	return r.Drain(ctx)
+}
+
+// Drain implements broker.Drainer: the subscriptions stop polling and the messages already leased are handled
+func (r *sqlBroker) Drain(ctx context.Context) error {
+	r.mtx.Lock()
+	subscribers := make([]*subscriber, 0, len(r.subscribers))
+	for s := range r.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	r.mtx.Unlock()
+
+	for _, s := range subscribers {
+		s.stop()
+	}
+
+	var err error
+	for _, s := range subscribers {
+		if err = s.wait(ctx); err != nil {
+			break
+		}
+	}
+
+	for _, s := range subscribers {
+		if cErr := s.close(); cErr != nil {
+			r.log(ctx, logger.ErrorLevel, "[sql broker] failed to close subscription to %s: %s", s.topic, cErr)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.connected = false
+
+	// request-reply pattern
+	r.replyMtx.Lock()
+	r.resps = sync.Map{}
+	r.replySubscribers = make(map[string]broker.Subscriber)
+	r.replyMtx.Unlock()
+
+	return err
+}
+
+func (r *sqlBroker) Publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	publish := broker.ChainPublishMiddleware(r.publish, r.opts.PublishMiddlewares...)
+	return publish(ctx, topic, msg, opts...)
+}
+
+func (r *sqlBroker) publish(ctx context.Context, topic string, msg *broker.Message, opts ...broker.PublishOption) error {
+	if msg == nil {
+		return broker.EmptyMessageError{}
+	}
+
+	if !r.isConnected() {
+		return ErrNotConnected
+	}
+
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	// joins the transaction of the context
+	_, err = r.db.Exec(ctx, r.bind(fmt.Sprintf(
+		"INSERT INTO %s (TOPIC, MESSAGE_KEY, HEADERS, BODY, CREATED_AT) VALUES (?, ?, ?, ?, ?)",
+		r.getMessageTable(),
+	)), topic, msg.Key, string(headers), msg.Body, time.Now().UnixMilli())
+	if err != nil {
+		err = fmt.Errorf("failed to insert message: %w", err)
+	}
+
+	broker.EmitPublished(r.getMetrics(), topic, err)
+	return err
+}
+
+// Subscribe creates the cursor of the consumer group when it does not exist,
+// at the last message of the topic or at the oldest one with FromOldest.
+// The subscriptions without broker.WithSubscribeGroup have their own group, deleted when unsubscribed.
+// The failed messages are redelivered after the VisibilityTimeout, see broker.WithSubscribeRetry
+// for the retry topics and the dead-letter topic.
+func (r *sqlBroker) Subscribe(topic string, handler broker.Handler, opts ...broker.SubscribeOption) (broker.Subscriber, error) {
+	if !r.isConnected() {
+		return nil, ErrNotConnected
+	}
+
+	opt := broker.NewSubscribeOptions(opts...)
+
+	// retry topics & dead-letter queue
+	if opt.Retry != nil {
+		return broker.SubscribeWithRetry(r, topic, handler, opts...)
+	}
+
+	handler = broker.WrapHandler(handler, r.opts, opt)
+
+	return r.subscribe(topic, handler, opt, !hasGroup(opts...))
+}
+
+func (r *sqlBroker) subscribe(topic string, handler broker.Handler, opt broker.SubscribeOptions, ephemeral bool) (*subscriber, error) {
+	s := &subscriber{
+		r:                 r,
+		topic:             topic,
+		opts:              opt,
+		handler:           handler,
+		pollInterval:      DefaultPollInterval,
+		batchSize:         DefaultBatchSize,
+		visibilityTimeout: DefaultVisibilityTimeout,
+		ephemeral:         ephemeral,
+		done:              make(chan struct{}),
+	}
+
+	var fromOldest bool
+	if opt.Context != nil {
+		if interval, ok := opt.Context.Value(pollIntervalKey{}).(time.Duration); ok && interval > 0 {
+			s.pollInterval = interval
+		}
+		if size, ok := opt.Context.Value(batchSizeKey{}).(int); ok && size > 0 {
+			s.batchSize = size
+		}
+		if timeout, ok := opt.Context.Value(visibilityTimeoutKey{}).(time.Duration); ok && timeout > 0 {
+			s.visibilityTimeout = timeout
+		}
+		fromOldest, _ = opt.Context.Value(fromOldestKey{}).(bool)
+	}
+
+	if err := r.createCursor(topic, opt.Group, fromOldest); err != nil {
+		return nil, err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	s.stop = stop
+
+	r.mtx.Lock()
+	if r.subscribers == nil {
+		r.subscribers = make(map[*subscriber]struct{})
+	}
+	r.subscribers[s] = struct{}{}
+	r.mtx.Unlock()
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+func (r *sqlBroker) createCursor(topic string, group string, fromOldest bool) error {
+	ctx := context.Background()
+
+	var position sql.NullInt64
+	if !fromOldest {
+		err := r.db.QueryRow(ctx, r.bind(fmt.Sprintf(
+			"SELECT MAX(ID) FROM %s WHERE TOPIC = ?",
+			r.getMessageTable(),
+		)), topic).Scan(&position)
+		if err != nil {
+			return fmt.Errorf("failed to read last message of %s: %w", topic, err)
+		}
+	}
+
+	_, err := r.db.Exec(ctx, r.bind(fmt.Sprintf(
+		"INSERT INTO %s (TOPIC, GROUP_NAME, POSITION) VALUES (?, ?, ?) ON CONFLICT (TOPIC, GROUP_NAME) DO NOTHING",
+		r.getCursorTable(),
+	)), topic, group, position.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to create cursor of group %s: %w", group, err)
+	}
+	return nil
+}
+
+// Purge implements Purger.
+func (r *sqlBroker) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+
+	purge := func(ctx context.Context) error {
+		_, err := r.db.Exec(ctx, r.bind(fmt.Sprintf(
+			"DELETE FROM %s WHERE MESSAGE_ID IN (SELECT ID FROM %s WHERE CREATED_AT < ?)",
+			r.getDeliveryTable(), r.getMessageTable(),
+		)), before.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to purge deliveries: %w", err)
+		}
+
+		res, err := r.db.Exec(ctx, r.bind(fmt.Sprintf(
+			"DELETE FROM %s WHERE CREATED_AT < ?",
+			r.getMessageTable(),
+		)), before.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to purge messages: %w", err)
+		}
+
+		n, err = res.RowsAffected()
+		return err
+	}
+
+	if database.ExtractTx(ctx) != nil {
+		return n, purge(ctx)
+	}
+	err := r.db.WithinTransaction(ctx, purge)
+	return n, err
+}
+
+func (r *sqlBroker) removeSubscriber(s *subscriber) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	delete(r.subscribers, s)
+}
+
+func (r *sqlBroker) String() string {
+	return "sql"
+}
+
+func (r *sqlBroker) isConnected() bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	return r.connected
+}
+
+func (r *sqlBroker) getDialect() Dialect {
+	if d, ok := r.opts.Context.Value(dialectKey{}).(Dialect); ok {
+		return d
+	}
+	return DialectPostgres
+}
+
+func (r *sqlBroker) getMessageTable() string {
+	if name, ok := r.opts.Context.Value(messageTableKey{}).(string); ok && len(name) > 0 {
+		return name
+	}
+	return DefaultMessageTable
+}
+
+func (r *sqlBroker) getCursorTable() string {
+	if name, ok := r.opts.Context.Value(cursorTableKey{}).(string); ok && len(name) > 0 {
+		return name
+	}
+	return DefaultCursorTable
+}
+
+func (r *sqlBroker) getDeliveryTable() string {
+	if name, ok := r.opts.Context.Value(deliveryTableKey{}).(string); ok && len(name) > 0 {
+		return name
+	}
+	return DefaultDeliveryTable
+}
+
+func (r *sqlBroker) getDeleteOnAck() bool {
+	b, _ := r.opts.Context.Value(deleteOnAckKey{}).(bool)
+	return b
+}
+
+func (r *sqlBroker) getMetrics() *metrics.Metrics {
+	if r.opts.Metrics != nil {
+		return r.opts.Metrics
+	}
+	return metrics.Default()
+}
+
+func (r *sqlBroker) log(ctx context.Context, level logger.Level, message string, args ...interface{}) {
+	r.getLogger().Logf(ctx, level, message, args...)
+}
+
+func (r *sqlBroker) getLogger() logger.Logger {
+	if r.opts.Logger != nil {
+		return r.opts.Logger
+	}
+	return logger.DefaultLogger
+}
+
+// bind replaces the '?' placeholders by the placeholders of the dialect
+func (r *sqlBroker) bind(query string) string {
+	if r.getDialect() != DialectPostgres {
+		return query
+	}
+
+	var (
+		sb strings.Builder
+		n  int
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			sb.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// hasGroup tells whether the options set the consumer group, the default group of the subscribe options is random
+func hasGroup(opts ...broker.SubscribeOption) bool {
+	var options broker.SubscribeOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	return len(options.Group) > 0
+}
@@ -0,0 +1,283 @@
+package sqlbroker
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kingstonduy/go-core/database"
+	"github.com/kingstonduy/go-core/database/sqlx"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+var createTables = []string{
+	`CREATE TABLE BROKER_MESSAGE (
+		ID          INTEGER PRIMARY KEY AUTOINCREMENT,
+		TOPIC       TEXT NOT NULL,
+		MESSAGE_KEY BLOB,
+		HEADERS     TEXT,
+		BODY        BLOB,
+		CREATED_AT  BIGINT NOT NULL
+	)`,
+	`CREATE TABLE BROKER_CURSOR (
+		TOPIC      TEXT NOT NULL,
+		GROUP_NAME TEXT NOT NULL,
+		POSITION   BIGINT NOT NULL,
+		PRIMARY KEY (TOPIC, GROUP_NAME)
+	)`,
+	`CREATE TABLE BROKER_DELIVERY (
+		TOPIC       TEXT NOT NULL,
+		GROUP_NAME  TEXT NOT NULL,
+		MESSAGE_ID  BIGINT NOT NULL,
+		ATTEMPTS    INTEGER NOT NULL DEFAULT 0,
+		LEASE_OWNER TEXT,
+		LEASE_UNTIL BIGINT NOT NULL DEFAULT 0,
+		DONE_AT     BIGINT,
+		PRIMARY KEY (TOPIC, GROUP_NAME, MESSAGE_ID)
+	)`,
+}
+
+func getConnection(t *testing.T) *database.Gdbc {
+	db, err := sqlx.NewSqlxGdbc("sqlite", filepath.Join(t.TempDir(), "broker.db"), database.WithMaxOpen(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.TODO()) })
+
+	for _, query := range createTables {
+		if _, err := db.Exec(context.TODO(), query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func getBroker(t *testing.T, db *database.Gdbc, opts ...broker.BrokerOption) *sqlBroker {
+	r := NewBroker(db, append([]broker.BrokerOption{WithDialect(DialectSQLite)}, opts...)...).(*sqlBroker)
+	require.NoError(t, r.Connect())
+	t.Cleanup(func() { r.Disconnect() }) //nolint
+
+	return r
+}
+
+func receive(t *testing.T, ch <-chan *broker.Message) *broker.Message {
+	t.Helper()
+
+	select {
+	case m := <-ch:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+func count(t *testing.T, db *database.Gdbc, query string) int {
+	var n int
+	require.NoError(t, db.Get(context.TODO(), &n, query))
+	return n
+}
+
+func TestPublishAndSubscribe(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db)
+
+	// every group receives the message, the consumers of a group share the messages
+	var handled atomic.Int32
+	received := make(chan *broker.Message, 10)
+	for _, group := range []string{"group.a", "group.a", "group.b"} {
+		_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+			handled.Add(1)
+			received <- e.Message()
+			return nil
+		}, broker.WithSubscribeGroup(group), PollInterval(10*time.Millisecond))
+		require.NoError(t, err)
+	}
+
+	err := r.Publish(context.TODO(), "test.topic", &broker.Message{
+		Headers: map[string]string{"foo": "bar"},
+		Key:     []byte("key"),
+		Body:    []byte(`{"hello":"world"}`),
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		m := receive(t, received)
+		assert.Equal(t, "bar", m.Headers["foo"])
+		assert.Equal(t, []byte("key"), m.Key)
+		assert.Equal(t, []byte(`{"hello":"world"}`), m.Body)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), handled.Load())
+	assert.Equal(t, 2, count(t, db, "SELECT COUNT(*) FROM BROKER_DELIVERY WHERE DONE_AT IS NOT NULL"))
+}
+
+func TestPublishWithinTransaction(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db)
+
+	received := make(chan *broker.Message, 10)
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	}, broker.WithSubscribeGroup("group"), PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = db.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		if err := r.Publish(ctx, "test.topic", &broker.Message{Body: []byte("rolled back")}); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	err = db.WithinTransaction(context.TODO(), func(ctx context.Context) error {
+		return r.Publish(ctx, "test.topic", &broker.Message{Body: []byte("committed")})
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("committed"), receive(t, received).Body)
+	assert.Equal(t, 1, count(t, db, "SELECT COUNT(*) FROM BROKER_MESSAGE"))
+}
+
+func TestRedeliverAfterVisibilityTimeout(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db, DeleteOnAck(true))
+
+	var attempts atomic.Int32
+	handled := make(chan *broker.Message, 1)
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		if attempts.Add(1) == 1 {
+			return errors.New("failed")
+		}
+		handled <- e.Message()
+		return nil
+	},
+		broker.WithSubscribeGroup("group"),
+		PollInterval(10*time.Millisecond),
+		VisibilityTimeout(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("{}")}))
+
+	receive(t, handled)
+	assert.Equal(t, int32(2), attempts.Load())
+
+	// deleted on ack
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, count(t, db, "SELECT COUNT(*) FROM BROKER_DELIVERY"))
+}
+
+func TestFromOldest(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("old")}))
+
+	received := make(chan *broker.Message, 10)
+	handler := func(ctx context.Context, e broker.Event) error {
+		received <- e.Message()
+		return nil
+	}
+
+	_, err := r.Subscribe("test.topic", handler, broker.WithSubscribeGroup("latest"), PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	_, err = r.Subscribe("test.topic", handler, broker.WithSubscribeGroup("oldest"), PollInterval(10*time.Millisecond), FromOldest())
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("old"), receive(t, received).Body)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("new")}))
+	assert.Equal(t, []byte("new"), receive(t, received).Body)
+	assert.Equal(t, []byte("new"), receive(t, received).Body)
+}
+
+func TestUnsubscribeEphemeralGroup(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db)
+
+	durable, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, broker.WithSubscribeGroup("group"), PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	ephemeral, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("{}")}))
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, ephemeral.Unsubscribe())
+	require.NoError(t, durable.Unsubscribe())
+
+	assert.Equal(t, 1, count(t, db, "SELECT COUNT(*) FROM BROKER_CURSOR WHERE GROUP_NAME = 'group'"))
+	assert.Equal(t, 1, count(t, db, "SELECT COUNT(*) FROM BROKER_CURSOR"))
+	assert.Equal(t, 1, count(t, db, "SELECT COUNT(*) FROM BROKER_DELIVERY"))
+	assert.Empty(t, r.subscribers)
+}
+
+func TestPublishAndReceive(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db)
+
+	_, err := r.Subscribe("test.request", func(ctx context.Context, e broker.Event) error {
+		m := e.Message()
+		return r.Publish(ctx, m.Headers[metadata.HeaderReplyTo], &broker.Message{
+			Headers: m.Headers,
+			Body:    append([]byte("reply:"), m.Body...),
+		})
+	}, broker.WithSubscribeGroup("service"), PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	reply, err := r.PublishAndReceive(context.TODO(), "test.request", &broker.Message{Body: []byte("ping")})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("reply:ping"), reply.Body)
+
+	_, err = r.PublishAndReceive(context.TODO(), "test.nobody", &broker.Message{Body: []byte("ping")},
+		broker.WithPublishTimeout(50*time.Millisecond))
+	assert.ErrorAs(t, err, &broker.RequestTimeoutResponse{})
+}
+
+func TestPurge(t *testing.T) {
+	db := getConnection(t)
+	r := getBroker(t, db)
+
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error {
+		return nil
+	}, broker.WithSubscribeGroup("group"), PollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, r.Publish(context.TODO(), "test.topic", &broker.Message{Body: []byte("old")}))
+	time.Sleep(50 * time.Millisecond)
+
+	n, err := r.Purge(context.TODO(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	assert.Equal(t, 0, count(t, db, "SELECT COUNT(*) FROM BROKER_MESSAGE"))
+	assert.Equal(t, 0, count(t, db, "SELECT COUNT(*) FROM BROKER_DELIVERY"))
+}
+
+func TestNotConnected(t *testing.T) {
+	r := NewBroker(getConnection(t), WithDialect(DialectSQLite))
+
+	assert.ErrorIs(t, r.Publish(context.TODO(), "test.topic", &broker.Message{}), ErrNotConnected)
+
+	_, err := r.Subscribe("test.topic", func(ctx context.Context, e broker.Event) error { return nil })
+	assert.ErrorIs(t, err, ErrNotConnected)
+
+	// the tables do not exist
+	assert.Error(t, NewBroker(getConnection(t), MessageTable("MISSING")).Connect())
+}
@@ -0,0 +1,221 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+
+	"github.com/kingstonduy/go-core/codec"
+	"github.com/kingstonduy/go-core/codec/json"
+	"github.com/kingstonduy/go-core/logger"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/validation"
+)
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+var (
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+// TypedHandler handles the decoded body of the message of the event
+type TypedHandler[T any] func(ctx context.Context, v T, e Event) error
+
+// TypedPublisher publishes the values of T encoded by its codec
+type TypedPublisher[T any] interface {
+	// Publish encodes the value, see Encode, and publishes it to the topic
+	Publish(ctx context.Context, topic string, v T, opts ...PublishOption) error
+	// Encode returns the message of the value, its content-type header is the content type of the codec
+	Encode(v T) (*Message, error)
+}
+
+type TypedPublisherOptions struct {
+	// Default: ContentTypeJSON
+	ContentType string
+	// Default: the json codec
+	Codec codec.Codec
+}
+
+type TypedPublisherOption func(*TypedPublisherOptions)
+
+// WithPublisherCodec encodes the published values with the codec, the messages carry the content type
+func WithPublisherCodec(contentType string, c codec.Codec) TypedPublisherOption {
+	return func(opts *TypedPublisherOptions) {
+		opts.ContentType = contentType
+		opts.Codec = c
+	}
+}
+
+func NewTypedPublisherOptions(opts ...TypedPublisherOption) TypedPublisherOptions {
+	options := TypedPublisherOptions{
+		ContentType: ContentTypeJSON,
+		Codec:       json.NewJsonCodec(),
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+type typedPublisher[T any] struct {
+	broker Broker
+	opts   TypedPublisherOptions
+}
+
+// NewTypedPublisher returns a publisher of the values of T on the broker, encoded as JSON by default
+func NewTypedPublisher[T any](b Broker, opts ...TypedPublisherOption) TypedPublisher[T] {
+	return &typedPublisher[T]{
+		broker: b,
+		opts:   NewTypedPublisherOptions(opts...),
+	}
+}
+
+// Encode implements TypedPublisher.
+func (p *typedPublisher[T]) Encode(v T) (*Message, error) {
+	body, err := p.opts.Codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T with the %s codec: %w", v, p.opts.Codec, err)
+	}
+
+	return &Message{
+		Headers: map[string]string{metadata.HeaderContentType: p.opts.ContentType},
+		Body:    body,
+	}, nil
+}
+
+// Publish implements TypedPublisher.
+func (p *typedPublisher[T]) Publish(ctx context.Context, topic string, v T, opts ...PublishOption) error {
+	m, err := p.Encode(v)
+	if err != nil {
+		return err
+	}
+	return p.broker.Publish(ctx, topic, m, opts...)
+}
+
+type subscribeCodecsKey struct{}
+type subscribeValidatorKey struct{}
+
+// WithSubscribeCodec decodes the messages of the content type with the codec, see TypedSubscribe.
+// The JSON codec is registered by default.
+func WithSubscribeCodec(contentType string, c codec.Codec) SubscribeOption {
+	return func(opts *SubscribeOptions) {
+		if opts.Context == nil {
+			opts.Context = context.Background()
+		}
+
+		codecs := map[string]codec.Codec{}
+		if registered, ok := opts.Context.Value(subscribeCodecsKey{}).(map[string]codec.Codec); ok {
+			for ct, c := range registered {
+				codecs[ct] = c
+			}
+		}
+		codecs[contentType] = c
+
+		opts.Context = context.WithValue(opts.Context, subscribeCodecsKey{}, codecs)
+	}
+}
+
+// WithSubscribeValidator validates the decoded values of a typed subscription, see TypedSubscribe.
+// Default: validation.DefaultValidator
+func WithSubscribeValidator(v validation.Validator) SubscribeOption {
+	return SetSubscribeOption(subscribeValidatorKey{}, v)
+}
+
+// TypedSubscribe subscribes the handler of T to the topic.
+// The body of the messages is decoded by the codec of their content-type header, the JSON codec when it is missing,
+// then validated by the validator of the subscription before the handler is called.
+//
+// The handler is not called for the messages which cannot be decoded (InvalidDataFormatError),
+// are empty (EmptyMessageError) or invalid (the error of the validator): the error is returned to the broker.
+func TypedSubscribe[T any](b Broker, topic string, h TypedHandler[T], opts ...SubscribeOption) (Subscriber, error) {
+	options := NewSubscribeOptions(opts...)
+
+	codecs := map[string]codec.Codec{ContentTypeJSON: json.NewJsonCodec()}
+	if registered, ok := options.Context.Value(subscribeCodecsKey{}).(map[string]codec.Codec); ok {
+		for ct, c := range registered {
+			codecs[ct] = c
+		}
+	}
+
+	validator, _ := options.Context.Value(subscribeValidatorKey{}).(validation.Validator)
+
+	return b.Subscribe(topic, func(ctx context.Context, e Event) error {
+		v, err := decodeTyped[T](ctx, e, codecs)
+		if err != nil {
+			return err
+		}
+
+		if err := getValidator(validator).Validate(v); err != nil {
+			return err
+		}
+
+		return h(ctx, v, e)
+	}, opts...)
+}
+
+func getValidator(v validation.Validator) validation.Validator {
+	if v != nil {
+		return v
+	}
+	return validation.DefaultValidator
+}
+
+// decodeTyped decodes the body of the message of the event with the codec of its content type
+func decodeTyped[T any](ctx context.Context, e Event, codecs map[string]codec.Codec) (T, error) {
+	var v T
+
+	m := e.Message()
+	if m == nil || len(m.Body) == 0 {
+		logger.Infof(ctx, "Topic: %s. Empty message body", e.Topic())
+		return v, EmptyMessageError{}
+	}
+
+	contentType := contentTypeOf(m.Headers)
+	c, ok := codecs[contentType]
+	if !ok {
+		return v, fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+
+	// the pointer types are decoded into a new value, e.g. the proto messages
+	target := any(&v)
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Pointer {
+		v = reflect.New(t.Elem()).Interface().(T)
+		target = v
+	}
+
+	if err := c.Unmarshal(m.Body, target); err != nil {
+		logger.Infof(ctx, "Topic: %s. Invalid message format: %v", e.Topic(), err)
+		return v, InvalidDataFormatError{}
+	}
+	return v, nil
+}
+
+// contentTypeOf returns the media type of the content-type header, ContentTypeJSON when it is missing
+func contentTypeOf(headers map[string]string) string {
+	value, ok := headers[metadata.HeaderContentType]
+	if !ok {
+		for k, v := range headers {
+			if strings.EqualFold(k, metadata.HeaderContentType) {
+				value = v
+				break
+			}
+		}
+	}
+
+	if len(value) == 0 {
+		return ContentTypeJSON
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(value); err == nil {
+		return mediaType
+	}
+	return value
+}
@@ -0,0 +1,143 @@
+package broker_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kingstonduy/go-core/codec"
+	"github.com/kingstonduy/go-core/metadata"
+	"github.com/kingstonduy/go-core/transport/broker"
+	"github.com/kingstonduy/go-core/transport/broker/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderCreated struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+}
+
+// orderValidator rejects the orders without id
+type orderValidator struct{}
+
+func (orderValidator) Validate(obj interface{}) error {
+	if order, ok := obj.(orderCreated); !ok || len(order.ID) == 0 {
+		return errors.New("id is required")
+	}
+	return nil
+}
+
+// upperCodec encodes the id of an order as an upper case text
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(*orderCreated).ID)), nil
+}
+
+func (upperCodec) Unmarshal(b []byte, v interface{}) error {
+	v.(*orderCreated).ID = strings.ToLower(string(b))
+	return nil
+}
+
+func (upperCodec) String() string {
+	return "upper"
+}
+
+var _ codec.Codec = upperCodec{}
+
+func getTypedBroker(t *testing.T) (broker.Broker, *[]error) {
+	var errs []error
+	br := getMemoryBroker(t, broker.WithBrokerErrorHandler(func(ctx context.Context, e broker.Event) error {
+		errs = append(errs, e.Error())
+		return nil
+	}))
+	return br, &errs
+}
+
+func TestTypedPublishSubscribe(t *testing.T) {
+	br, errs := getTypedBroker(t)
+
+	var (
+		received []orderCreated
+		topics   []string
+	)
+	_, err := broker.TypedSubscribe(br, "order.created", func(ctx context.Context, order orderCreated, e broker.Event) error {
+		received = append(received, order)
+		topics = append(topics, e.Topic())
+		return nil
+	}, broker.WithSubscribeValidator(orderValidator{}))
+	require.NoError(t, err)
+
+	pub := broker.NewTypedPublisher[orderCreated](br)
+	require.NoError(t, pub.Publish(context.TODO(), "order.created", orderCreated{ID: "1", Amount: 10.5}))
+
+	published := br.(memory.Inspector).Published("order.created")
+	require.Len(t, published, 1)
+	assert.Equal(t, broker.ContentTypeJSON, published[0].Headers[metadata.HeaderContentType])
+	assert.JSONEq(t, `{"id":"1","amount":10.5}`, string(published[0].Body))
+
+	// the messages without content type are decoded as JSON
+	require.NoError(t, br.Publish(context.TODO(), "order.created", &broker.Message{Body: []byte(`{"id":"2"}`)}))
+
+	assert.Equal(t, []orderCreated{{ID: "1", Amount: 10.5}, {ID: "2"}}, received)
+	assert.Equal(t, []string{"order.created", "order.created"}, topics)
+	assert.Empty(t, *errs)
+}
+
+func TestTypedSubscribeRejects(t *testing.T) {
+	br, errs := getTypedBroker(t)
+
+	called := false
+	_, err := broker.TypedSubscribe(br, "order.created", func(ctx context.Context, order orderCreated, e broker.Event) error {
+		called = true
+		return nil
+	}, broker.WithSubscribeValidator(orderValidator{}))
+	require.NoError(t, err)
+
+	messages := []*broker.Message{
+		{Body: []byte(`{"amount":1}`)},
+		{Body: []byte(`not json`)},
+		{Body: nil},
+		{Headers: map[string]string{metadata.HeaderContentType: "text/csv"}, Body: []byte(`1,1`)},
+	}
+	for _, m := range messages {
+		require.NoError(t, br.Publish(context.TODO(), "order.created", m))
+	}
+
+	assert.False(t, called)
+	if assert.Len(t, *errs, 4) {
+		assert.EqualError(t, (*errs)[0], "id is required")
+		assert.ErrorAs(t, (*errs)[1], &broker.InvalidDataFormatError{})
+		assert.ErrorAs(t, (*errs)[2], &broker.EmptyMessageError{})
+		assert.ErrorIs(t, (*errs)[3], broker.ErrUnsupportedContentType)
+	}
+}
+
+func TestTypedCodecByContentType(t *testing.T) {
+	br, errs := getTypedBroker(t)
+
+	var received []*orderCreated
+	_, err := broker.TypedSubscribe(br, "order.created", func(ctx context.Context, order *orderCreated, e broker.Event) error {
+		received = append(received, order)
+		return nil
+	}, broker.WithSubscribeCodec("text/x-upper", upperCodec{}))
+	require.NoError(t, err)
+
+	pub := broker.NewTypedPublisher[*orderCreated](br, broker.WithPublisherCodec("text/x-upper", upperCodec{}))
+	require.NoError(t, pub.Publish(context.TODO(), "order.created", &orderCreated{ID: "abc"}))
+
+	// the parameters of the content type are ignored, the JSON codec is kept
+	require.NoError(t, br.Publish(context.TODO(), "order.created", &broker.Message{
+		Headers: map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:    []byte(`{"id":"def"}`),
+	}))
+
+	published := br.(memory.Inspector).Published("order.created")
+	assert.Equal(t, "ABC", string(published[0].Body))
+	assert.Equal(t, "text/x-upper", published[0].Headers[metadata.HeaderContentType])
+
+	assert.Equal(t, []*orderCreated{{ID: "abc"}, {ID: "def"}}, received)
+	assert.Empty(t, *errs)
+}